@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/did-server/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configPath string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Config commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective config with secrets redacted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		out, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(out))
+		return nil
+	},
+}
+
+// loadConfig resolves defaults, the --config file, environment variables
+// and finally the flags set on cmd, then validates the result
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("port") {
+		cfg.Server.Port = port
+	}
+	if flags.Changed("chain") {
+		cfg.Chain.Name = chain
+	}
+	if flags.Changed("concurrency") {
+		cfg.Job.Concurrency = airdropConcurrency
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func init() {
+	configPrintCmd.Flags().StringVarP(&chain, "chain", "c", "dev", "chain name")
+	configPrintCmd.Flags().StringVarP(&port, "port", "p", "8080", "listen port")
+	configCmd.AddCommand(configPrintCmd)
+}
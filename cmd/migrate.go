@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/database"
+	klog "github.com/go-kratos/kratos/v2/log"
+	"github.com/spf13/cobra"
+)
+
+var migrateTo int
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Database schema migrations",
+	Long: `Apply or revert the versioned migrations of the database schema.
+
+The server applies pending migrations on start unless database.autoMigrate is
+off. Turn it off when replicas share a postgres database, and run
+"migrate up" before rolling out a new version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply migrations up to --to, the latest by default",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openMigrateDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		target := database.LatestVersion()
+		if cmd.Flags().Changed("to") {
+			target = migrateTo
+		}
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if target < version {
+			return fmt.Errorf("schema version %d is above %d, use migrate down", version, target)
+		}
+
+		err = db.Migrate(target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("schema version %d\n", target)
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert migrations down to --to, one by default",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openMigrateDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		target := version - 1
+		if cmd.Flags().Changed("to") {
+			target = migrateTo
+		}
+		if target < 0 || target > version {
+			return fmt.Errorf("schema version %d can not go down to %d", version, target)
+		}
+
+		err = db.MigrateDown(target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("schema version %d\n", target)
+		return nil
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openMigrateDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		status, err := db.Migrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%d\t%s\t%s\n", m.Version, m.Name, applied)
+		}
+		return nil
+	},
+}
+
+// openMigrateDB opens the configured database without migrating it
+func openMigrateDB(cmd *cobra.Command) (*database.DataBase, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := klog.With(klog.NewStdLogger(os.Stdout),
+		"ts", klog.DefaultTimestamp,
+		"caller", klog.DefaultCaller,
+	)
+	return database.OpenDB(&cfg.Database, klog.NewHelper(logger))
+}
+
+func init() {
+	migrateUpCmd.Flags().IntVar(&migrateTo, "to", 0, "schema version")
+	migrateDownCmd.Flags().IntVar(&migrateTo, "to", 0, "schema version")
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+}
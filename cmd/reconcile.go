@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/did"
+	klog "github.com/go-kratos/kratos/v2/log"
+	"github.com/spf13/cobra"
+)
+
+var reconcileRepair bool
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Check the numbers database against the DIDs on chain",
+	Long: `Check every DID in the numbers database against its number and status on
+chain and print the mismatches: numbers missing locally or on chain, numbers
+that differ and DIDs deactivated on chain only. DIDs of registration jobs that
+went through are checked too, and numbers held by several DIDs, in the
+database or on chain, are printed as number conflicts.
+
+With --repair the database is fixed after the chain. DIDs with a registration
+in flight are skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runReconcile(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	reconcileCmd.Flags().StringVarP(&chain, "chain", "c", "dev", "chain name")
+	reconcileCmd.Flags().BoolVar(&reconcileRepair, "repair", false, "fix the database after the chain")
+}
+
+func runReconcile(cfg *config.Config) error {
+	logger := klog.With(klog.NewStdLogger(os.Stdout),
+		"ts", klog.DefaultTimestamp,
+		"caller", klog.DefaultCaller,
+	)
+	memoDID, err := did.NewMemoDID(cfg, klog.NewHelper(logger))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := memoDID.Reconcile(ctx, reconcileRepair)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range report.Mismatches {
+		fmt.Printf("%s\t%s\tlocal %d\tchain %d\trepaired %t\t%s\n", m.DID, m.Kind, m.Local, m.Chain, m.Repaired, m.Error)
+	}
+	for _, c := range report.Conflicts {
+		fmt.Printf("number conflict\t%d\t%s\t%v\n", c.Num, c.Source, c.DIDs)
+	}
+	fmt.Printf("%d DIDs checked, %d skipped, %d failed, %d mismatches, %d number conflicts\n",
+		report.Checked, report.Skipped, report.Failed, len(report.Mismatches), len(report.Conflicts))
+
+	return nil
+}
@@ -1,14 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/did-server/config"
+	"github.com/did-server/internal/did"
 	"github.com/did-server/internal/server"
+	"github.com/ethereum/go-ethereum/common"
+	klog "github.com/go-kratos/kratos/v2/log"
 	"github.com/spf13/cobra"
 )
 
@@ -17,11 +31,30 @@ var (
 	chain string
 )
 
+var (
+	airdropFile        string
+	airdropBatch       string
+	airdropReport      string
+	airdropConcurrency int
+)
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the application",
 	Run: func(cmd *cobra.Command, args []string) {
-		srv := server.NewServer(chain, port)
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// the background loops stop with the server
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		srv, err := server.NewServer(ctx, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		go func() {
 			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -29,10 +62,15 @@ var runCmd = &cobra.Command{
 			}
 		}()
 
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		<-quit
+		<-ctx.Done()
 		fmt.Println("Shutting down server...")
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		err = srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Println(err)
+		}
 	},
 }
 
@@ -44,6 +82,29 @@ var stopCmd = &cobra.Command{
 	},
 }
 
+var airdropCmd = &cobra.Command{
+	Use:   "airdrop",
+	Short: "Register DIDs for every address in a csv or json file",
+	Long: `Register DIDs by admin for every address in a csv (first column) or json
+(array of addresses) file and write a per-address report.
+
+Registrations are stored as jobs of one batch, named after the file content
+unless --batch is given. If the command is interrupted, run it again with the
+same file to resume: addresses already in the batch are not sent twice.
+Do not run it while a server uses the same database.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runAirdrop(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
 var ServerCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Server commands",
@@ -54,6 +115,146 @@ var ServerCmd = &cobra.Command{
 
 func init() {
 	runCmd.Flags().StringVarP(&port, "port", "p", "8080", "listen port")
-	runCmd.Flags().StringVarP(&chain, "chain", "c", "dev", "listen port")
-	ServerCmd.AddCommand(runCmd, stopCmd)
+	runCmd.Flags().StringVarP(&chain, "chain", "c", "dev", "chain name")
+
+	airdropCmd.Flags().StringVarP(&airdropFile, "file", "f", "", "csv or json file with addresses")
+	airdropCmd.Flags().StringVarP(&chain, "chain", "c", "dev", "chain name")
+	airdropCmd.Flags().StringVarP(&airdropBatch, "batch", "b", "", "batch id, derived from the file content by default")
+	airdropCmd.Flags().StringVarP(&airdropReport, "report", "r", "", "report file, <file>.report.csv by default")
+	airdropCmd.Flags().IntVar(&airdropConcurrency, "concurrency", 16, "registrations in flight at the same time")
+	airdropCmd.MarkFlagRequired("file")
+
+	ServerCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file (.yaml, .yml or .toml)")
+	ServerCmd.AddCommand(runCmd, stopCmd, airdropCmd, reconcileCmd, migrateCmd, configCmd)
+}
+
+func runAirdrop(cfg *config.Config) error {
+	data, err := os.ReadFile(airdropFile)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := parseAddressList(airdropFile, data)
+	if err != nil {
+		return err
+	}
+
+	batch := airdropBatch
+	if batch == "" {
+		sum := sha256.Sum256(data)
+		batch = "airdrop-" + hex.EncodeToString(sum[:8])
+	}
+
+	report := airdropReport
+	if report == "" {
+		report = strings.TrimSuffix(airdropFile, filepath.Ext(airdropFile)) + ".report.csv"
+	}
+
+	logger := klog.With(klog.NewStdLogger(os.Stdout),
+		"ts", klog.DefaultTimestamp,
+		"caller", klog.DefaultCaller,
+	)
+	memoDID, err := did.NewMemoDID(cfg, klog.NewHelper(logger))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	go memoDID.RunJobs(ctx)
+	go memoDID.Controller.RunFeeBumper(ctx)
+	go memoDID.Controller.Balance().Run(ctx)
+
+	fmt.Printf("airdrop batch %s: %d addresses\n", batch, len(addresses))
+	results, err := memoDID.EnqueueAirdrop(ctx, batch, addresses)
+	if err != nil {
+		return err
+	}
+
+	// addresses rejected before a job was stored only show up here
+	var rejected []did.AirdropResult
+	for _, r := range results {
+		if r.DID == "" {
+			rejected = append(rejected, r)
+		}
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		results, err := memoDID.AirdropReport(batch)
+		if err != nil {
+			return err
+		}
+		results = append(rejected, results...)
+
+		err = writeAirdropReport(report, results)
+		if err != nil {
+			return err
+		}
+
+		if did.AirdropDone(results) {
+			fmt.Printf("airdrop batch %s done, report written to %s\n", batch, report)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("airdrop batch %s interrupted, run the command again to resume\n", batch)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseAddressList reads a json array of addresses, or the first column of
+// a csv file where a header line is skipped
+func parseAddressList(name string, data []byte) ([]string, error) {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		var addresses []string
+		err := json.Unmarshal(data, &addresses)
+		return addresses, err
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var addresses []string
+	for line := 0; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || record[0] == "" {
+			continue
+		}
+		if line == 0 && !common.IsHexAddress(record[0]) {
+			continue
+		}
+		addresses = append(addresses, record[0])
+	}
+
+	return addresses, nil
+}
+
+func writeAirdropReport(path string, results []did.AirdropResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"address", "did", "number", "txHash", "status", "error"})
+	for _, r := range results {
+		w.Write([]string{r.Address, r.DID, strconv.Itoa(r.Number), r.TxHash, r.Status, r.Error})
+	}
+	w.Flush()
+
+	return w.Error()
 }
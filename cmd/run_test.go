@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/did-server/internal/did"
+)
+
+func TestParseAddressList(t *testing.T) {
+	a := "0xc145A262565C746fc1596ba92b85E43F006b9566"
+	b := "0x5B38Da6a701c568545dCfcB03FcB875f56beddC4"
+
+	for _, c := range []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"list.json", `["` + a + `", "` + b + `"]`, []string{a, b}},
+		{"list.JSON", `["` + a + `"]`, []string{a}},
+		{"list.csv", "address,amount\n" + a + ",1\n\n" + b + ",2\n", []string{a, b}},
+		{"list.csv", a + "\n" + b + "\n", []string{a, b}},
+		{"list.txt", a + "\n ," + "\n" + b, []string{a, b}},
+		// only the first line is taken as a header
+		{"list.csv", "address\n" + a + "\nnot an address\n", []string{a, "not an address"}},
+	} {
+		got, err := parseAddressList(c.name, []byte(c.data))
+		if err != nil {
+			t.Fatalf("%s %q: %s", c.name, c.data, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%s %q: got %v, want %v", c.name, c.data, got, c.want)
+		}
+	}
+
+	_, err := parseAddressList("list.json", []byte(a))
+	if err == nil {
+		t.Fatal("parsed a json list that is not an array")
+	}
+}
+
+func TestWriteAirdropReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	err := writeAirdropReport(path, []did.AirdropResult{
+		{Address: "bad", Status: "failed", Error: "invalid address"},
+		{Address: "0xc145A262565C746fc1596ba92b85E43F006b9566", DID: "did:memo:aa", Number: 100001, TxHash: "0x01", Status: "mined"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"address", "did", "number", "txHash", "status", "error"},
+		{"bad", "", "0", "", "failed", "invalid address"},
+		{"0xc145A262565C746fc1596ba92b85E43F006b9566", "did:memo:aa", "100001", "0x01", "mined", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("report %v", records)
+	}
+}
@@ -15,128 +15,116 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/did/create": {
-            "post": {
-                "description": "Create a new DID with user signature and address",
-                "consumes": [
-                    "application/json"
-                ],
+        "/1.0/identifiers/{did}": {
+            "get": {
+                "description": "Resolve a did:memo or did:mfile DID to its W3C DID Document. Accept application/did+ld+json returns the document alone, otherwise the resolution result is returned.",
                 "produces": [
-                    "application/json"
+                    "application/did+ld+json",
+                    "application/ld+json"
                 ],
                 "tags": [
                     "DID"
                 ],
+                "summary": "ResolveDID",
                 "parameters": [
                     {
-                        "description": "user signature",
-                        "name": "sig",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    {
-                        "description": "user address",
-                        "name": "address",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "string"
-                        }
+                        "type": "string",
+                        "description": "did",
+                        "name": "did",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.CreateDIDResponse"
+                            "$ref": "#/definitions/router.ResolutionResponse"
                         }
                     },
-                    "502": {
-                        "description": "Bad Gateway",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/router.Error"
+                            "$ref": "#/definitions/router.ResolutionResponse"
                         }
                     },
-                    "503": {
-                        "description": "Service Unavailable",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/router.Error"
+                            "$ref": "#/definitions/router.ResolutionResponse"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/router.ResolutionResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/router.ResolutionResponse"
                         }
                     }
                 }
             }
         },
-        "/did/createadmin": {
-            "post": {
-                "description": "Create a new DID By Admin",
-                "consumes": [
-                    "application/json"
-                ],
+        "/admin/balance": {
+            "get": {
+                "description": "Balance of the admin account paying for registrations, how many registrations it pays for\nat the current gas price and whether registrations are paused for low funds",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "DID"
+                    "admin"
                 ],
-                "summary": "Create a new DID By Admin",
                 "parameters": [
                     {
-                        "description": "user address",
-                        "name": "address",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "string"
-                        }
+                        "type": "boolean",
+                        "description": "read the balance now instead of the last periodic read",
+                        "name": "refresh",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.CreateDIDResponse"
+                            "$ref": "#/definitions/contract.AdminBalance"
+                        }
+                    },
+                    "582": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
                         }
                     }
                 }
             }
         },
-        "/did/createsigmsg": {
+        "/admin/reconcile": {
             "get": {
-                "description": "Get the signature message for creating a DID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Report of the last periodic check of the numbers DB against the DIDs on chain, null before the\nfirst one",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "DID"
-                ],
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "address",
-                        "name": "address",
-                        "in": "query",
-                        "required": true
-                    }
+                    "admin"
                 ],
+                "summary": "GetReconcile",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.GetSigMsgResponse"
+                            "$ref": "#/definitions/did.ReconcileReport"
                         }
                     }
                 }
             }
         },
-        "/did/createton": {
+        "/did/addverifyinfo": {
             "post": {
-                "description": "Create a new Ton DID By Admin",
+                "description": "Add a verification method to a DID, signed by the DID controller",
                 "consumes": [
                     "application/json"
                 ],
@@ -146,44 +134,28 @@ const docTemplate = `{
                 "tags": [
                     "DID"
                 ],
-                "summary": "Create a new Ton DID By Admin",
                 "parameters": [
                     {
-                        "description": "user address",
-                        "name": "address",
+                        "description": "user did",
+                        "name": "did",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "string"
                         }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    {
+                        "description": "address, pubkey or ton",
+                        "name": "type",
+                        "in": "body",
+                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/router.CreateDIDResponse"
+                            "type": "string"
                         }
-                    }
-                }
-            }
-        },
-        "/did/delete": {
-            "post": {
-                "description": "DeleteDID",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "DID"
-                ],
-                "parameters": [
+                    },
                     {
-                        "description": "user signature",
-                        "name": "sig",
+                        "description": "address or hex public key",
+                        "name": "key",
                         "in": "body",
                         "required": true,
                         "schema": {
@@ -191,8 +163,8 @@ const docTemplate = `{
                         }
                     },
                     {
-                        "description": "did",
-                        "name": "did",
+                        "description": "signature over the addverifysigmsg message",
+                        "name": "sig",
                         "in": "body",
                         "required": true,
                         "schema": {
@@ -204,17 +176,35 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.DeleteDIDResponse"
+                            "$ref": "#/definitions/router.AddVerifyInfoResponse"
                         }
                     },
-                    "502": {
-                        "description": "Bad Gateway",
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "563": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "564": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "566": {
+                        "description": "",
                         "schema": {
                             "$ref": "#/definitions/router.Error"
                         }
                     },
-                    "504": {
-                        "description": "Gateway Timeout",
+                    "570": {
+                        "description": "",
                         "schema": {
                             "$ref": "#/definitions/router.Error"
                         }
@@ -222,9 +212,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/did/deletesigmsg": {
+        "/did/addverifysigmsg": {
             "get": {
-                "description": "GetDeleteSigMsg",
+                "description": "Get the message the DID controller signs to add a verification method",
                 "consumes": [
                     "application/json"
                 ],
@@ -241,6 +231,20 @@ const docTemplate = `{
                         "name": "did",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address, pubkey or ton",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address or hex public key",
+                        "name": "key",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -249,13 +253,19 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.GetSigMsgResponse"
                         }
+                    },
+                    "566": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
                     }
                 }
             }
         },
-        "/did/exist": {
-            "get": {
-                "description": "GetDIDExist",
+        "/did/changeverifyinfo": {
+            "post": {
+                "description": "Rotate or revoke a verification method of a DID, signed by the DID controller",
                 "consumes": [
                     "application/json"
                 ],
@@ -267,26 +277,119 @@ const docTemplate = `{
                 ],
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "user address",
-                        "name": "address",
-                        "in": "query",
-                        "required": true
+                        "description": "user did",
+                        "name": "did",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "verification method index",
+                        "name": "index",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    {
+                        "description": "rotate or revoke",
+                        "name": "action",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "address, pubkey or ton, for rotate",
+                        "name": "type",
+                        "in": "body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "address or hex public key, for rotate",
+                        "name": "key",
+                        "in": "body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "signature over the changeverifysigmsg message",
+                        "name": "sig",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/router.ChangeVerifyInfoResponse"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "563": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "564": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "566": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "567": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "568": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "569": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "570": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
                         }
                     }
                 }
             }
         },
-        "/did/info": {
+        "/did/changeverifysigmsg": {
             "get": {
-                "description": "GetDIDInfo",
+                "description": "Get the message the DID controller signs to rotate or revoke a verification method",
                 "consumes": [
                     "application/json"
                 ],
@@ -300,20 +403,52 @@ const docTemplate = `{
                     {
                         "type": "string",
                         "description": "user did",
-                        "name": "address",
+                        "name": "did",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "verification method index",
+                        "name": "index",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "rotate or revoke",
+                        "name": "action",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address, pubkey or ton, for rotate",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "address or hex public key, for rotate",
+                        "name": "key",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.GetDIDInfoResponse"
+                            "$ref": "#/definitions/router.GetSigMsgResponse"
                         }
                     },
-                    "503": {
-                        "description": "Service Unavailable",
+                    "566": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "567": {
+                        "description": "",
                         "schema": {
                             "$ref": "#/definitions/router.Error"
                         }
@@ -321,9 +456,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/mfile/download": {
-            "get": {
-                "description": "download file by mdid",
+        "/did/create": {
+            "post": {
+                "description": "Create a new DID with user signature and address",
                 "consumes": [
                     "application/json"
                 ],
@@ -331,38 +466,122 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "mfile"
+                    "DID"
                 ],
-                "summary": "Download",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "mdid",
-                        "name": "mdid",
-                        "in": "query",
-                        "required": true
+                        "description": "user signature",
+                        "name": "sig",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
                     },
                     {
-                        "type": "string",
-                        "description": "address",
+                        "description": "user address",
                         "name": "address",
-                        "in": "query",
-                        "required": true
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.CreateDIDJobResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/createadmin": {
+            "post": {
+                "description": "Create a new DID By Admin",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "summary": "Create a new DID By Admin",
+                "parameters": [
+                    {
+                        "description": "user address",
+                        "name": "address",
+                        "in": "body",
+                        "required": true,
                         "schema": {
                             "type": "string"
                         }
                     }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.CreateDIDJobResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
                 }
             }
         },
-        "/mfile/upload/confirm": {
+        "/did/createadmin/batch": {
+            "get": {
+                "description": "Get the per-address report of an airdrop batch",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "batch id",
+                        "name": "batch",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.AirdropBatchResponse"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "upload confirm with sig",
+                "description": "Queue free registrations for up to 1000 addresses. Addresses already registered are skipped,\nposting the same batch again only adds addresses that are not in it yet.",
                 "consumes": [
                     "application/json"
                 ],
@@ -370,22 +589,101 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "mfile"
+                    "DID"
                 ],
-                "summary": "UploadConfirm",
+                "summary": "Create DIDs for a list of addresses By Admin",
                 "parameters": [
                     {
-                        "description": "sig",
-                        "name": "sig",
+                        "description": "user addresses",
+                        "name": "addresses",
                         "in": "body",
                         "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    {
+                        "description": "batch id, generated if empty",
+                        "name": "batch",
+                        "in": "body",
                         "schema": {
                             "type": "string"
                         }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.AirdropBatchResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
                     },
+                    "561": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/createsigmsg": {
+            "get": {
+                "description": "Get the signature message for creating a DID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
                     {
+                        "type": "string",
                         "description": "address",
                         "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.GetSigMsgResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/createton": {
+            "post": {
+                "description": "Create a new Ton DID By Admin",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "summary": "Create a new Ton DID By Admin",
+                "parameters": [
+                    {
+                        "description": "user address",
+                        "name": "address",
                         "in": "body",
                         "required": true,
                         "schema": {
@@ -395,17 +693,23 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/router.CreateDIDJobResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
                         }
                     }
                 }
             }
         },
-        "/mfile/upload/create": {
+        "/did/delete": {
             "post": {
-                "description": "create upload request get msg to sign",
+                "description": "DeleteDID",
                 "consumes": [
                     "application/json"
                 ],
@@ -413,13 +717,12 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "mfile"
+                    "DID"
                 ],
-                "summary": "UploadCreate",
                 "parameters": [
                     {
-                        "description": "data",
-                        "name": "data",
+                        "description": "user signature",
+                        "name": "sig",
                         "in": "body",
                         "required": true,
                         "schema": {
@@ -427,8 +730,8 @@ const docTemplate = `{
                         }
                     },
                     {
-                        "description": "address",
-                        "name": "address",
+                        "description": "did",
+                        "name": "did",
                         "in": "body",
                         "required": true,
                         "schema": {
@@ -438,50 +741,1251 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/router.DeleteDIDResponse"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "563": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "564": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "565": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "router.CreateDIDResponse": {
-            "type": "object",
-            "properties": {
-                "did": {
-                    "type": "string"
-                }
-            }
-        },
-        "router.DIDInfo": {
-            "type": "object",
-            "properties": {
-                "address": {
-                    "type": "string"
-                },
-                "balance": {
-                    "type": "number"
-                },
-                "chain": {
-                    "type": "string"
-                }
-            }
-        },
-        "router.DeleteDIDResponse": {
-            "type": "object",
-            "properties": {
-                "did": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string"
-                }
-            }
         },
-        "router.Error": {
+        "/did/deletesigmsg": {
+            "get": {
+                "description": "GetDeleteSigMsg",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user did",
+                        "name": "did",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.GetSigMsgResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/events": {
+            "get": {
+                "description": "Contract events of a DID from the event indexer in chain order: creation, deactivation,\nverification method changes and the mfile DIDs it registered",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "summary": "GetDIDEvents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "did:memo DID",
+                        "name": "did",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "only events of this name, e.g. DeactivateDID",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "events skipped",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.DIDEventsResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "580": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/exist": {
+            "get": {
+                "description": "GetDIDExist",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/info": {
+            "get": {
+                "description": "GetDIDInfo",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user did",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.GetDIDInfoResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/did/job": {
+            "get": {
+                "description": "Get the status of a queued DID registration",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DID"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.JobResponse"
+                        }
+                    },
+                    "562": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/file": {
+            "delete": {
+                "description": "delete a file of address, signed by address over a delete challenge",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "file"
+                ],
+                "summary": "file delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "file name",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "nonce of the delete challenge",
+                        "name": "X-Challenge-Nonce",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature over the challenge",
+                        "name": "X-Challenge-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.FileInfoResponse"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "578": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "579": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/file/challenge": {
+            "get": {
+                "description": "get a single-use challenge address signs to upload, download, list or delete its files",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "file"
+                ],
+                "summary": "file challenge",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "upload, download, list or delete",
+                        "name": "action",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "file name, the cid for a download by cid. Not needed to list",
+                        "name": "name",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.ChallengeResponse"
+                        }
+                    },
+                    "581": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/file/download": {
+            "get": {
+                "description": "download a file of address by name or cid, signed by address over a download challenge of the name or cid",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "file"
+                ],
+                "summary": "file download",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "file name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "file cid, if name is empty. Only files of address are found, mfiles are downloaded from /mfile/download",
+                        "name": "cid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "single byte range, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nonce of the download challenge",
+                        "name": "X-Challenge-Nonce",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature over the challenge",
+                        "name": "X-Challenge-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "578": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "579": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/file/list": {
+            "get": {
+                "description": "list the files of address, a page at a time, signed by address over a list challenge",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "file"
+                ],
+                "summary": "file list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "list files after this name, the next marker of the previous page",
+                        "name": "marker",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nonce of the list challenge",
+                        "name": "X-Challenge-Nonce",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature over the challenge",
+                        "name": "X-Challenge-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.FileListResponse"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "577": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "578": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/file/upload": {
+            "post": {
+                "description": "upload file to the bucket of address, signed by address over an upload challenge of the object name",
+                "consumes": [
+                    "multipart/form-data",
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "file"
+                ],
+                "summary": "file upload",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "file, or the raw body as application/octet-stream",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "object name, the file name by default",
+                        "name": "name",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nonce of the upload challenge",
+                        "name": "X-Challenge-Nonce",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature over the challenge",
+                        "name": "X-Challenge-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.FileInfoResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "578": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "server health, degraded while the storage node or the chain rpc is down",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mfile/download": {
+            "get": {
+                "description": "download file by mdid. Files that are not registered with price 0 need a signed challenge from an address of a did that controls, bought or was granted the file.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "mfile"
+                ],
+                "summary": "Download",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mdid",
+                        "name": "mdid",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address, for priced files",
+                        "name": "address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "did of address, for priced files",
+                        "name": "did",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nonce of the download challenge, for priced files",
+                        "name": "X-Challenge-Nonce",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature over the challenge, for priced files",
+                        "name": "X-Challenge-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "single byte range, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag or Last-Modified the range applies to",
+                        "name": "If-Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "576": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.DownloadDeniedResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mfile/download/challenge": {
+            "get": {
+                "description": "get a single-use challenge address signs to download a priced mfile",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mfile"
+                ],
+                "summary": "DownloadChallenge",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "mdid",
+                        "name": "mdid",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.ChallengeResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mfile/upload/confirm": {
+            "post": {
+                "description": "upload confirm with sig",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mfile"
+                ],
+                "summary": "UploadConfirm",
+                "parameters": [
+                    {
+                        "description": "signature over the upload/create message",
+                        "name": "sig",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "mdid",
+                        "name": "mdid",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadConfirmResponse"
+                        }
+                    },
+                    "557": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "559": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadConfirmResponse"
+                        }
+                    },
+                    "571": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "572": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadConfirmResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mfile/upload/create": {
+            "post": {
+                "description": "create upload request get msg to sign",
+                "consumes": [
+                    "multipart/form-data",
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mfile"
+                ],
+                "summary": "UploadCreate",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "file, or the raw body as application/octet-stream",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "address",
+                        "name": "address",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "controller did",
+                        "name": "did",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "price in wei, or a decimal amount with unit wei, gwei or ether, e.g. 1.5gwei",
+                        "name": "price",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "comma separated keywords",
+                        "name": "keywords",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Keccak256 of the file, checked while uploading",
+                        "name": "hash",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "mdid and message to sign",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "561": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "572": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "573": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "575": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "583": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    },
+                    "584": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/router.Error"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "contract.AdminBalance": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "balance": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "gasPrice": {
+                    "type": "string"
+                },
+                "low": {
+                    "type": "boolean"
+                },
+                "minBalance": {
+                    "type": "string"
+                },
+                "registrationGas": {
+                    "type": "integer"
+                },
+                "registrationsLeft": {
+                    "type": "integer"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "contract.ClientHealth": {
+            "type": "object",
+            "properties": {
+                "endpoint": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "healthy": {
+                    "type": "boolean"
+                },
+                "since": {
+                    "type": "string"
+                }
+            }
+        },
+        "did.AirdropResult": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "did": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "number": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "txHash": {
+                    "type": "string"
+                }
+            }
+        },
+        "did.Conflict": {
+            "type": "object",
+            "properties": {
+                "dids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "num": {
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "local or chain",
+                    "type": "string"
+                }
+            }
+        },
+        "did.DIDDocument": {
+            "type": "object",
+            "properties": {
+                "@context": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "authentication": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "controller": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "verificationMethod": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/did.VerificationMethod"
+                    }
+                }
+            }
+        },
+        "did.DIDDocumentMetadata": {
+            "type": "object",
+            "properties": {
+                "deactivated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "did.Mismatch": {
+            "type": "object",
+            "properties": {
+                "chain": {
+                    "type": "integer"
+                },
+                "did": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "local": {
+                    "type": "integer"
+                },
+                "repaired": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "did.ReconcileReport": {
+            "type": "object",
+            "properties": {
+                "checked": {
+                    "type": "integer"
+                },
+                "conflicts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/did.Conflict"
+                    }
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "mismatches": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/did.Mismatch"
+                    }
+                },
+                "repair": {
+                    "type": "boolean"
+                },
+                "skipped": {
+                    "type": "integer"
+                },
+                "startedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "did.VerificationMethod": {
+            "type": "object",
+            "properties": {
+                "blockchainAccountId": {
+                    "type": "string"
+                },
+                "controller": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "publicKeyHex": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "gateway.NodeHealth": {
+            "type": "object",
+            "properties": {
+                "addr": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "healthy": {
+                    "type": "boolean"
+                },
+                "since": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.AddVerifyInfoResponse": {
+            "type": "object",
+            "properties": {
+                "did": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "router.AirdropBatchResponse": {
+            "type": "object",
+            "properties": {
+                "batch": {
+                    "type": "string"
+                },
+                "done": {
+                    "type": "boolean"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/did.AirdropResult"
+                    }
+                }
+            }
+        },
+        "router.ChallengeResponse": {
+            "type": "object",
+            "properties": {
+                "expires": {
+                    "type": "integer"
+                },
+                "msg": {
+                    "type": "string"
+                },
+                "nonce": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.ChangeVerifyInfoResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "did": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "router.CreateDIDJobResponse": {
+            "type": "object",
+            "properties": {
+                "did": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.DIDEventsResponse": {
+            "type": "object",
+            "properties": {
+                "did": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/router.EventResponse"
+                    }
+                },
+                "indexedBlock": {
+                    "type": "integer"
+                }
+            }
+        },
+        "router.DIDInfo": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "balance": {
+                    "type": "number"
+                },
+                "chain": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.DeleteDIDResponse": {
+            "type": "object",
+            "properties": {
+                "did": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.DownloadDeniedResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.Error": {
             "type": "object",
             "properties": {
                 "code": {
@@ -492,6 +1996,69 @@ const docTemplate = `{
                 }
             }
         },
+        "router.EventResponse": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "object"
+                },
+                "blockHash": {
+                    "type": "string"
+                },
+                "blockNumber": {
+                    "type": "integer"
+                },
+                "contract": {
+                    "type": "string"
+                },
+                "did": {
+                    "type": "string"
+                },
+                "logIndex": {
+                    "type": "integer"
+                },
+                "mfile": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "txHash": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.FileInfoResponse": {
+            "type": "object",
+            "properties": {
+                "cid": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.FileListResponse": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/router.FileInfoResponse"
+                    }
+                },
+                "nextMarker": {
+                    "type": "string"
+                }
+            }
+        },
         "router.GetDIDInfoResponse": {
             "type": "object",
             "properties": {
@@ -513,6 +2080,94 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "router.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "chain": {
+                    "$ref": "#/definitions/contract.ClientHealth"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "storage": {
+                    "$ref": "#/definitions/gateway.NodeHealth"
+                }
+            }
+        },
+        "router.JobResponse": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "did": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "number": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "txHash": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.ResolutionMetadata": {
+            "type": "object",
+            "properties": {
+                "contentType": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.ResolutionResponse": {
+            "type": "object",
+            "properties": {
+                "@context": {
+                    "type": "string"
+                },
+                "didDocument": {
+                    "$ref": "#/definitions/did.DIDDocument"
+                },
+                "didDocumentMetadata": {
+                    "$ref": "#/definitions/did.DIDDocumentMetadata"
+                },
+                "didResolutionMetadata": {
+                    "$ref": "#/definitions/router.ResolutionMetadata"
+                }
+            }
+        },
+        "router.UploadConfirmResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "mdid": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "txHash": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -524,7 +2179,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/",
 	Schemes:          []string{},
 	Title:            "DID-Server API",
-	Description:      "1. get createsigmsg\n2. create/createadmin (createadmin is free and not need createsigmsg)\n3. exist (confirm did exist)\n4. info (get did info)",
+	Description:      "did\n1. get createsigmsg\n2. create/createadmin (createadmin is free and not need createsigmsg)\n3. exist (confirm did exist)\n4. info (get did info)\nmfile (file did)\n1. create (create file did)\n2. confirm (confirm file did)\n3. download (download )",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
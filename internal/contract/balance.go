@@ -0,0 +1,195 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	balanceInterval        = 30 * time.Second
+	defaultRegistrationGas = uint64(300000)
+)
+
+var (
+	adminBalance = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "did_admin_balance_ether",
+		Help: "Balance of the admin account in ether.",
+	})
+
+	registrationsLeft = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "did_admin_registrations_left",
+		Help: "Registrations the admin balance pays for at the current gas price.",
+	})
+)
+
+// AdminBalance is the last balance read of the admin account. Amounts are
+// decimal strings in wei.
+type AdminBalance struct {
+	Address           string    `json:"address"`
+	Balance           string    `json:"balance"`
+	GasPrice          string    `json:"gasPrice"`
+	RegistrationGas   uint64    `json:"registrationGas"`
+	RegistrationsLeft uint64    `json:"registrationsLeft"`
+	MinBalance        string    `json:"minBalance"`
+	Low               bool      `json:"low"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// BalanceWatcher reads the admin balance periodically. The balance is low
+// below minBalance, or without one when it does not pay for another
+// registration at the current gas price.
+type BalanceWatcher struct {
+	backend    Backend
+	account    common.Address
+	fees       func() *FeeStrategy
+	minBalance *big.Int
+	logger     *log.Helper
+
+	lock    sync.RWMutex
+	gas     uint64
+	balance AdminBalance
+}
+
+func newBalanceWatcher(backend Backend, account common.Address, fees func() *FeeStrategy, logger *log.Helper) *BalanceWatcher {
+	return &BalanceWatcher{
+		backend: backend,
+		account: account,
+		fees:    fees,
+		logger:  logger,
+		gas:     defaultRegistrationGas,
+		balance: AdminBalance{Address: account.Hex()},
+	}
+}
+
+// SetLimits sets the balance under which registrations pause, nil to pause
+// when one registration is not paid for, and the gas of one registration
+// assumed until one is mined, 0 to keep the default
+func (w *BalanceWatcher) SetLimits(minBalance *big.Int, registrationGas uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.minBalance = minBalance
+	if registrationGas > 0 {
+		w.gas = registrationGas
+	}
+}
+
+// observeGas learns the gas of a registration from a mined one
+func (w *BalanceWatcher) observeGas(gas uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.gas = gas
+}
+
+// Get is the last balance read
+func (w *BalanceWatcher) Get() AdminBalance {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	return w.balance
+}
+
+// Refresh reads the balance and the gas price. On error the last balance
+// is kept with the error.
+func (w *BalanceWatcher) Refresh(ctx context.Context) (AdminBalance, error) {
+	balance, price, err := w.read(ctx)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err != nil {
+		w.balance.Error = err.Error()
+		return w.balance, err
+	}
+
+	b := AdminBalance{
+		Address:         w.account.Hex(),
+		Balance:         balance.String(),
+		GasPrice:        price.String(),
+		RegistrationGas: w.gas,
+		UpdatedAt:       time.Now(),
+	}
+
+	cost := new(big.Int).Mul(price, new(big.Int).SetUint64(w.gas))
+	if cost.Sign() > 0 {
+		left := new(big.Int).Div(balance, cost)
+		if left.IsUint64() {
+			b.RegistrationsLeft = left.Uint64()
+		}
+	}
+
+	if w.minBalance != nil {
+		b.MinBalance = w.minBalance.String()
+		b.Low = balance.Cmp(w.minBalance) < 0
+	} else {
+		b.MinBalance = cost.String()
+		b.Low = balance.Cmp(cost) < 0
+	}
+
+	if b.Low && !w.balance.Low {
+		w.logger.Warnf("admin %s balance %s is below %s, registrations pause", b.Address, b.Balance, b.MinBalance)
+	}
+	w.balance = b
+
+	ether, _ := new(big.Float).Quo(new(big.Float).SetInt(balance), weiPerEther).Float64()
+	adminBalance.Set(ether)
+	registrationsLeft.Set(float64(b.RegistrationsLeft))
+
+	return b, nil
+}
+
+// read returns the balance and the price per gas a new transaction is
+// expected to pay
+func (w *BalanceWatcher) read(ctx context.Context) (*big.Int, *big.Int, error) {
+	balance, err := w.backend.BalanceAt(ctx, w.account, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fees, err := w.fees().Fees(ctx, w.backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fees.GasPrice != nil {
+		return balance, fees.GasPrice, nil
+	}
+
+	head, err := w.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	price := new(big.Int).Add(head.BaseFee, fees.GasTipCap)
+	if price.Cmp(fees.GasFeeCap) > 0 {
+		price = fees.GasFeeCap
+	}
+
+	return balance, price, nil
+}
+
+// Run refreshes the balance until ctx is done
+func (w *BalanceWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(balanceInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := w.Refresh(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Warnf("admin balance: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
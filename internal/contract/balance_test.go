@@ -0,0 +1,57 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func TestBalanceWatcher(t *testing.T) {
+	funded := common.HexToAddress("0x0000000000000000000000000000000000000a11")
+	empty := common.HexToAddress(address)
+	balance := new(big.Int).Mul(big.NewInt(1), big.NewInt(1e18))
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{funded: {Balance: balance}}, 10000000)
+	defer backend.Close()
+
+	logger := log.NewHelper(log.NewStdLogger(os.Stdout))
+	gasPrice := big.NewInt(1e9)
+	fees := func() *FeeStrategy { return &FeeStrategy{GasPrice: gasPrice} }
+
+	w := newBalanceWatcher(backend, funded, fees, logger)
+	w.SetLimits(nil, 100000)
+	b, err := w.Refresh(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1 ether at 1 gwei and 100000 gas a registration
+	if b.Low || b.RegistrationsLeft != 10000 || b.Balance != balance.String() {
+		t.Fatalf("funded: %+v", b)
+	}
+
+	w.SetLimits(new(big.Int).Mul(big.NewInt(2), big.NewInt(1e18)), 0)
+	b, err = w.Refresh(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Low || b.RegistrationGas != 100000 {
+		t.Fatalf("below the min balance: %+v", b)
+	}
+
+	w = newBalanceWatcher(backend, empty, fees, logger)
+	b, err = w.Refresh(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Low || b.RegistrationsLeft != 0 {
+		t.Fatalf("empty: %+v", b)
+	}
+	if got := w.Get(); !got.Low {
+		t.Fatalf("last read: %+v", got)
+	}
+}
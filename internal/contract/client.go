@@ -0,0 +1,381 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+var (
+	clientCheckInterval = 15 * time.Second
+	clientCheckTimeout  = 10 * time.Second
+)
+
+// ClientHealth is the state of the rpc connection
+type ClientHealth struct {
+	Healthy  bool      `json:"healthy"`
+	Endpoint string    `json:"endpoint"`
+	Error    string    `json:"error,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+// Client is a Backend sharing one connection to an rpc endpoint. It checks
+// the endpoint periodically and fails over to the next one when it stops
+// answering, reads that failed on a dead endpoint are retried on the next.
+type Client struct {
+	endpoints []string
+	logger    *log.Helper
+
+	lock    sync.RWMutex
+	current int
+	client  *ethclient.Client
+	gen     uint64        // bumped on every failover
+	dialing chan struct{} // closed when the failover in progress is done
+	healthy bool
+	err     error
+	since   time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// DialClient connects to the first endpoint that answers
+func DialClient(ctx context.Context, endpoints []string, logger *log.Helper) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, xerrors.New("no rpc endpoint")
+	}
+
+	c := &Client{
+		endpoints: endpoints,
+		logger:    logger,
+		current:   -1,
+		since:     time.Now(),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	var err error
+	for range endpoints {
+		err = c.failover(ctx, c.generation(), nil)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		c.cancel()
+		return nil, err
+	}
+
+	go c.run(c.ctx)
+
+	return c, nil
+}
+
+// failover moves from generation gen to the endpoint after the current one.
+// It runs once per generation: callers that saw an older one, or that come
+// while another failover is dialing, return once it is done without moving
+// on again. The dial and its check run without the lock, the client in use
+// is only swapped once the next one answers.
+func (c *Client) failover(ctx context.Context, gen uint64, reason error) error {
+	c.lock.Lock()
+	if c.dialing != nil || gen != c.gen {
+		dialing := c.dialing
+		c.lock.Unlock()
+		if dialing != nil {
+			<-dialing
+		}
+		return nil
+	}
+	dialing := make(chan struct{})
+	c.dialing = dialing
+	next := (c.current + 1) % len(c.endpoints)
+	if reason != nil && c.current >= 0 {
+		c.logger.Warnf("rpc endpoint %s: %s", c.endpoints[c.current], reason)
+	}
+	c.lock.Unlock()
+
+	endpoint := c.endpoints[next]
+	client, err := dial(ctx, endpoint)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer close(dialing)
+
+	c.dialing = nil
+	c.gen++
+	c.current = next
+	if c.client != nil {
+		c.client.Close()
+	}
+	c.client = client
+	if err != nil {
+		c.setHealth(false, err)
+		c.logger.Warnf("rpc endpoint %s: %s", endpoint, err)
+		return err
+	}
+	c.setHealth(true, nil)
+	return nil
+}
+
+// dial connects to endpoint and checks that it answers
+func dial(ctx context.Context, endpoint string) (*ethclient.Client, error) {
+	client, err := ethclient.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, clientCheckTimeout)
+	defer cancel()
+	_, err = client.BlockNumber(cctx)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *Client) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(clientCheckInterval):
+		}
+
+		cl, gen, err := c.get()
+		if err == nil {
+			cctx, cancel := context.WithTimeout(ctx, clientCheckTimeout)
+			_, err = cl.BlockNumber(cctx)
+			cancel()
+		}
+		if err != nil && ctx.Err() == nil {
+			c.failover(ctx, gen, err)
+		}
+	}
+}
+
+// setHealth is called with the lock held
+func (c *Client) setHealth(healthy bool, err error) {
+	if healthy != c.healthy {
+		c.since = time.Now()
+	}
+	c.healthy = healthy
+	c.err = err
+}
+
+func (c *Client) generation() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.gen
+}
+
+// get returns the client in use and its generation
+func (c *Client) get() (*ethclient.Client, uint64, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.client == nil {
+		return nil, c.gen, xerrors.Errorf("rpc endpoint %s unavailable: %w", c.endpoints[c.current], c.err)
+	}
+	return c.client, c.gen, nil
+}
+
+// report fails over from generation gen if err means the endpoint is down,
+// not that the call was rejected. The dial is not bound to the ctx of the
+// call, its end must not leave the client without an endpoint.
+func (c *Client) report(ctx context.Context, gen uint64, err error) bool {
+	if !isConnectionError(ctx, err) {
+		return false
+	}
+
+	c.failover(c.ctx, gen, err)
+	return true
+}
+
+func isConnectionError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		return false
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	return !errors.Is(err, ethereum.NotFound)
+}
+
+// read runs f on the current endpoint, and on the next ones while they are
+// down
+func read[T any](c *Client, ctx context.Context, f func(*ethclient.Client) (T, error)) (T, error) {
+	var res T
+	var err error
+	for range c.endpoints {
+		var cl *ethclient.Client
+		var gen uint64
+		cl, gen, err = c.get()
+		if err != nil {
+			c.failover(c.ctx, gen, nil)
+			cl, gen, err = c.get()
+			if err != nil {
+				continue
+			}
+		}
+
+		res, err = f(cl)
+		if !c.report(ctx, gen, err) {
+			return res, err
+		}
+	}
+	return res, err
+}
+
+// Endpoint is the endpoint in use
+func (c *Client) Endpoint() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.endpoints[c.current]
+}
+
+func (c *Client) Health() ClientHealth {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	h := ClientHealth{Healthy: c.healthy, Endpoint: c.endpoints[c.current], Since: c.since}
+	if c.err != nil {
+		h.Error = c.err.Error()
+	}
+	return h
+}
+
+func (c *Client) Close() {
+	c.cancel()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+func (c *Client) NetworkID(ctx context.Context) (*big.Int, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*big.Int, error) { return cl.NetworkID(ctx) })
+}
+
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (uint64, error) { return cl.BlockNumber(ctx) })
+}
+
+func (c *Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*big.Int, error) { return cl.BalanceAt(ctx, account, blockNumber) })
+}
+
+func (c *Client) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return read(c, ctx, func(cl *ethclient.Client) ([]byte, error) { return cl.CodeAt(ctx, contract, blockNumber) })
+}
+
+func (c *Client) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return read(c, ctx, func(cl *ethclient.Client) ([]byte, error) { return cl.CallContract(ctx, call, blockNumber) })
+}
+
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*etypes.Header, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*etypes.Header, error) { return cl.HeaderByNumber(ctx, number) })
+}
+
+func (c *Client) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return read(c, ctx, func(cl *ethclient.Client) ([]byte, error) { return cl.PendingCodeAt(ctx, account) })
+}
+
+func (c *Client) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (uint64, error) { return cl.PendingNonceAt(ctx, account) })
+}
+
+func (c *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*big.Int, error) { return cl.SuggestGasPrice(ctx) })
+}
+
+func (c *Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*big.Int, error) { return cl.SuggestGasTipCap(ctx) })
+}
+
+func (c *Client) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (uint64, error) { return cl.EstimateGas(ctx, call) })
+}
+
+func (c *Client) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]etypes.Log, error) {
+	return read(c, ctx, func(cl *ethclient.Client) ([]etypes.Log, error) { return cl.FilterLogs(ctx, query) })
+}
+
+func (c *Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (uint64, error) { return cl.NonceAt(ctx, account, blockNumber) })
+}
+
+func (c *Client) TransactionByHash(ctx context.Context, txHash common.Hash) (*etypes.Transaction, bool, error) {
+	var isPending bool
+	tx, err := read(c, ctx, func(cl *ethclient.Client) (*etypes.Transaction, error) {
+		tx, pending, err := cl.TransactionByHash(ctx, txHash)
+		isPending = pending
+		return tx, err
+	})
+	return tx, isPending, err
+}
+
+func (c *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*etypes.Receipt, error) {
+	return read(c, ctx, func(cl *ethclient.Client) (*etypes.Receipt, error) { return cl.TransactionReceipt(ctx, txHash) })
+}
+
+// SendTransaction is not retried, the nonce manager resyncs and the caller
+// decides whether to send again
+func (c *Client) SendTransaction(ctx context.Context, tx *etypes.Transaction) error {
+	cl, gen, err := c.get()
+	if err != nil {
+		return err
+	}
+
+	err = cl.SendTransaction(ctx, tx)
+	c.report(ctx, gen, err)
+	return err
+}
+
+// SubscribeFilterLogs needs a websocket endpoint, it is not moved on failover
+func (c *Client) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- etypes.Log) (ethereum.Subscription, error) {
+	cl, gen, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := cl.SubscribeFilterLogs(ctx, query, ch)
+	c.report(ctx, gen, err)
+	return sub, err
+}
+
+// SubscribeNewHead needs a websocket endpoint, it is not moved on failover
+func (c *Client) SubscribeNewHead(ctx context.Context, ch chan<- *etypes.Header) (ethereum.Subscription, error) {
+	cl, gen, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := cl.SubscribeNewHead(ctx, ch)
+	c.report(ctx, gen, err)
+	return sub, err
+}
@@ -0,0 +1,115 @@
+package contract
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type stubNode struct {
+	number uint64
+}
+
+func (n *stubNode) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(n.number)
+}
+
+func newStubNode(t *testing.T, number uint64) *httptest.Server {
+	server := rpc.NewServer()
+	t.Cleanup(server.Stop)
+	err := server.RegisterName("eth", &stubNode{number: number})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClientFailover(t *testing.T) {
+	logger := log.NewHelper(log.NewStdLogger(os.Stdout))
+
+	down := newStubNode(t, 1)
+	down.Close()
+	first := newStubNode(t, 2)
+	second := newStubNode(t, 3)
+
+	client, err := DialClient(context.TODO(), []string{down.URL, first.URL, second.URL}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if client.Endpoint() != first.URL {
+		t.Fatalf("dialed %s, want %s", client.Endpoint(), first.URL)
+	}
+
+	// a call the node rejects does not move to another endpoint
+	_, err = client.NetworkID(context.TODO())
+	if err == nil {
+		t.Fatal("net_version is not served")
+	}
+	if client.Endpoint() != first.URL {
+		t.Fatalf("rejected call moved to %s", client.Endpoint())
+	}
+
+	first.Close()
+	number, err := client.BlockNumber(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 3 || client.Endpoint() != second.URL {
+		t.Fatalf("got block %d from %s, want 3 from %s", number, client.Endpoint(), second.URL)
+	}
+	if h := client.Health(); !h.Healthy {
+		t.Fatalf("health after failover: %+v", h)
+	}
+
+	second.Close()
+	_, err = client.BlockNumber(context.TODO())
+	if err == nil {
+		t.Fatal("all endpoints are down")
+	}
+	if h := client.Health(); h.Healthy || h.Error == "" {
+		t.Fatalf("health with all endpoints down: %+v", h)
+	}
+}
+
+func TestClientConcurrentFailover(t *testing.T) {
+	logger := log.NewHelper(log.NewStdLogger(os.Stdout))
+
+	first := newStubNode(t, 1)
+	second := newStubNode(t, 2)
+	third := newStubNode(t, 3)
+
+	client, err := DialClient(context.TODO(), []string{first.URL, second.URL, third.URL}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// calls failing on the same endpoint move on once, to the next one
+	first.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			number, err := client.BlockNumber(context.TODO())
+			if err != nil || number != 2 {
+				t.Errorf("got block %d: %v, want 2", number, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if client.Endpoint() != second.URL {
+		t.Fatalf("failed over to %s, want %s", client.Endpoint(), second.URL)
+	}
+}
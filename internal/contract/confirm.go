@@ -0,0 +1,333 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/memoio/did-solidity/go-contracts/proxy"
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrTxDropped  = xerrors.New("transaction dropped from the pool")
+	ErrTxReplaced = xerrors.New("transaction replaced by another one with the same nonce")
+	ErrTxPending  = xerrors.New("transaction still pending")
+)
+
+var (
+	defaultConfirmations uint64 = 1
+	defaultTxTimeout            = 5 * time.Minute
+	// a transaction neither pending nor mined this many times is dropped
+	droppedAfter = 3
+	// pollInterval is used without a new head subscription
+	pollInterval = time.Duration(nextBlockTime) * time.Second
+)
+
+// RevertError is a transaction mined but reverted
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	return "execution reverted: " + e.Reason
+}
+
+// SetConfirmation sets the number of blocks, counting the one including
+// it, after which a transaction is confirmed, and how long CheckTx waits
+func (c *Controller) SetConfirmation(confirmations uint64, timeout time.Duration) {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	c.confirmations = confirmations
+	c.txTimeout = timeout
+}
+
+// CheckTx waits until txHash, or a version of it with bumped fees, is
+// confirmed and fails if it reverted, was dropped or replaced, or is still
+// pending after the tx timeout. It wakes on new heads if the backend can
+// subscribe to them and polls otherwise. A receipt whose block left the
+// chain in a reorg is waited for again.
+//
+// Callers that sent the transaction pass a context without cancel, so that
+// a client going away does not hide whether a transaction it caused
+// succeeded.
+func (c *Controller) CheckTx(ctx context.Context, txHash common.Hash, name string) error {
+	err := c.waitConfirmed(ctx, txHash, name)
+	if err != nil {
+		err = xerrors.Errorf("%s: transaction(%s): %w", name, txHash, err)
+		if ctx.Err() == nil {
+			c.logger.Error(err)
+		}
+		return err
+	}
+	return nil
+}
+
+type headSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *etypes.Header) (ethereum.Subscription, error)
+}
+
+func (c *Controller) waitConfirmed(parent context.Context, txHash common.Hash, name string) error {
+	ctx, cancel := context.WithTimeout(parent, c.txTimeout)
+	defer cancel()
+
+	var heads chan *etypes.Header
+	var subErr <-chan error
+	var tick <-chan time.Time
+	if hs, ok := c.backend.(headSubscriber); ok {
+		heads = make(chan *etypes.Header, 1)
+		sub, err := hs.SubscribeNewHead(ctx, heads)
+		if err == nil {
+			defer sub.Unsubscribe()
+			subErr = sub.Err()
+		} else {
+			heads = nil
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	if heads == nil {
+		tick = ticker.C
+	}
+
+	w := &txWatch{c: c, hash: txHash}
+	for {
+		receipt, err := w.poll(ctx)
+		if err != nil {
+			return err
+		}
+		if receipt != nil {
+			// the receipt may be of a version with bumped fees
+			tx := w.tx
+			if tx != nil && tx.Hash() != receipt.TxHash {
+				tx = nil
+			}
+			observeFee(name, tx, receipt)
+			err := c.checkReceipt(ctx, tx, receipt)
+			if err == nil && name == "RegisterDID" {
+				c.balance.observeGas(receipt.GasUsed)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			return ErrTxPending
+		case <-heads:
+		case err := <-subErr:
+			c.logger.Warnf("new head subscription: %s, polling for %s", err, txHash)
+			heads, subErr, tick = nil, nil, ticker.C
+		case <-tick:
+		}
+	}
+}
+
+// txWatch is the state of a transaction being waited for
+type txWatch struct {
+	c      *Controller
+	hash   common.Hash
+	tx     *etypes.Transaction
+	misses int
+}
+
+// poll returns the receipt of any version of the transaction once it is
+// confirmed, nil if the transaction has to be waited for
+func (w *txWatch) poll(ctx context.Context) (*etypes.Receipt, error) {
+	backend := w.c.backend
+	hashes := w.c.nonces.Hashes(w.hash)
+
+	receipt, err := w.receipt(ctx, hashes)
+	if err != nil {
+		w.c.logger.Warnf("receipt of %s: %s", w.hash, err)
+		return nil, nil
+	}
+	if receipt != nil {
+		w.misses = 0
+		return w.confirmed(ctx, receipt)
+	}
+
+	for _, hash := range hashes {
+		tx, _, err := backend.TransactionByHash(ctx, hash)
+		if err == nil {
+			w.tx = tx
+			w.misses = 0
+			return nil, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			w.c.logger.Warnf("transaction %s: %s", hash, err)
+			return nil, nil
+		}
+	}
+
+	// neither mined nor pending, another transaction may have taken its nonce
+	if w.tx != nil {
+		from, err := etypes.Sender(etypes.LatestSignerForChainID(w.c.chainID), w.tx)
+		if err == nil {
+			nonce, err := backend.NonceAt(ctx, from, nil)
+			if err == nil && nonce > w.tx.Nonce() {
+				// it may have been mined since the receipt was asked for
+				receipt, err := w.receipt(ctx, w.c.nonces.Hashes(w.hash))
+				if err == nil && receipt != nil {
+					return w.confirmed(ctx, receipt)
+				}
+				return nil, ErrTxReplaced
+			}
+		}
+	}
+
+	w.misses++
+	if w.misses >= droppedAfter {
+		return nil, ErrTxDropped
+	}
+	return nil, nil
+}
+
+// receipt of the first of hashes that is mined
+func (w *txWatch) receipt(ctx context.Context, hashes []common.Hash) (*etypes.Receipt, error) {
+	for _, hash := range hashes {
+		receipt, err := w.c.backend.TransactionReceipt(ctx, hash)
+		if err == nil && receipt != nil {
+			return receipt, nil
+		}
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// confirmed returns receipt if its block is deep enough and still in the
+// chain
+func (w *txWatch) confirmed(ctx context.Context, receipt *etypes.Receipt) (*etypes.Receipt, error) {
+	backend := w.c.backend
+
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		w.c.logger.Warnf("head for %s: %s", w.hash, err)
+		return nil, nil
+	}
+	depth := new(big.Int).Sub(head.Number, receipt.BlockNumber)
+	if depth.Sign() < 0 || depth.Uint64()+1 < w.c.confirmations {
+		return nil, nil
+	}
+
+	header, err := backend.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		w.c.logger.Warnf("block %d of %s: %s", receipt.BlockNumber, w.hash, err)
+		return nil, nil
+	}
+	if header.Hash() != receipt.BlockHash {
+		w.c.logger.Warnf("block %d of %s was reorged, waiting for it again", receipt.BlockNumber, w.hash)
+		return nil, nil
+	}
+
+	return receipt, nil
+}
+
+// checkReceipt fails for a reverted transaction, with the reason if the
+// call reverts again
+func (c *Controller) checkReceipt(ctx context.Context, tx *etypes.Transaction, receipt *etypes.Receipt) error {
+	if receipt.Status == etypes.ReceiptStatusSuccessful {
+		return nil
+	}
+
+	if tx == nil {
+		var err error
+		tx, _, err = c.backend.TransactionByHash(ctx, receipt.TxHash)
+		if err != nil {
+			return &RevertError{Reason: "unknown"}
+		}
+	}
+	if receipt.GasUsed >= tx.Gas() {
+		return &RevertError{Reason: fmt.Sprintf("out of gas, limit %d", tx.Gas())}
+	}
+
+	return &RevertError{Reason: c.revertReason(ctx, tx, receipt.BlockNumber)}
+}
+
+// revertReason calls tx again on the state before its block, or on the
+// latest state if the backend can not call at old blocks
+func (c *Controller) revertReason(ctx context.Context, tx *etypes.Transaction, number *big.Int) string {
+	from, err := etypes.Sender(etypes.LatestSignerForChainID(c.chainID), tx)
+	if err != nil {
+		return "unknown"
+	}
+
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	for _, block := range []*big.Int{new(big.Int).Sub(number, big.NewInt(1)), nil} {
+		_, err = c.backend.CallContract(ctx, msg, block)
+		if reason, ok := decodeRevert(err); ok {
+			return reason
+		}
+	}
+	return "unknown"
+}
+
+func decodeRevert(err error) (string, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return "", false
+	}
+
+	var data []byte
+	switch d := dataErr.ErrorData().(type) {
+	case string:
+		data, err = hexutil.Decode(d)
+		if err != nil {
+			return "", false
+		}
+	case []byte:
+		data = d
+	default:
+		return "", false
+	}
+
+	return unpackRevert(data), true
+}
+
+// unpackRevert decodes Error(string) and the custom errors of the proxy
+// contract
+func unpackRevert(data []byte) string {
+	reason, err := abi.UnpackRevert(data)
+	if err == nil {
+		return reason
+	}
+
+	if len(data) >= 4 {
+		parsed, err := proxy.ProxyMetaData.GetAbi()
+		if err == nil {
+			for _, e := range parsed.Errors {
+				if !bytes.Equal(e.ID[:4], data[:4]) {
+					continue
+				}
+				args, err := e.Inputs.Unpack(data[4:])
+				if err != nil {
+					return e.Name
+				}
+				return fmt.Sprintf("%s%v", e.Name, args)
+			}
+		}
+	}
+
+	return hexutil.Encode(data)
+}
@@ -0,0 +1,168 @@
+package contract
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// revertCode deploys a contract reverting every call with Error("nope")
+var revertCode = hexutil.MustDecode("0x" +
+	// init: copy the 0x70 byte runtime after it and return it
+	"6070600c60003960706000f3" +
+	// runtime: copy the 100 byte revert data after it and revert with it
+	"6064600c60003960646000fd" +
+	"08c379a0" +
+	"0000000000000000000000000000000000000000000000000000000000000020" +
+	"0000000000000000000000000000000000000000000000000000000000000004" +
+	"6e6f706500000000000000000000000000000000000000000000000000000000")
+
+type confirmChain struct {
+	*backends.SimulatedBackend
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	c       *Controller
+}
+
+func newConfirmChain(t *testing.T) *confirmChain {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: balance}}, 30000000)
+	t.Cleanup(func() { sim.Close() })
+
+	chainID := big.NewInt(1337)
+	c := &Controller{
+		backend: sim,
+		logger:  log.NewHelper(log.NewStdLogger(os.Stdout)),
+		chainID: chainID,
+		nonces:  NewNonceManager(&bind.TransactOpts{}),
+	}
+	c.SetConfirmation(1, time.Minute)
+
+	return &confirmChain{SimulatedBackend: sim, key: key, chainID: chainID, c: c}
+}
+
+// send signs and sends a transaction without mining it
+func (cc *confirmChain) send(t *testing.T, to *common.Address, gas uint64, data []byte) *types.Transaction {
+	from := crypto.PubkeyToAddress(cc.key.PublicKey)
+	nonce, err := cc.PendingNonceAt(context.TODO(), from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := types.SignNewTx(cc.key, types.LatestSignerForChainID(cc.chainID), &types.LegacyTx{
+		Nonce:    nonce,
+		To:       to,
+		Gas:      gas,
+		GasPrice: big.NewInt(1e9),
+		Value:    big.NewInt(0),
+		Data:     data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cc.SendTransaction(context.TODO(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestCheckTxConfirmations(t *testing.T) {
+	cc := newConfirmChain(t)
+	cc.c.SetConfirmation(3, time.Minute)
+
+	to := common.HexToAddress(address)
+	tx := cc.send(t, &to, 21000, nil)
+	cc.Commit()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cc.c.CheckTx(context.TODO(), tx.Hash(), "transfer")
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			t.Fatalf("confirmed after %d blocks: %v", i+1, err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		cc.Commit()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not confirmed after 3 blocks")
+	}
+}
+
+func TestCheckTxRevertReason(t *testing.T) {
+	cc := newConfirmChain(t)
+
+	deploy := cc.send(t, nil, 200000, revertCode)
+	cc.Commit()
+	receipt, err := bind.WaitMined(context.TODO(), cc, deploy)
+	if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("deploy: %+v %v", receipt, err)
+	}
+
+	tx := cc.send(t, &receipt.ContractAddress, 100000, nil)
+	cc.Commit()
+
+	err = cc.c.CheckTx(context.TODO(), tx.Hash(), "call")
+	var revert *RevertError
+	if !errors.As(err, &revert) || revert.Reason != "nope" {
+		t.Fatalf("want revert nope, got %v", err)
+	}
+}
+
+func TestCheckTxPendingAndDropped(t *testing.T) {
+	cc := newConfirmChain(t)
+	cc.c.SetConfirmation(1, 200*time.Millisecond)
+	to := common.HexToAddress(address)
+	tx := cc.send(t, &to, 21000, nil)
+
+	err := cc.c.CheckTx(context.TODO(), tx.Hash(), "transfer")
+	if !errors.Is(err, ErrTxPending) {
+		t.Fatalf("want pending, got %v", err)
+	}
+
+	// a hash never seen is dropped after a few new heads
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				cc.Commit()
+			}
+		}
+	}()
+
+	cc.c.SetConfirmation(1, 5*time.Second)
+	err = cc.c.CheckTx(context.TODO(), common.HexToHash("0x01"), "unknown")
+	if !errors.Is(err, ErrTxDropped) {
+		t.Fatalf("want dropped, got %v", err)
+	}
+}
@@ -2,37 +2,62 @@ package contract
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"math/big"
+	"time"
 
 	"github.com/did-server/config"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	etypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/go-kratos/kratos/v2/log"
 	com "github.com/memoio/contractsv2/common"
 	inst "github.com/memoio/contractsv2/go_contracts/instance"
 )
 
+// Backend is the chain a Controller reads and sends transactions to, an
+// ethclient in production and a simulated chain in tests
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	TransactionByHash(ctx context.Context, txHash common.Hash) (tx *etypes.Transaction, isPending bool, err error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
 type Controller struct {
-	instanceAddr  common.Address
-	endpoint      string
-	privateKey    *ecdsa.PrivateKey
-	didTransactor *bind.TransactOpts
-	proxyAddr     common.Address
-	logger        *log.Helper
-	accountAddr   common.Address
+	instanceAddr common.Address
+	backend      Backend
+	signer       Signer
+	nonces       *NonceManager
+	proxyAddr    common.Address
+	logger       *log.Helper
+	accountAddr  common.Address
+	fileAddr     common.Address
+	chainID      *big.Int
+
+	confirmations uint64
+	txTimeout     time.Duration
+	balance       *BalanceWatcher
 }
 
-func NewController(chain string, logger *log.Helper) (*Controller, error) {
-	return NewControllerWithDID(chain, logger)
+func NewController(cfg *config.ChainConfig, signerCfg *config.SignerConfig, logger *log.Helper) (*Controller, error) {
+	signer, err := NewSigner(signerCfg)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	return NewControllerWithDID(cfg, signer, logger)
 }
 
-func NewControllerWithDID(chain string, logger *log.Helper) (*Controller, error) {
-	instanceAddr, endpoint := com.GetInsEndPointByChain(chain)
+func NewControllerWithDID(cfg *config.ChainConfig, signer Signer, logger *log.Helper) (*Controller, error) {
+	instanceAddr, endpoint := com.GetInsEndPointByChain(cfg.Name)
+	endpoints := cfg.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{endpoint}
+	}
 
-	client, err := ethclient.DialContext(context.TODO(), endpoint)
+	client, err := DialClient(context.TODO(), endpoints, logger)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
@@ -41,16 +66,31 @@ func NewControllerWithDID(chain string, logger *log.Helper) (*Controller, error)
 	chainID, err := client.NetworkID(context.Background())
 	if err != nil {
 		logger.Error(err)
-		chainID = big.NewInt(985)
+		chainID = big.NewInt(cfg.ChainID)
 	}
 
-	privateKey, err := crypto.HexToECDSA(config.Privatekey)
+	c, err := NewControllerWithBackend(client, instanceAddr, chainID, nil, signer, logger)
 	if err != nil {
-		logger.Error(err)
+		client.Close()
 		return nil, err
 	}
+	c.SetConfirmation(uint64(cfg.Confirmations), time.Duration(cfg.TxTimeout)*time.Second)
+	c.SetFeeStrategy(NewFeeStrategy(cfg))
+
+	var minBalance *big.Int
+	if cfg.MinBalance != "" {
+		minBalance, _ = new(big.Int).SetString(cfg.MinBalance, 10)
+	}
+	c.balance.SetLimits(minBalance, uint64(cfg.RegistrationGas))
 
-	instanceIns, err := inst.NewInstance(instanceAddr, client)
+	return c, nil
+}
+
+// NewControllerWithBackend reads the contract addresses from the instance
+// contract at instanceAddr on backend. A nil gasPrice follows the fees
+// suggested by the backend.
+func NewControllerWithBackend(backend Backend, instanceAddr common.Address, chainID, gasPrice *big.Int, signer Signer, logger *log.Helper) (*Controller, error) {
+	instanceIns, err := inst.NewInstance(instanceAddr, backend)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
@@ -69,24 +109,84 @@ func NewControllerWithDID(chain string, logger *log.Helper) (*Controller, error)
 		return nil, err
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	fileAddr, err := instanceIns.Instances(&bind.CallOpts{}, com.TypeMfileDid)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
 	}
+
+	auth := newSignerTransactor(signer, chainID)
 	auth.Value = big.NewInt(0) // in wei
-	auth.GasPrice = big.NewInt(200)
+	nonces := NewNonceManager(auth)
+	nonces.SetFeeStrategy(&FeeStrategy{
+		GasPrice:    gasPrice,
+		BumpAfter:   defaultBumpAfter,
+		BumpPercent: defaultBumpPercent,
+	})
 
 	return &Controller{
-		instanceAddr:  instanceAddr,
-		endpoint:      endpoint,
-		privateKey:    privateKey,
-		didTransactor: auth,
-		proxyAddr:     proxyAddr,
-		logger:        logger,
-		accountAddr:   accountAddr,
+		instanceAddr: instanceAddr,
+		backend:      backend,
+		signer:       signer,
+		nonces:       nonces,
+		proxyAddr:    proxyAddr,
+		logger:       logger,
+		accountAddr:  accountAddr,
+		fileAddr:     fileAddr,
+		chainID:      chainID,
+
+		confirmations: defaultConfirmations,
+		txTimeout:     defaultTxTimeout,
+		balance:       newBalanceWatcher(backend, signer.Address(), nonces.FeeStrategy, logger),
 	}, nil
+}
+
+// NewFeeStrategy is the fee strategy configured in cfg
+func NewFeeStrategy(cfg *config.ChainConfig) *FeeStrategy {
+	s := &FeeStrategy{
+		BumpAfter:   time.Duration(cfg.FeeBumpAfter) * time.Second,
+		BumpPercent: cfg.FeeBumpPercent,
+	}
+	if cfg.GasPrice > 0 {
+		s.GasPrice = big.NewInt(cfg.GasPrice)
+	}
+	if cfg.MaxFeeCap > 0 {
+		s.MaxFeeCap = big.NewInt(cfg.MaxFeeCap)
+	}
+	if cfg.MaxTipCap > 0 {
+		s.MaxTipCap = big.NewInt(cfg.MaxTipCap)
+	}
+	return s
+}
 
+// SetFeeStrategy prices the following admin transactions with s
+func (c *Controller) SetFeeStrategy(s *FeeStrategy) {
+	c.nonces.SetFeeStrategy(s)
+}
+
+// RunFeeBumper sends admin transactions pending for too long again with
+// higher fees until ctx is done
+func (c *Controller) RunFeeBumper(ctx context.Context) {
+	ticker := time.NewTicker(feeBumpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := c.nonces.BumpFees(ctx, c.backend, c.logger)
+		if err != nil && ctx.Err() == nil {
+			c.logger.Warnf("bump fees: %s", err)
+		}
+	}
+}
+
+// Balance watches the balance of the admin account
+func (c *Controller) Balance() *BalanceWatcher {
+	return c.balance
 }
 
 func (c *Controller) Proxy() common.Address {
@@ -97,10 +197,46 @@ func (c *Controller) Account() common.Address {
 	return c.accountAddr
 }
 
+func (c *Controller) File() common.Address {
+	return c.fileAddr
+}
+
+func (c *Controller) ChainID() *big.Int {
+	return c.chainID
+}
+
+// Backend is the chain of the controller
+func (c *Controller) Backend() Backend {
+	return c.backend
+}
+
 func (c *Controller) EndPoint() string {
-	return c.endpoint
+	if client, ok := c.backend.(*Client); ok {
+		return client.Endpoint()
+	}
+	return ""
+}
+
+// Health of the rpc connection, always healthy on a backend without checks
+func (c *Controller) Health() ClientHealth {
+	if client, ok := c.backend.(*Client); ok {
+		return client.Health()
+	}
+	return ClientHealth{Healthy: true}
+}
+
+// Close closes the connection of the controller
+func (c *Controller) Close() {
+	if client, ok := c.backend.(*Client); ok {
+		client.Close()
+	}
 }
 
 func (c *Controller) Instance() common.Address {
 	return c.instanceAddr
 }
+
+// Admin is the account paying for admin transactions
+func (c *Controller) Admin() common.Address {
+	return c.signer.Address()
+}
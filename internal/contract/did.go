@@ -3,16 +3,12 @@ package contract
 import (
 	"context"
 	"math/big"
-	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/memoio/did-solidity/go-contracts/proxy"
-	"golang.org/x/xerrors"
 
 	etypes "github.com/ethereum/go-ethereum/core/types"
-	com "github.com/memoio/contractsv2/common"
 	"github.com/memoio/go-did/types"
 )
 
@@ -20,143 +16,130 @@ var DefaultContext = "https://www.w3.org/ns/did/v1"
 
 var (
 	checkTxSleepTime = 6 // 先等待6s（出块时间加1）
-	nextBlockTime    = 5 // 出块时间5s
+	nextBlockTime    = 5 // 出块时间5s，没有新区块订阅时按此轮询
 )
 
-func (c *Controller) RegisterDIDByAdmin(did, method string, address []byte, number *big.Int) error {
-	c.logger.Infof("did %s method %s address %s number %d", did, method, common.Bytes2Hex(address), number.Uint64())
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
-	if err != nil {
-		c.logger.Error(err)
-		return err
-	}
-	defer client.Close()
-
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+func (c *Controller) RegisterDIDByAdmin(ctx context.Context, did, method string, address []byte, number *big.Int) error {
+	txHash, err := c.SubmitRegisterDIDByAdmin(ctx, did, method, address, number)
 	if err != nil {
-		c.logger.Error(err)
 		return err
 	}
 
-	tx, err := proxyIns.CreateDIDByAdmin(c.didTransactor, did, method, address, number)
-	if err != nil {
-		c.logger.Error(err)
-		return err
-	}
-
-	return c.CheckTx(tx.Hash(), "RegisterDID")
+	return c.CheckTx(context.WithoutCancel(ctx), txHash, "RegisterDID")
 }
 
-func (c *Controller) RegisterDID(did, method string, publickey, sig []byte, number *big.Int) error {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+// SubmitRegisterDIDByAdmin sends createDIDByAdmin and returns without waiting for the receipt
+func (c *Controller) SubmitRegisterDIDByAdmin(ctx context.Context, did, method string, address []byte, number *big.Int) (common.Hash, error) {
+	c.logger.Infof("did %s method %s address %s number %d", did, method, common.Bytes2Hex(address), number.Uint64())
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
-	defer client.Close()
 
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.CreateDIDByAdmin(opts, did, method, address, number)
+	})
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
 
-	tx, err := proxyIns.CreateDID(c.didTransactor, did, method, publickey, sig, number)
+	return tx.Hash(), nil
+}
+
+func (c *Controller) RegisterDID(ctx context.Context, did, method string, publickey, sig []byte, number *big.Int) error {
+	txHash, err := c.SubmitRegisterDID(ctx, did, method, publickey, sig, number)
 	if err != nil {
-		c.logger.Error(err)
 		return err
 	}
 
-	return c.CheckTx(tx.Hash(), "RegisterDID")
+	return c.CheckTx(context.WithoutCancel(ctx), txHash, "RegisterDID")
 }
 
-func (c *Controller) RegisterDIDByAddress(did, method string, address, sig []byte, number *big.Int) error {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+// SubmitRegisterDID sends createDID and returns without waiting for the receipt
+func (c *Controller) SubmitRegisterDID(ctx context.Context, did, method string, publickey, sig []byte, number *big.Int) (common.Hash, error) {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
-	defer client.Close()
 
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.CreateDID(opts, did, method, publickey, sig, number)
+	})
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
 
-	tx, err := proxyIns.CreateDID(c.didTransactor, did, method, address, sig, number)
-	if err != nil {
-		c.logger.Error(err)
-		return err
-	}
+	return tx.Hash(), nil
+}
 
-	return c.CheckTx(tx.Hash(), "RegisterDID")
+func (c *Controller) RegisterDIDByAddress(ctx context.Context, did, method string, address, sig []byte, number *big.Int) error {
+	return c.RegisterDID(ctx, did, method, address, sig, number)
 }
 
-func (c *Controller) RegisterDIDByTonAdmin(did, method string, address []byte) error {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+func (c *Controller) RegisterDIDByTonAdmin(ctx context.Context, did, method string, address []byte) error {
+	txHash, err := c.SubmitRegisterDIDByTonAdmin(ctx, did, method, address)
 	if err != nil {
-		c.logger.Error(err)
 		return err
 	}
 
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+	return c.CheckTx(context.WithoutCancel(ctx), txHash, "RegisterDID")
+}
+
+// SubmitRegisterDIDByTonAdmin sends createDIDByAdmin for a ton key and returns without waiting for the receipt
+func (c *Controller) SubmitRegisterDIDByTonAdmin(ctx context.Context, did, method string, address []byte) (common.Hash, error) {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
 
-	tx, err := proxyIns.CreateDIDByAdmin(c.didTransactor, did, method, address, nil)
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.CreateDIDByAdmin(opts, did, method, address, nil)
+	})
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
 
-	return c.CheckTx(tx.Hash(), "RegisterDID")
+	return tx.Hash(), nil
 }
 
-func (c *Controller) DeleteDID(did string, sig []byte) error {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+func (c *Controller) DeleteDID(ctx context.Context, did string, sig []byte) error {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return err
 	}
 
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.DeactivateDID(opts, did, true, sig)
+	})
 	if err != nil {
 		c.logger.Error(err)
 		return err
 	}
 
-	tx, err := proxyIns.DeactivateDID(c.didTransactor, did, true, sig)
-	if err != nil {
-		c.logger.Error(err)
-		return err
-	}
-
-	return c.CheckTx(tx.Hash(), "DeactivateDID")
+	return c.CheckTx(context.WithoutCancel(ctx), tx.Hash(), "DeactivateDID")
 }
 
-func (c *Controller) GetDIDStatus(didStr string) (bool, error) {
+func (c *Controller) GetDIDStatus(ctx context.Context, didStr string) (bool, error) {
 	did, err := types.ParseMemoDID(didStr)
 	if err != nil {
 		c.logger.Error(err)
 		return false, err
 	}
 
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
-	if err != nil {
-		c.logger.Error(err)
-		return false, err
-	}
-
-	accountIns, err := proxy.NewIAccountDid(c.accountAddr, client)
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return false, err
 	}
 
-	dactivated, err := accountIns.IsDeactivated(&bind.CallOpts{}, did.Identifier)
+	dactivated, err := accountIns.IsDeactivated(&bind.CallOpts{Context: ctx}, did.Identifier)
 	if err != nil {
 		c.logger.Error(err)
 		return false, err
@@ -165,42 +148,48 @@ func (c *Controller) GetDIDStatus(didStr string) (bool, error) {
 	return dactivated, nil
 }
 
-func (c *Controller) GetNonce(didI string) (uint64, error) {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+// GetMasterVerification returns method type and key data of the
+// verification method controlling a DID
+func (c *Controller) GetMasterVerification(ctx context.Context, didI string) (string, []byte, error) {
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return 0, err
+		return "", nil, err
 	}
 
-	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, client)
+	pk, err := accountIns.GetMasterVerification(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
-		return 0, err
+		return "", nil, err
 	}
 
-	nonce, err := proxyCaller.GetNonce(&bind.CallOpts{}, didI)
+	return pk.MethodType, pk.PubKeyData, nil
+}
+
+func (c *Controller) GetNonce(ctx context.Context, didI string) (uint64, error) {
+	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
 	}
 
-	return nonce, nil
-}
-
-func (c *Controller) GetNonceMDID(didI string) (uint64, error) {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+	nonce, err := proxyCaller.GetNonce(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
 	}
 
-	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, client)
+	return nonce, nil
+}
+
+func (c *Controller) GetNonceMDID(ctx context.Context, didI string) (uint64, error) {
+	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
 	}
 
-	nonce, err := proxyCaller.GetFileDidNonce(&bind.CallOpts{}, didI)
+	nonce, err := proxyCaller.GetFileDidNonce(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
@@ -209,21 +198,14 @@ func (c *Controller) GetNonceMDID(didI string) (uint64, error) {
 	return nonce, nil
 }
 
-func (c *Controller) GetDIDInfo(didI string) (string, error) {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+func (c *Controller) GetDIDInfo(ctx context.Context, didI string) (string, error) {
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return "", err
 	}
-	defer client.Close()
 
-	accountIns, err := proxy.NewIAccountDid(c.accountAddr, client)
-	if err != nil {
-		c.logger.Error(err)
-		return "", err
-	}
-
-	dactivated, err := accountIns.IsDeactivated(&bind.CallOpts{}, didI)
+	dactivated, err := accountIns.IsDeactivated(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
 		return "", err
@@ -233,13 +215,13 @@ func (c *Controller) GetDIDInfo(didI string) (string, error) {
 		return "", err
 	}
 
-	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, client)
+	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return "", err
 	}
 
-	number, err := proxyCaller.Number(&bind.CallOpts{}, didI)
+	number, err := proxyCaller.Number(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
 		return "", err
@@ -248,20 +230,31 @@ func (c *Controller) GetDIDInfo(didI string) (string, error) {
 	return number.String(), nil
 }
 
-func (c *Controller) GetDIDVerify(didI string) (int, error) {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+// GetDIDNumber returns the number a DID registered with, 0 if it has none
+func (c *Controller) GetDIDNumber(ctx context.Context, didI string) (*big.Int, error) {
+	proxyCaller, err := proxy.NewProxyCaller(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return 0, err
+		return nil, err
 	}
 
-	accountIns, err := proxy.NewIAccountDid(c.accountAddr, client)
+	number, err := proxyCaller.Number(&bind.CallOpts{Context: ctx}, didI)
+	if err != nil {
+		c.logger.Error(err)
+		return nil, err
+	}
+
+	return number, nil
+}
+
+func (c *Controller) GetDIDVerify(ctx context.Context, didI string) (int, error) {
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
 	}
 
-	vlens, err := accountIns.GetVeriLen(&bind.CallOpts{}, didI)
+	vlens, err := accountIns.GetVeriLen(&bind.CallOpts{Context: ctx}, didI)
 	if err != nil {
 		c.logger.Error(err)
 		return 0, err
@@ -273,37 +266,3 @@ func (c *Controller) GetDIDVerify(didI string) (int, error) {
 
 	return 0, nil
 }
-
-func (c *Controller) CheckTx(txHash common.Hash, name string) error {
-	var receipt *etypes.Receipt
-
-	t := checkTxSleepTime
-	for i := 0; i < 10; i++ {
-		time.Sleep(time.Duration(t) * time.Second)
-		receipt = com.GetTransactionReceipt(c.endpoint, txHash)
-		if receipt != nil {
-			break
-		}
-		t = nextBlockTime
-	}
-
-	if receipt == nil {
-		err := xerrors.Errorf("%s: cann't get transaction(%s) receipt, not packaged", name, txHash)
-		c.logger.Error(err)
-		return err
-	}
-
-	// 0 means fail
-	if receipt.Status == 0 {
-		if receipt.GasUsed != receipt.CumulativeGasUsed {
-			err := xerrors.Errorf("%s: transaction(%s) exceed gas limit", name, txHash)
-			c.logger.Error(err)
-			return err
-		}
-
-		err := xerrors.Errorf("%s: transaction(%s) mined but execution failed, please check your tx input", name, txHash)
-		c.logger.Error(err)
-		return err
-	}
-	return nil
-}
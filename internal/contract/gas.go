@@ -0,0 +1,178 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	defaultBumpAfter   = time.Minute
+	defaultBumpPercent = int64(20)
+	// nodes reject a replacement paying less than 10% more
+	minBumpPercent = int64(10)
+	// feeBumpInterval is how often pending transactions are checked
+	feeBumpInterval = 10 * time.Second
+)
+
+type FeeBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*etypes.Header, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+}
+
+// FeeStrategy prices admin transactions. A fixed gas price sends legacy
+// transactions. Otherwise tip and fee cap follow the node's suggestion,
+// or the suggested gas price on chains without a base fee, within the caps.
+type FeeStrategy struct {
+	// GasPrice is fixed, nil to follow the node
+	GasPrice *big.Int
+	// MaxFeeCap caps the fee cap or gas price, nil for no cap
+	MaxFeeCap *big.Int
+	// MaxTipCap caps the tip, nil for no cap
+	MaxTipCap *big.Int
+	// BumpAfter is how long a transaction may be pending before its fees
+	// are bumped, 0 to never bump
+	BumpAfter time.Duration
+	// BumpPercent is how much fees go up on each bump
+	BumpPercent int64
+}
+
+// Fees of one transaction, either GasPrice or GasTipCap and GasFeeCap
+type Fees struct {
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+}
+
+func (f Fees) apply(opts *bind.TransactOpts) {
+	opts.GasPrice = f.GasPrice
+	opts.GasTipCap = f.GasTipCap
+	opts.GasFeeCap = f.GasFeeCap
+}
+
+// Fees for a new transaction
+func (s *FeeStrategy) Fees(ctx context.Context, backend FeeBackend) (Fees, error) {
+	if s.GasPrice != nil {
+		return Fees{GasPrice: s.GasPrice}, nil
+	}
+
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return Fees{}, err
+	}
+
+	if head.BaseFee == nil {
+		gasPrice, err := backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return Fees{}, err
+		}
+		return Fees{GasPrice: capped(gasPrice, s.MaxFeeCap)}, nil
+	}
+
+	tip, err := backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return Fees{}, err
+	}
+	tip = capped(tip, s.MaxTipCap)
+
+	// room for the base fee to double before the transaction is priced out
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	feeCap = capped(feeCap, s.MaxFeeCap)
+	if tip.Cmp(feeCap) > 0 {
+		tip = feeCap
+	}
+
+	return Fees{GasTipCap: tip, GasFeeCap: feeCap}, nil
+}
+
+// bump returns the fees replacing a transaction with old ones, the higher of
+// old fees raised by BumpPercent and new fees. It returns false when the caps
+// leave no room for a replacement nodes would accept.
+func (s *FeeStrategy) bump(ctx context.Context, backend FeeBackend, old *etypes.Transaction) (Fees, bool, error) {
+	if s.GasPrice != nil {
+		return Fees{}, false, nil
+	}
+
+	current, err := s.Fees(ctx, backend)
+	if err != nil {
+		return Fees{}, false, err
+	}
+
+	percent := s.BumpPercent
+	if percent < minBumpPercent {
+		percent = minBumpPercent
+	}
+
+	if old.Type() == etypes.LegacyTxType {
+		gasPrice := maxBig(raise(old.GasPrice(), percent), current.GasPrice, current.GasFeeCap)
+		gasPrice = capped(gasPrice, s.MaxFeeCap)
+		if gasPrice.Cmp(raise(old.GasPrice(), minBumpPercent)) < 0 {
+			return Fees{}, false, nil
+		}
+		return Fees{GasPrice: gasPrice}, true, nil
+	}
+
+	tip := capped(maxBig(raise(old.GasTipCap(), percent), current.GasTipCap, current.GasPrice), s.MaxTipCap)
+	feeCap := capped(maxBig(raise(old.GasFeeCap(), percent), current.GasFeeCap, current.GasPrice), s.MaxFeeCap)
+	if tip.Cmp(feeCap) > 0 {
+		tip = feeCap
+	}
+	if tip.Cmp(raise(old.GasTipCap(), minBumpPercent)) < 0 || feeCap.Cmp(raise(old.GasFeeCap(), minBumpPercent)) < 0 {
+		return Fees{}, false, nil
+	}
+	return Fees{GasTipCap: tip, GasFeeCap: feeCap}, true, nil
+}
+
+// replace is old with new fees, unsigned
+func replace(old *etypes.Transaction, fees Fees) *etypes.Transaction {
+	if fees.GasPrice != nil {
+		return etypes.NewTx(&etypes.LegacyTx{
+			Nonce:    old.Nonce(),
+			GasPrice: fees.GasPrice,
+			Gas:      old.Gas(),
+			To:       old.To(),
+			Value:    old.Value(),
+			Data:     old.Data(),
+		})
+	}
+
+	return etypes.NewTx(&etypes.DynamicFeeTx{
+		ChainID:    old.ChainId(),
+		Nonce:      old.Nonce(),
+		GasTipCap:  fees.GasTipCap,
+		GasFeeCap:  fees.GasFeeCap,
+		Gas:        old.Gas(),
+		To:         old.To(),
+		Value:      old.Value(),
+		Data:       old.Data(),
+		AccessList: old.AccessList(),
+	})
+}
+
+// raise is v increased by percent, rounded up
+func raise(v *big.Int, percent int64) *big.Int {
+	r := new(big.Int).Mul(v, big.NewInt(100+percent))
+	r.Add(r, big.NewInt(99))
+	return r.Div(r, big.NewInt(100))
+}
+
+func capped(v, limit *big.Int) *big.Int {
+	if limit != nil && limit.Sign() > 0 && v.Cmp(limit) > 0 {
+		return new(big.Int).Set(limit)
+	}
+	return v
+}
+
+func maxBig(vs ...*big.Int) *big.Int {
+	var m *big.Int
+	for _, v := range vs {
+		if v != nil && (m == nil || v.Cmp(m) > 0) {
+			m = v
+		}
+	}
+	return new(big.Int).Set(m)
+}
@@ -0,0 +1,101 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type feeNode struct {
+	baseFee  *big.Int
+	tip      *big.Int
+	gasPrice *big.Int
+}
+
+func (n *feeNode) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(1), BaseFee: n.baseFee}, nil
+}
+
+func (n *feeNode) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return n.gasPrice, nil
+}
+
+func (n *feeNode) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return n.tip, nil
+}
+
+func TestFeeStrategy(t *testing.T) {
+	node := &feeNode{baseFee: big.NewInt(100), tip: big.NewInt(10), gasPrice: big.NewInt(50)}
+
+	fees, err := (&FeeStrategy{}).Fees(context.TODO(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.GasPrice != nil || fees.GasTipCap.Int64() != 10 || fees.GasFeeCap.Int64() != 210 {
+		t.Fatalf("suggested fees: %+v", fees)
+	}
+
+	fees, err = (&FeeStrategy{MaxFeeCap: big.NewInt(150), MaxTipCap: big.NewInt(5)}).Fees(context.TODO(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.GasTipCap.Int64() != 5 || fees.GasFeeCap.Int64() != 150 {
+		t.Fatalf("capped fees: %+v", fees)
+	}
+
+	fees, err = (&FeeStrategy{GasPrice: big.NewInt(7)}).Fees(context.TODO(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.GasPrice.Int64() != 7 || fees.GasFeeCap != nil {
+		t.Fatalf("fixed fees: %+v", fees)
+	}
+
+	// no base fee, a legacy chain
+	legacy := &feeNode{gasPrice: big.NewInt(50)}
+	fees, err = (&FeeStrategy{MaxFeeCap: big.NewInt(40)}).Fees(context.TODO(), legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.GasPrice.Int64() != 40 {
+		t.Fatalf("legacy fees: %+v", fees)
+	}
+}
+
+func TestFeeStrategyBump(t *testing.T) {
+	node := &feeNode{baseFee: big.NewInt(100), tip: big.NewInt(10)}
+	to := common.HexToAddress(address)
+	old := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     3,
+		GasTipCap: big.NewInt(100),
+		GasFeeCap: big.NewInt(1000),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(0),
+	})
+
+	s := &FeeStrategy{BumpPercent: 20}
+	fees, ok, err := s.bump(context.TODO(), node, old)
+	if err != nil || !ok {
+		t.Fatalf("bump: %t %v", ok, err)
+	}
+	if fees.GasTipCap.Int64() != 120 || fees.GasFeeCap.Int64() != 1200 {
+		t.Fatalf("bumped fees: %+v", fees)
+	}
+
+	tx := replace(old, fees)
+	if tx.Nonce() != old.Nonce() || tx.Gas() != old.Gas() || tx.GasFeeCap().Int64() != 1200 {
+		t.Fatalf("replacement: %+v", tx)
+	}
+
+	// the cap leaves no room for a 10% bump
+	s.MaxFeeCap = big.NewInt(1050)
+	_, ok, err = s.bump(context.TODO(), node, old)
+	if err != nil || ok {
+		t.Fatalf("bump over the cap: %t %v", ok, err)
+	}
+}
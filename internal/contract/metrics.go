@@ -0,0 +1,52 @@
+package contract
+
+import (
+	"math/big"
+
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	txSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "did_tx_sent_total",
+		Help: "Admin transactions sent, by kind new or bump.",
+	}, []string{"kind"})
+
+	txFee = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "did_tx_fee_ether",
+		Help:    "Fee paid per mined admin transaction in ether, by operation.",
+		Buckets: prometheus.ExponentialBuckets(1e-6, 4, 12),
+	}, []string{"name"})
+
+	txFeeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "did_tx_fee_ether_total",
+		Help: "Fees paid by admin transactions in ether, by operation.",
+	}, []string{"name"})
+
+	txGasUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "did_tx_gas_used_total",
+		Help: "Gas used by admin transactions, by operation.",
+	}, []string{"name"})
+)
+
+var weiPerEther = new(big.Float).SetInt(big.NewInt(1e18))
+
+// observeFee records what the mined tx cost, reverted or not
+func observeFee(name string, tx *etypes.Transaction, receipt *etypes.Receipt) {
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil && tx != nil {
+		gasPrice = tx.GasPrice()
+	}
+	if gasPrice == nil {
+		return
+	}
+
+	fee := new(big.Float).SetInt(new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipt.GasUsed)))
+	ether, _ := new(big.Float).Quo(fee, weiPerEther).Float64()
+
+	txFee.WithLabelValues(name).Observe(ether)
+	txFeeTotal.WithLabelValues(name).Add(ether)
+	txGasUsed.WithLabelValues(name).Add(float64(receipt.GasUsed))
+}
@@ -4,28 +4,95 @@ import (
 	"context"
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	etypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/memoio/did-solidity/go-contracts/proxy"
 )
 
-func (c *Controller) RegisterMfile(mfileI, didI string, price *big.Int, sig []byte) error {
-	client, err := ethclient.DialContext(context.TODO(), c.endpoint)
+func (c *Controller) RegisterMfile(ctx context.Context, mfileI, didI string, price *big.Int, keywords []string, sig []byte) error {
+	txHash, err := c.SubmitRegisterMfile(ctx, mfileI, didI, price, keywords, sig)
 	if err != nil {
-		c.logger.Error(err)
 		return err
 	}
 
-	proxyIns, err := proxy.NewProxy(c.proxyAddr, client)
+	return c.CheckTx(context.WithoutCancel(ctx), txHash, "RegisterMfileDid")
+}
+
+// SubmitRegisterMfile sends registerMfileDid and returns without waiting for the receipt
+func (c *Controller) SubmitRegisterMfile(ctx context.Context, mfileI, didI string, price *big.Int, keywords []string, sig []byte) (common.Hash, error) {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
 	}
 
-	tx, err := proxyIns.RegisterMfileDid(c.didTransactor, mfileI, "cid", 0, didI, price, nil, sig)
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.RegisterMfileDid(opts, mfileI, "cid", 0, didI, price, keywords, sig)
+	})
 	if err != nil {
 		c.logger.Error(err)
-		return err
+		return common.Hash{}, err
+	}
+
+	return tx.Hash(), nil
+}
+
+// GetMfileController returns the controller DID of a mfile DID and whether it
+// is deactivated, the controller is empty if the mfile DID is not registered
+func (c *Controller) GetMfileController(ctx context.Context, mfileI string) (string, bool, error) {
+	fileIns, err := proxy.NewIFileDid(c.fileAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return "", false, err
+	}
+
+	controller, err := fileIns.GetController(&bind.CallOpts{Context: ctx}, mfileI)
+	if err != nil {
+		c.logger.Error(err)
+		return "", false, err
+	}
+
+	deactivated, err := fileIns.Deactivated(&bind.CallOpts{Context: ctx}, mfileI)
+	if err != nil {
+		c.logger.Error(err)
+		return "", false, err
+	}
+
+	return controller, deactivated, nil
+}
+
+// GetMfilePrice returns the price of reading a mfile DID, 0 for free files
+func (c *Controller) GetMfilePrice(ctx context.Context, mfileI string) (*big.Int, error) {
+	fileIns, err := proxy.NewIFileDid(c.fileAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return nil, err
+	}
+
+	price, err := fileIns.GetPrice(&bind.CallOpts{Context: ctx}, mfileI)
+	if err != nil {
+		c.logger.Error(err)
+		return nil, err
+	}
+
+	return price, nil
+}
+
+// CanReadMfile reports whether didI bought or was granted read access to a
+// mfile DID
+func (c *Controller) CanReadMfile(ctx context.Context, mfileI, didI string) (bool, error) {
+	fileIns, err := proxy.NewIFileDid(c.fileAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return false, err
+	}
+
+	read, err := fileIns.Read(&bind.CallOpts{Context: ctx}, mfileI, didI)
+	if err != nil {
+		c.logger.Error(err)
+		return false, err
 	}
 
-	return c.CheckTx(tx.Hash(), "RegisterDID")
+	return read > 0, nil
 }
@@ -0,0 +1,249 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+var maxNonceRetry = 3
+
+// errors returned by nodes when the nonce we used is already taken
+var nonceErrors = []string{
+	"nonce too low",
+	"replacement transaction underpriced",
+	"invalid transaction nonce",
+}
+
+type NonceBackend interface {
+	FeeBackend
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// NonceManager hands out nonces for one transactor locally, so that many
+// transactions from the same account can be pending at the same time. It
+// keeps the transactions it sent by nonce until they are mined, so that
+// stuck ones can be sent again with higher fees.
+type NonceManager struct {
+	lock   sync.Mutex
+	opts   *bind.TransactOpts
+	fees   *FeeStrategy
+	next   uint64
+	synced bool
+
+	pending map[uint64]*pendingTx
+	nonceOf map[common.Hash]uint64
+}
+
+// pendingTx is every version sent with one nonce, the last one has the
+// highest fees
+type pendingTx struct {
+	hashes []common.Hash
+	tx     *etypes.Transaction
+	sentAt time.Time
+}
+
+func NewNonceManager(opts *bind.TransactOpts) *NonceManager {
+	return &NonceManager{
+		opts:    opts,
+		pending: make(map[uint64]*pendingTx),
+		nonceOf: make(map[common.Hash]uint64),
+	}
+}
+
+// SetFeeStrategy prices the following transactions with s, nil leaves it to
+// the contract bindings
+func (n *NonceManager) SetFeeStrategy(s *FeeStrategy) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.fees = s
+}
+
+func (n *NonceManager) From() common.Address {
+	return n.opts.From
+}
+
+// Transact signs and sends one transaction with the next nonce. Sending is
+// serialized, waiting for the receipt is left to the caller. When the node
+// rejects the nonce it is synced again with PendingNonceAt and retried.
+func (n *NonceManager) Transact(ctx context.Context, backend NonceBackend, send func(opts *bind.TransactOpts) (*etypes.Transaction, error)) (*etypes.Transaction, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	var err error
+	for i := 0; i < maxNonceRetry; i++ {
+		if !n.synced {
+			n.next, err = backend.PendingNonceAt(ctx, n.opts.From)
+			if err != nil {
+				return nil, err
+			}
+			n.synced = true
+		}
+
+		opts := *n.opts
+		opts.Context = ctx
+		opts.Nonce = new(big.Int).SetUint64(n.next)
+		if n.fees != nil {
+			var fees Fees
+			fees, err = n.fees.Fees(ctx, backend)
+			if err != nil {
+				return nil, err
+			}
+			fees.apply(&opts)
+		}
+
+		var tx *etypes.Transaction
+		tx, err = send(&opts)
+		if err == nil {
+			n.track(tx)
+			n.next++
+			txSent.WithLabelValues("new").Inc()
+			return tx, nil
+		}
+
+		// the tx may or may not have reached the node, ask again next time
+		n.synced = false
+		if !isNonceError(err) {
+			return nil, err
+		}
+	}
+
+	return nil, xerrors.Errorf("send transaction after %d nonce retries: %w", maxNonceRetry, err)
+}
+
+// Reset drops the local nonce, the next transaction syncs with the node
+func (n *NonceManager) Reset() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.synced = false
+}
+
+// FeeStrategy prices the transactions, the bindings' default if none was set
+func (n *NonceManager) FeeStrategy() *FeeStrategy {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.fees == nil {
+		return &FeeStrategy{}
+	}
+	return n.fees
+}
+
+// track is called with the lock held
+func (n *NonceManager) track(tx *etypes.Transaction) {
+	p, ok := n.pending[tx.Nonce()]
+	if !ok {
+		p = &pendingTx{}
+		n.pending[tx.Nonce()] = p
+	}
+	p.hashes = append(p.hashes, tx.Hash())
+	p.tx = tx
+	p.sentAt = time.Now()
+	n.nonceOf[tx.Hash()] = tx.Nonce()
+}
+
+// Hashes are the versions of the transaction with hash, which is returned
+// alone if it was not sent by the manager or is mined already
+func (n *NonceManager) Hashes(hash common.Hash) []common.Hash {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	nonce, ok := n.nonceOf[hash]
+	if !ok {
+		return []common.Hash{hash}
+	}
+	return append([]common.Hash(nil), n.pending[nonce].hashes...)
+}
+
+// BumpFees forgets transactions whose nonce is mined, and sends the ones
+// pending longer than the strategy allows again with higher fees. The lock
+// is only held to read and update the pending transactions, not across
+// rpc calls and signing, so that Transact is not held up by a slow node.
+func (n *NonceManager) BumpFees(ctx context.Context, backend Backend, logger *log.Helper) error {
+	mined, err := backend.NonceAt(ctx, n.opts.From, nil)
+	if err != nil {
+		return err
+	}
+
+	fees, stuck := n.stuck(mined)
+	for _, tx := range stuck {
+		bumped, ok, err := fees.bump(ctx, backend, tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logger.Warnf("transaction %s with nonce %d is stuck at the fee cap", tx.Hash(), tx.Nonce())
+			continue
+		}
+
+		next, err := n.opts.Signer(n.opts.From, replace(tx, bumped))
+		if err != nil {
+			return err
+		}
+		err = backend.SendTransaction(ctx, next)
+		if err != nil {
+			// mined meanwhile or already replaced, the next round tells
+			logger.Warnf("bump transaction %s with nonce %d: %s", tx.Hash(), tx.Nonce(), err)
+			continue
+		}
+
+		logger.Infof("bumped transaction %s with nonce %d to %s", tx.Hash(), tx.Nonce(), next.Hash())
+		// a nonce mined meanwhile was forgotten, it is not tracked again
+		n.lock.Lock()
+		if _, ok := n.pending[tx.Nonce()]; ok {
+			n.track(next)
+		}
+		n.lock.Unlock()
+		txSent.WithLabelValues("bump").Inc()
+	}
+
+	return nil
+}
+
+// stuck forgets the transactions with a nonce below mined and returns the
+// fee strategy with the last version of the ones due for a bump
+func (n *NonceManager) stuck(mined uint64) (*FeeStrategy, []*etypes.Transaction) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for nonce, p := range n.pending {
+		if nonce < mined {
+			for _, hash := range p.hashes {
+				delete(n.nonceOf, hash)
+			}
+			delete(n.pending, nonce)
+		}
+	}
+
+	if n.fees == nil || n.fees.BumpAfter <= 0 {
+		return nil, nil
+	}
+
+	var stuck []*etypes.Transaction
+	for _, p := range n.pending {
+		if time.Since(p.sentAt) >= n.fees.BumpAfter {
+			stuck = append(stuck, p.tx)
+		}
+	}
+	return n.fees, stuck
+}
+
+func isNonceError(err error) bool {
+	msg := err.Error()
+	for _, s := range nonceErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func newSimulatedTransactor(t *testing.T) (*backends.SimulatedBackend, *bind.TransactOpts) {
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := bind.NewKeyedTransactorWithChainID(sk, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{auth.From: {Balance: balance}}, 10000000)
+	t.Cleanup(func() { backend.Close() })
+
+	return backend, auth
+}
+
+func sendValue(backend *backends.SimulatedBackend, to common.Address) func(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		gasPrice, err := backend.SuggestGasPrice(opts.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		tx := types.NewTransaction(opts.Nonce.Uint64(), to, big.NewInt(1), 21000, gasPrice, nil)
+		signedTx, err := opts.Signer(opts.From, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		return signedTx, backend.SendTransaction(opts.Context, signedTx)
+	}
+}
+
+func TestNonceManagerConcurrent(t *testing.T) {
+	backend, auth := newSimulatedTransactor(t)
+	nm := NewNonceManager(auth)
+	to := common.HexToAddress(address)
+
+	count := 20
+	txs := make([]*types.Transaction, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tx, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			txs[i] = tx
+		}(i)
+	}
+	wg.Wait()
+	backend.Commit()
+
+	for _, tx := range txs {
+		if tx == nil {
+			t.FailNow()
+		}
+		receipt, err := backend.TransactionReceipt(context.TODO(), tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("tx %s failed", tx.Hash())
+		}
+	}
+
+	nonce, err := backend.NonceAt(context.TODO(), auth.From, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != uint64(count) {
+		t.Fatalf("nonce is %d, want %d", nonce, count)
+	}
+}
+
+func TestNonceManagerResync(t *testing.T) {
+	backend, auth := newSimulatedTransactor(t)
+	nm := NewNonceManager(auth)
+	to := common.HexToAddress(address)
+
+	_, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another sender uses the same account behind the manager's back
+	other := *auth
+	other.Context = context.TODO()
+	other.Nonce = big.NewInt(1)
+	_, err = sendValue(backend, to)(&other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce() != 2 {
+		t.Fatalf("nonce is %d, want 2", tx.Nonce())
+	}
+	backend.Commit()
+}
+
+// replacingBackend accepts replacements the simulated backend rejects
+type replacingBackend struct {
+	*backends.SimulatedBackend
+	sent []*types.Transaction
+}
+
+func (b *replacingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+func TestNonceManagerBumpFees(t *testing.T) {
+	backend, auth := newSimulatedTransactor(t)
+	nm := NewNonceManager(auth)
+	nm.SetFeeStrategy(&FeeStrategy{BumpAfter: time.Nanosecond, BumpPercent: 20})
+	to := common.HexToAddress(address)
+	logger := log.NewHelper(log.NewStdLogger(os.Stdout))
+
+	tx, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replacing := &replacingBackend{SimulatedBackend: backend}
+	err = nm.BumpFees(context.TODO(), replacing, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replacing.sent) != 1 {
+		t.Fatalf("sent %d replacements, want 1", len(replacing.sent))
+	}
+	bumped := replacing.sent[0]
+	if bumped.Nonce() != tx.Nonce() || bumped.GasPrice().Cmp(tx.GasPrice()) <= 0 {
+		t.Fatalf("replacement nonce %d gas price %s, original %d %s", bumped.Nonce(), bumped.GasPrice(), tx.Nonce(), tx.GasPrice())
+	}
+
+	hashes := nm.Hashes(tx.Hash())
+	if len(hashes) != 2 || hashes[1] != bumped.Hash() {
+		t.Fatalf("hashes %v", hashes)
+	}
+
+	// once the nonce is mined its transactions are forgotten
+	backend.Commit()
+	err = nm.BumpFees(context.TODO(), backend, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes := nm.Hashes(tx.Hash()); len(hashes) != 1 {
+		t.Fatalf("hashes after mined %v", hashes)
+	}
+}
+
+// blockingBackend holds replacements until release is closed
+type blockingBackend struct {
+	*backends.SimulatedBackend
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	close(b.sending)
+	<-b.release
+	return nil
+}
+
+func TestNonceManagerBumpFeesUnlocked(t *testing.T) {
+	backend, auth := newSimulatedTransactor(t)
+	nm := NewNonceManager(auth)
+	nm.SetFeeStrategy(&FeeStrategy{BumpAfter: time.Nanosecond, BumpPercent: 20})
+	to := common.HexToAddress(address)
+	logger := log.NewHelper(log.NewStdLogger(os.Stdout))
+
+	_, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocking := &blockingBackend{SimulatedBackend: backend, sending: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- nm.BumpFees(context.TODO(), blocking, logger)
+	}()
+
+	// new transactions go out while a bump waits for the node
+	<-blocking.sending
+	tx, err := nm.Transact(context.TODO(), backend, sendValue(backend, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce() != 1 {
+		t.Fatalf("nonce %d, want 1", tx.Nonce())
+	}
+
+	close(blocking.release)
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
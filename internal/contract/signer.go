@@ -0,0 +1,199 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/did-server/config"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/xerrors"
+)
+
+var remoteSignTimeout = 30 * time.Second
+
+// Signer signs the transactions of the admin account
+type Signer interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *etypes.Transaction, chainID *big.Int) (*etypes.Transaction, error)
+}
+
+// NewSigner builds the signer selected by cfg.Type
+func NewSigner(cfg *config.SignerConfig) (Signer, error) {
+	switch cfg.Type {
+	case config.SignerKey:
+		return NewKeySigner(cfg.Key)
+	case config.SignerKeystore:
+		password := cfg.Password
+		if cfg.PasswordFile != "" {
+			data, err := os.ReadFile(cfg.PasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			password = strings.TrimRight(string(data), "\r\n")
+		}
+		return NewKeystoreSigner(cfg.Keystore, password)
+	case config.SignerRemote:
+		return NewRemoteSigner(cfg.RemoteURL, cfg.RemoteMethod, common.HexToAddress(cfg.Address))
+	default:
+		return nil, xerrors.Errorf("unknown signer type %q", cfg.Type)
+	}
+}
+
+// keySigner holds the private key in memory
+type keySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewKeySigner uses a hex encoded private key, meant for development
+func NewKeySigner(hexKey string) (Signer, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &keySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}, nil
+}
+
+// NewKeystoreSigner decrypts a go-ethereum keystore json file
+func NewKeystoreSigner(path, password string) (Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.DecryptKey(data, password)
+	if err != nil {
+		return nil, xerrors.Errorf("decrypt keystore %s: %w", path, err)
+	}
+
+	return &keySigner{key: key.PrivateKey, address: key.Address}, nil
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *keySigner) SignTx(ctx context.Context, tx *etypes.Transaction, chainID *big.Int) (*etypes.Transaction, error) {
+	return etypes.SignTx(tx, etypes.LatestSignerForChainID(chainID), s.key)
+}
+
+// remoteSigner asks an external signer such as Clef over json-rpc, the key
+// never enters this process
+type remoteSigner struct {
+	url     string
+	method  string
+	address common.Address
+}
+
+type remoteTxArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big     `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId"`
+}
+
+type remoteSignResult struct {
+	Raw hexutil.Bytes       `json:"raw"`
+	Tx  *etypes.Transaction `json:"tx"`
+}
+
+// NewRemoteSigner signs with method, eth_signTransaction by default or
+// account_signTransaction for Clef, at url for the given account
+func NewRemoteSigner(url, method string, address common.Address) (Signer, error) {
+	if url == "" {
+		return nil, xerrors.New("remote signer url is empty")
+	}
+	if method == "" {
+		method = "eth_signTransaction"
+	}
+
+	return &remoteSigner{url: url, method: method, address: address}, nil
+}
+
+func (s *remoteSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *remoteSigner) SignTx(ctx context.Context, tx *etypes.Transaction, chainID *big.Int) (*etypes.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteSignTimeout)
+	defer cancel()
+
+	client, err := rpc.DialContext(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	args := remoteTxArgs{
+		From:    s.address,
+		To:      tx.To(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.Type() == etypes.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	var res remoteSignResult
+	err = client.CallContext(ctx, &res, s.method, args)
+	if err != nil {
+		return nil, xerrors.Errorf("remote signer %s: %w", s.method, err)
+	}
+
+	signed := new(etypes.Transaction)
+	err = signed.UnmarshalBinary(res.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// do not broadcast anything other than what was asked for
+	sender, err := etypes.Sender(etypes.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if sender != s.address || signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() ||
+		signed.Value().Cmp(tx.Value()) != 0 || !bytes.Equal(signed.Data(), tx.Data()) ||
+		(signed.To() == nil) != (tx.To() == nil) || (tx.To() != nil && *signed.To() != *tx.To()) {
+		return nil, xerrors.Errorf("remote signer returned a different transaction %s", signed.Hash())
+	}
+
+	return signed, nil
+}
+
+// newSignerTransactor adapts a Signer to abigen bindings
+func newSignerTransactor(signer Signer, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: signer.Address(),
+		Signer: func(address common.Address, tx *etypes.Transaction) (*etypes.Transaction, error) {
+			if address != signer.Address() {
+				return nil, bind.ErrNotAuthorized
+			}
+			return signer.SignTx(context.Background(), tx, chainID)
+		},
+		Context: context.Background(),
+	}
+}
@@ -0,0 +1,139 @@
+package contract
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/google/uuid"
+)
+
+// stubSigner answers eth_signTransaction like a remote signer would
+type stubSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *stubSigner) SignTransaction(args remoteTxArgs) (*remoteSignResult, error) {
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(args.Nonce),
+		To:       args.To,
+		Gas:      uint64(args.Gas),
+		GasPrice: args.GasPrice.ToInt(),
+		Value:    args.Value.ToInt(),
+		Data:     args.Data,
+	})
+
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(args.ChainID.ToInt()), s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteSignResult{Raw: raw, Tx: signed}, nil
+}
+
+func testTx() *types.Transaction {
+	to := common.HexToAddress(address)
+	return types.NewTransaction(7, to, big.NewInt(1), 21000, big.NewInt(200), []byte("did"))
+}
+
+func checkSender(t *testing.T, signer Signer, tx *types.Transaction, chainID *big.Int) {
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != signer.Address() {
+		t.Fatalf("signed by %s, want %s", sender, signer.Address())
+	}
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	sk, err := crypto.HexToECDSA(privatekey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &keystore.Key{Id: uuid.New(), Address: crypto.PubkeyToAddress(sk.PublicKey), PrivateKey: sk}
+	data, err := keystore.EncryptKey(key, "secret", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "admin.json")
+	passFile := filepath.Join(dir, "password")
+	os.WriteFile(keyFile, data, 0600)
+	os.WriteFile(passFile, []byte("secret\n"), 0600)
+
+	signer, err := NewSigner(&config.SignerConfig{Type: config.SignerKeystore, Keystore: keyFile, PasswordFile: passFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address().Hex() != address {
+		t.Fatalf("keystore address %s, want %s", signer.Address(), address)
+	}
+
+	chainID := big.NewInt(985)
+	tx, err := signer.SignTx(context.TODO(), testTx(), chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSender(t, signer, tx, chainID)
+
+	_, err = NewKeystoreSigner(keyFile, "wrong")
+	if err == nil {
+		t.Fatal("keystore decrypted with a wrong password")
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	sk, err := crypto.HexToECDSA(sk1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	err = server.RegisterName("eth", &stubSigner{key: sk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	signer, err := NewRemoteSigner(ts.URL, "", crypto.PubkeyToAddress(sk.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chainID := big.NewInt(985)
+	tx, err := signer.SignTx(context.TODO(), testTx(), chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSender(t, signer, tx, chainID)
+
+	// a signer holding another key must be rejected
+	other, err := NewRemoteSigner(ts.URL, "", common.HexToAddress(address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.SignTx(context.TODO(), testTx(), chainID)
+	if err == nil {
+		t.Fatal("accepted a transaction signed by another account")
+	}
+}
@@ -0,0 +1,151 @@
+// Package simchain runs the DID contracts on go-ethereum's simulated backend,
+// so that the contract and did packages can be tested without a node.
+package simchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/did-server/internal/contract"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-kratos/kratos/v2/log"
+	com "github.com/memoio/contractsv2/common"
+	inst "github.com/memoio/contractsv2/go_contracts/instance"
+	"github.com/memoio/did-solidity/go-contracts/accountdid"
+	"github.com/memoio/did-solidity/go-contracts/filedid"
+	"github.com/memoio/did-solidity/go-contracts/proxy"
+	"golang.org/x/xerrors"
+)
+
+// ChainID of the simulated backend
+var ChainID = big.NewInt(1337)
+
+var gasLimit uint64 = 30000000
+
+// Chain is a simulated chain with the instance, account DID, mfile DID and
+// proxy contracts deployed by a funded admin. Every transaction is mined as
+// soon as it is sent, as a node with instant blocks would.
+type Chain struct {
+	*backends.SimulatedBackend
+
+	Admin    *ecdsa.PrivateKey
+	Instance common.Address
+	Proxy    common.Address
+	Account  common.Address
+	File     common.Address
+}
+
+// New deploys the contracts on a new simulated chain, funding admin and
+// accounts with 100 ether each
+func New(accounts ...common.Address) (*Chain, error) {
+	admin, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	balance := new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	alloc := core.GenesisAlloc{crypto.PubkeyToAddress(admin.PublicKey): {Balance: balance}}
+	for _, account := range accounts {
+		alloc[account] = core.GenesisAccount{Balance: balance}
+	}
+
+	c := &Chain{
+		SimulatedBackend: backends.NewSimulatedBackend(alloc, gasLimit),
+		Admin:            admin,
+	}
+
+	err = c.deploy()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Chain) deploy() error {
+	auth, err := bind.NewKeyedTransactorWithChainID(c.Admin, ChainID)
+	if err != nil {
+		return err
+	}
+
+	instanceAddr, tx, instanceIns, err := inst.DeployInstance(auth, c, auth.From)
+	if err = c.check(tx, err, "deploy instance"); err != nil {
+		return err
+	}
+	c.Instance = instanceAddr
+
+	accountAddr, tx, _, err := accountdid.DeployAccountDid(auth, c, instanceAddr)
+	if err = c.check(tx, err, "deploy account did"); err != nil {
+		return err
+	}
+	c.Account = accountAddr
+
+	fileAddr, tx, _, err := filedid.DeployFileDid(auth, c, instanceAddr)
+	if err = c.check(tx, err, "deploy file did"); err != nil {
+		return err
+	}
+	c.File = fileAddr
+
+	proxyAddr, tx, _, err := proxy.DeployProxy(auth, c, instanceAddr)
+	if err = c.check(tx, err, "deploy proxy"); err != nil {
+		return err
+	}
+	c.Proxy = proxyAddr
+
+	for typ, addr := range map[uint8]common.Address{
+		com.TypeAccountDid: accountAddr,
+		com.TypeMfileDid:   fileAddr,
+		com.TypeDidProxy:   proxyAddr,
+	} {
+		tx, err := instanceIns.SetIns(auth, typ, addr)
+		if err = c.check(tx, err, "set instance"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check fails unless tx was sent and executed successfully
+func (c *Chain) check(tx *types.Transaction, err error, name string) error {
+	if err != nil {
+		return xerrors.Errorf("%s: %w", name, err)
+	}
+
+	receipt, err := c.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return xerrors.Errorf("%s: %w", name, err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return xerrors.Errorf("%s: transaction %s failed", name, tx.Hash())
+	}
+	return nil
+}
+
+// SendTransaction sends tx and mines it into a new block
+func (c *Chain) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	err := c.SimulatedBackend.SendTransaction(ctx, tx)
+	if err != nil {
+		return err
+	}
+	c.Commit()
+	return nil
+}
+
+// Controller is a controller on the chain signing with the admin key
+func (c *Chain) Controller(logger *log.Helper) (*contract.Controller, error) {
+	signer, err := contract.NewKeySigner(hex.EncodeToString(crypto.FromECDSA(c.Admin)))
+	if err != nil {
+		return nil, err
+	}
+
+	return contract.NewControllerWithBackend(c, c.Instance, ChainID, nil, signer, logger)
+}
@@ -0,0 +1,129 @@
+package contract
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/memoio/did-solidity/go-contracts/proxy"
+)
+
+// AddVerificationMethod appends a verification method to a DID, sig is made
+// by the DID controller
+func (c *Controller) AddVerificationMethod(ctx context.Context, didI, methodType, controller string, pubKeyData, sig []byte) error {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.AddVerificationMethod(opts, didI, methodType, controller, pubKeyData, sig)
+	})
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	return c.CheckTx(context.WithoutCancel(ctx), tx.Hash(), "AddVerificationMethod")
+}
+
+// ChangeVerificationMethod replaces the key of the verification method at index
+func (c *Controller) ChangeVerificationMethod(ctx context.Context, didI string, index uint64, methodType string, pubKeyData, sig []byte) error {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.UpdateVerificationMethod(opts, didI, new(big.Int).SetUint64(index), methodType, pubKeyData, sig)
+	})
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	return c.CheckTx(context.WithoutCancel(ctx), tx.Hash(), "UpdateVerificationMethod")
+}
+
+// DeactivateVerificationMethod revokes, or with deactivate false restores,
+// the verification method at index
+func (c *Controller) DeactivateVerificationMethod(ctx context.Context, didI string, index uint64, deactivate bool, sig []byte) error {
+	proxyIns, err := proxy.NewProxy(c.proxyAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	tx, err := c.nonces.Transact(ctx, c.backend, func(opts *bind.TransactOpts) (*etypes.Transaction, error) {
+		return proxyIns.DeactivateVerificationMethod(opts, didI, new(big.Int).SetUint64(index), deactivate, sig)
+	})
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	return c.CheckTx(context.WithoutCancel(ctx), tx.Hash(), "DeactivateVerificationMethod")
+}
+
+// GetVerificationCount returns how many verification methods a DID has
+func (c *Controller) GetVerificationCount(ctx context.Context, didI string) (uint64, error) {
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return 0, err
+	}
+
+	vlens, err := accountIns.GetVeriLen(&bind.CallOpts{Context: ctx}, didI)
+	if err != nil {
+		c.logger.Error(err)
+		return 0, err
+	}
+
+	return vlens.Uint64(), nil
+}
+
+// VerificationMethod is a verification method as stored in the account DID
+// contract
+type VerificationMethod struct {
+	MethodType  string
+	Controller  string
+	PubKeyData  []byte
+	Deactivated bool
+}
+
+// GetVerificationMethods returns all verification methods of a DID in index
+// order, revoked ones included
+func (c *Controller) GetVerificationMethods(ctx context.Context, didI string) ([]VerificationMethod, error) {
+	accountIns, err := proxy.NewIAccountDid(c.accountAddr, c.backend)
+	if err != nil {
+		c.logger.Error(err)
+		return nil, err
+	}
+
+	vlens, err := accountIns.GetVeriLen(&bind.CallOpts{Context: ctx}, didI)
+	if err != nil {
+		c.logger.Error(err)
+		return nil, err
+	}
+
+	methods := make([]VerificationMethod, 0, vlens.Uint64())
+	for i := uint64(0); i < vlens.Uint64(); i++ {
+		pk, err := accountIns.GetVeri(&bind.CallOpts{Context: ctx}, didI, new(big.Int).SetUint64(i))
+		if err != nil {
+			c.logger.Error(err)
+			return nil, err
+		}
+
+		methods = append(methods, VerificationMethod{
+			MethodType:  pk.MethodType,
+			Controller:  pk.Controller,
+			PubKeyData:  pk.PubKeyData,
+			Deactivated: pk.Deactivated,
+		})
+	}
+
+	return methods, nil
+}
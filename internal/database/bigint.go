@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	"github.com/did-server/config"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// BigInt is a big.Int column, numeric on postgres and a decimal string on
+// sqlite, whose numbers lose precision above 2^63. A nil Int is 0.
+type BigInt struct {
+	*big.Int
+}
+
+func NewBigInt(v *big.Int) BigInt {
+	return BigInt{Int: v}
+}
+
+// Value stores the decimal string
+func (b BigInt) Value() (driver.Value, error) {
+	if b.Int == nil {
+		return "0", nil
+	}
+	return b.Int.String(), nil
+}
+
+// Scan reads a decimal string, or an integer of drivers returning one
+func (b *BigInt) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		b.Int = big.NewInt(0)
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		b.Int = big.NewInt(v)
+		return nil
+	default:
+		return xerrors.Errorf("scan %T into BigInt", src)
+	}
+
+	if s == "" {
+		b.Int = big.NewInt(0)
+		return nil
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return xerrors.Errorf("scan %q into BigInt: not a decimal integer", s)
+	}
+	b.Int = v
+	return nil
+}
+
+func (BigInt) GormDataType() string {
+	return "bigint"
+}
+
+// GormDBDataType holds the 78 digits of a uint256
+func (BigInt) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == config.DriverPostgres {
+		return "numeric(78,0)"
+	}
+	return "text"
+}
+
+// MarshalJSON writes a decimal string, json numbers lose precision in
+// most clients
+func (b BigInt) MarshalJSON() ([]byte, error) {
+	v, _ := b.Value()
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON reads a decimal string or number
+func (b *BigInt) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return b.Scan(nil)
+	}
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		s = string(data)
+	}
+	return b.Scan(s)
+}
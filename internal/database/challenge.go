@@ -0,0 +1,57 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Challenge is a message issued for a client to sign, it can be used once.
+// It is stored so that any replica can check a challenge another issued.
+type Challenge struct {
+	Nonce     string `gorm:"primarykey"`
+	Message   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// AddChallenge stores c and drops challenges that expired unused
+func (d *DataBase) AddChallenge(c *Challenge) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("expires_at < ?", time.Now()).Delete(&Challenge{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(c).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// TakeChallenge deletes and returns the challenge of nonce. It returns
+// ErrNotFound if it was never issued or is already taken, also by a
+// concurrent request.
+func (d *DataBase) TakeChallenge(nonce string) (*Challenge, error) {
+	var c Challenge
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("nonce = ?", nonce).First(&c).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("nonce = ?", nonce).Delete(&Challenge{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -1,11 +1,19 @@
 package database
 
 import (
+	"time"
+
+	"github.com/did-server/config"
 	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// ErrNotFound is returned by getters when no row matches
+var ErrNotFound = gorm.ErrRecordNotFound
+
 type DataBase struct {
 	db     *gorm.DB
 	logger *log.Helper
@@ -13,39 +21,111 @@ type DataBase struct {
 
 type Number struct {
 	gorm.Model
-	Did string `gorm:"uniqueIndex:number_composite;"`
-	Num int    `gorm:"uniqueIndex:number_composite;"`
+	Did         string `gorm:"uniqueIndex:number_composite;"`
+	Num         int    `gorm:"uniqueIndex:number_composite;"`
+	Status      string `gorm:"index;default:used"`
+	Deactivated bool
 }
 
-func CreateDB(logger *log.Helper) (*DataBase, error) {
-	db, err := gorm.Open(sqlite.Open("numbers.db"), &gorm.Config{})
+// CreateDB opens the database, applies pending migrations if
+// cfg.AutoMigrate and fails on a schema older than this server otherwise. A
+// schema newer than this server fails either way, it is never migrated down.
+func CreateDB(cfg *config.DatabaseConfig, logger *log.Helper) (*DataBase, error) {
+	d, err := OpenDB(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := d.SchemaVersion()
 	if err != nil {
+		return nil, err
+	}
+	switch {
+	case version > LatestVersion():
+		err = xerrors.Errorf("%w: version %d, this server knows up to %d: upgrade the server or run did server migrate down with the newer one", ErrSchemaNewer, version, LatestVersion())
+		logger.Error(err)
+		return nil, err
+	case version < LatestVersion() && cfg.AutoMigrate:
+		err = d.Migrate(LatestVersion())
+		if err != nil {
+			return nil, err
+		}
+	case version < LatestVersion():
+		err = xerrors.Errorf("database schema version %d, want %d: run did server migrate up", version, LatestVersion())
 		logger.Error(err)
 		return nil, err
 	}
 
-	db.AutoMigrate(&Number{}, &MfileInfo{})
-	return &DataBase{db: db, logger: logger}, nil
+	err = d.initNumberSequence()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	return d, nil
 }
 
-func (d *DataBase) GetNumber() (int, error) {
-	var maxNumber Number
-	err := d.db.Order("num desc").Limit(1).First(&maxNumber).Error
+// OpenDB opens the database of cfg.Driver without migrating it
+func OpenDB(cfg *config.DatabaseConfig, logger *log.Helper) (*DataBase, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case config.DriverSQLite, "":
+		dialector = sqlite.Open(cfg.Path)
+	case config.DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	default:
+		err := xerrors.Errorf("unsupported database driver %q", cfg.Driver)
+		logger.Error(err)
+		return nil, err
+	}
 
-	// 如果查询没有结果，返回默认值 100001
-	if err != nil || maxNumber.ID == 0 {
-		d.logger.Info(maxNumber.ID)
-		maxNumber.Num = 100001
-		return maxNumber.Num, nil
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if cfg.Driver == config.DriverPostgres {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	} else {
+		// sqlite allows a single writer, job workers update rows concurrently
+		sqlDB.SetMaxOpenConns(1)
 	}
 
-	return maxNumber.Num + 1, nil
+	return &DataBase{db: db, logger: logger}, nil
+}
+
+// Close closes the connections of the database
+func (d *DataBase) Close() error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func (d *DataBase) HasNumber(did string) (bool, error) {
+	var count int64
+	result := d.db.Model(&Number{}).Where("did = ? AND status = ?", did, NumberUsed).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
 }
 
-func (d *DataBase) AddNumber(did string, num int) error {
-	result := d.db.Create(&Number{Did: did, Num: num})
+func (d *DataBase) SetDeactivated(did string) error {
+	result := d.db.Model(&Number{}).Where("did = ?", did).Update("deactivated", true)
 	if result.Error != nil {
-		return result.Error
+		err := result.Error
+		d.logger.Error(err)
+		return err
 	}
 	return nil
 }
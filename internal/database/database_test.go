@@ -1,44 +1,373 @@
 package database
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/big"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/did-server/config"
 	klog "github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
 )
 
 func TestGetNumber(t *testing.T) {
-	logger := klog.With(klog.NewStdLogger(os.Stdout),
-		"ts", klog.DefaultTimestamp,
-		"caller", klog.DefaultCaller,
-	)
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	db, err := CreateDB(klog.NewHelper(logger))
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	num, err := db.GetNumber()
-	if err != nil {
-		t.Fatal(err)
-	}
+		num, err := db.GetNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	t.Log(num)
+		t.Log(num)
+	})
 }
 
 func TestAddNumber(t *testing.T) {
-	logger := klog.With(klog.NewStdLogger(os.Stdout),
-		"ts", klog.DefaultTimestamp,
-		"caller", klog.DefaultCaller,
-	)
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.AddNumber("did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac", 100001)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestJob(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job, err := db.CreateJob(JobRegisterDIDAdmin, "0xc145A262565C746fc1596ba92b85E43F006b9566", "did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// one worker claims a pending job, a stale claim is queued again
+		ok, err := db.ClaimJob(job.JobID)
+		if err != nil || !ok {
+			t.Fatalf("claim pending job: %t %v", ok, err)
+		}
+		ok, err = db.ClaimJob(job.JobID)
+		if err != nil || ok {
+			t.Fatalf("claimed job twice: %t %v", ok, err)
+		}
+		queued, err := db.HasQueuedJob(job.DID)
+		if err != nil || !queued {
+			t.Fatalf("claimed job not queued: %t %v", queued, err)
+		}
+		released, err := db.ReleaseClaimedJobs(time.Now().Add(-time.Minute))
+		if err != nil || released != 0 {
+			t.Fatalf("released fresh claim: %d %v", released, err)
+		}
+		released, err = db.ReleaseClaimedJobs(time.Now().Add(time.Minute))
+		if err != nil || released != 1 {
+			t.Fatalf("released stale claims: %d %v", released, err)
+		}
+		ok, err = db.ClaimJob(job.JobID)
+		if err != nil || !ok {
+			t.Fatalf("claim released job: %t %v", ok, err)
+		}
+
+		job.Status = JobSubmitted
+		job.TxHash = "0x1b2a7fe5414ff93753cbf4418a49398436b863d3f97a4c101d218c596bc9b5e3"
+		err = db.UpdateJob(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := db.GetJob(job.JobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != JobSubmitted || got.TxHash != job.TxHash {
+			t.Fatalf("unexpected job %+v", got)
+		}
+
+		jobs, err := db.ListRegisteredJobs(0, 10)
+		if err != nil || len(jobs) != 0 {
+			t.Fatalf("registered jobs %+v: %v", jobs, err)
+		}
+		job.Status = JobMined
+		err = db.UpdateJob(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err = db.ListRegisteredJobs(0, 10)
+		if err != nil || len(jobs) != 1 || jobs[0].JobID != job.JobID {
+			t.Fatalf("registered jobs %+v: %v", jobs, err)
+		}
+	})
+}
+
+func TestMfileInfo(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mdid := "did:mfile:cid:" + uuid.New().String()
+		info := &MfileInfo{
+			Address:  "0xc145A262565C746fc1596ba92b85E43F006b9566",
+			DID:      "did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac",
+			MDID:     mdid,
+			Price:    NewBigInt(big.NewInt(1000)),
+			Keywords: []string{"music", "mp3"},
+			Status:   MfileCreated,
+		}
+		err = db.SaveMfileInfo(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ok, err := db.ClaimMfileInfo(mdid)
+		if err != nil || !ok {
+			t.Fatalf("claim created mfile: %t %v", ok, err)
+		}
+		ok, err = db.ClaimMfileInfo(mdid)
+		if err != nil || ok {
+			t.Fatalf("claimed submitted mfile twice: %t %v", ok, err)
+		}
+
+		got, err := db.GetMfileInfo(mdid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Price.Cmp(info.Price.Int) != 0 || len(got.Keywords) != 2 || got.Status != MfileSubmitted {
+			t.Fatalf("unexpected mfile info %+v", got)
+		}
+	})
+}
+
+func TestReserveNumber(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count := 20
+		nums := make([]int, count)
+		var wg sync.WaitGroup
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				num, err := db.ReserveNumber(fmt.Sprintf("did:memo:%d", i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				nums[i] = num
+			}(i)
+		}
+		wg.Wait()
 
-	db, err := CreateDB(klog.NewHelper(logger))
+		seen := make(map[int]bool)
+		for _, num := range nums {
+			if num < firstNumber || seen[num] {
+				t.Fatalf("numbers %v", nums)
+			}
+			seen[num] = true
+		}
+
+		// a reservation is kept for its DID
+		num, err := db.ReserveNumber("did:memo:0")
+		if err != nil || num != nums[0] {
+			t.Fatalf("reserved again %d, want %d: %v", num, nums[0], err)
+		}
+
+		// a released number is handed out again, a burned one is not
+		err = db.ReleaseNumber("did:memo:1", nums[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.BurnNumber("did:memo:2", nums[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := db.GetNumber()
+		if err != nil || next != nums[1] {
+			t.Fatalf("next number %d, want released %d: %v", next, nums[1], err)
+		}
+		num, err = db.ReserveNumber("did:memo:new")
+		if err != nil || num != nums[1] {
+			t.Fatalf("reserved %d, want released %d: %v", num, nums[1], err)
+		}
+		num, err = db.ReserveNumber("did:memo:newer")
+		if err != nil || num != firstNumber+count {
+			t.Fatalf("reserved %d, want %d: %v", num, firstNumber+count, err)
+		}
+
+		// a number in use is not released
+		err = db.AddNumber("did:memo:3", nums[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.ReleaseNumber("did:memo:3", nums[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := db.HasNumber("did:memo:3")
+		if err != nil || !ok {
+			t.Fatalf("used number released: %t %v", ok, err)
+		}
+
+		reserved, err := db.ListReservedNumbers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reserved) != count-1 {
+			t.Fatalf("%d reserved numbers, want %d", len(reserved), count-1)
+		}
+	})
+}
+
+func TestNumberSequenceAfterAddedNumbers(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// numbers added before the sequence existed
+		err = db.AddNumber("did:memo:old", 200000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		num, err := db.ReserveNumber("did:memo:new")
+		if err != nil || num != 200001 {
+			t.Fatalf("reserved %d, want 200001: %v", num, err)
+		}
+	})
+}
+
+func TestSetDIDNumber(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// did:memo:a took the number released for did:memo:b on chain
+		num, err := db.ReserveNumber("did:memo:b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.ReleaseNumber("did:memo:b", num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.AddNumber("did:memo:a", num+5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.SetDIDNumber("did:memo:a", num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := db.GetDIDNumber("did:memo:a")
+		if err != nil || n.Num != num {
+			t.Fatalf("number of did:memo:a %v: %v", n, err)
+		}
+		next, err := db.GetNumber()
+		if err != nil || next == num {
+			t.Fatalf("number %d taken on chain handed out again: %v", next, err)
+		}
+
+		err = db.UnsetDIDNumber("did:memo:a", num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := db.HasNumber("did:memo:a")
+		if err != nil || ok {
+			t.Fatalf("did:memo:a still has a number: %t %v", ok, err)
+		}
+		next, err = db.GetNumber()
+		if err != nil || next == num {
+			t.Fatalf("unset number %d handed out again: %v", next, err)
+		}
+	})
+}
+
+func TestMfilePriceAbove64Bits(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+		for i, price := range []*big.Int{
+			big.NewInt(0),
+			new(big.Int).Lsh(big.NewInt(1), 63),
+			new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1)),
+			maxUint256,
+		} {
+			mdid := fmt.Sprintf("did:mfile:price%d", i)
+			err = db.SaveMfileInfo(&MfileInfo{MDID: mdid, Price: NewBigInt(price), Status: MfileCreated})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := db.GetMfileInfo(mdid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Price.Cmp(price) != 0 {
+				t.Fatalf("price %s read back as %s", price, got.Price)
+			}
+		}
+	})
+}
+
+func TestBigIntJSON(t *testing.T) {
+	price, _ := new(big.Int).SetString("18446744073709551617", 10)
+
+	data, err := json.Marshal(NewBigInt(price))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if string(data) != `"18446744073709551617"` {
+		t.Fatalf("marshaled %s", data)
+	}
 
-	err = db.AddNumber("did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac", 100001)
-	if err != nil {
-		t.Fatal(err)
+	for _, in := range []string{`"18446744073709551617"`, `18446744073709551617`} {
+		var b BigInt
+		err = json.Unmarshal([]byte(in), &b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Cmp(price) != 0 {
+			t.Fatalf("unmarshaled %s from %s", b, in)
+		}
 	}
 }
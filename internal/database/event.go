@@ -0,0 +1,121 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event is a decoded log of a DID contract
+type Event struct {
+	ID       uint   `gorm:"primarykey" json:"-"`
+	Name     string `gorm:"index" json:"name"`
+	Contract string `json:"contract"`
+	// Did is the DID identifier the event is about, the controller of a
+	// mfile DID, or its keccak256 hash when the contract indexes it
+	Did         string `gorm:"index" json:"did"`
+	Mfile       string `gorm:"index" json:"mfile,omitempty"`
+	Args        string `json:"args"`
+	BlockNumber uint64 `gorm:"index" json:"blockNumber"`
+	BlockHash   string `gorm:"uniqueIndex:event_log" json:"blockHash"`
+	TxHash      string `json:"txHash"`
+	LogIndex    uint   `gorm:"uniqueIndex:event_log" json:"logIndex"`
+}
+
+// IndexedBlock is a block the indexer went through, kept to detect reorgs
+type IndexedBlock struct {
+	Number uint64 `gorm:"primarykey;autoIncrement:false"`
+	Hash   string
+}
+
+// LastIndexedBlocks returns up to limit indexed blocks, the newest first
+func (d *DataBase) LastIndexedBlocks(limit int) ([]IndexedBlock, error) {
+	var blocks []IndexedBlock
+	err := d.db.Order("number desc").Limit(limit).Find(&blocks).Error
+	if err != nil {
+		d.logger.Error(err)
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// LastIndexedBlock returns the newest indexed block
+func (d *DataBase) LastIndexedBlock() (*IndexedBlock, error) {
+	var block IndexedBlock
+	err := d.db.Order("number desc").First(&block).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			d.logger.Error(err)
+		}
+		return nil, err
+	}
+	return &block, nil
+}
+
+// SaveEvents stores events and the blocks they were indexed up to at once,
+// so a restart resumes after the last saved block. Blocks older than keep
+// below the newest one are dropped.
+func (d *DataBase) SaveEvents(events []Event, blocks []IndexedBlock, keep uint64) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if len(events) > 0 {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&events).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+
+		err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&blocks).Error
+		if err != nil {
+			return err
+		}
+
+		newest := blocks[len(blocks)-1].Number
+		if newest <= keep {
+			return nil
+		}
+		return tx.Where("number < ?", newest-keep).Delete(&IndexedBlock{}).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// RollbackEvents drops the events and indexed blocks from block number on,
+// which were reorged out
+func (d *DataBase) RollbackEvents(number uint64) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("block_number >= ?", number).Delete(&Event{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("number >= ?", number).Delete(&IndexedBlock{}).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// ListEvents returns events about any of dids, of one name if not empty,
+// in chain order
+func (d *DataBase) ListEvents(dids []string, name string, offset, limit int) ([]Event, error) {
+	query := d.db.Where("did IN ?", dids)
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var events []Event
+	err := query.Order("block_number asc, log_index asc").Offset(offset).Limit(limit).Find(&events).Error
+	if err != nil {
+		d.logger.Error(err)
+		return nil, err
+	}
+	return events, nil
+}
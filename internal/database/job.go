@@ -0,0 +1,167 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	JobPending   = "pending"
+	JobClaimed   = "claimed" // taken by a worker, being sent
+	JobSubmitted = "submitted"
+	JobMined     = "mined"
+	JobFailed    = "failed"
+	JobSkipped   = "skipped" // already registered, nothing sent
+)
+
+const (
+	JobRegisterDID      = "register"
+	JobRegisterDIDAdmin = "admin"
+	JobRegisterDIDTon   = "ton"
+)
+
+// Job is a queued on-chain DID registration
+type Job struct {
+	gorm.Model
+	JobID   string `gorm:"uniqueIndex"`
+	Batch   string `gorm:"index"`
+	Kind    string
+	Address string
+	Sig     []byte
+	DID     string
+	Number  int
+	TxHash  string
+	Status  string `gorm:"index"`
+	Error   string
+}
+
+func (d *DataBase) CreateJob(kind, address, did string, sig []byte) (*Job, error) {
+	job := &Job{
+		JobID:   uuid.New().String(),
+		Kind:    kind,
+		Address: address,
+		Sig:     sig,
+		DID:     did,
+		Status:  JobPending,
+	}
+
+	err := d.AddJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (d *DataBase) AddJob(job *Job) error {
+	if job.JobID == "" {
+		job.JobID = uuid.New().String()
+	}
+
+	result := d.db.Create(job)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (d *DataBase) GetJob(jobID string) (*Job, error) {
+	var job Job
+	result := d.db.Where("job_id = ?", jobID).First(&job)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (d *DataBase) UpdateJob(job *Job) error {
+	result := d.db.Save(job)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// ListJobs returns jobs in the given status, oldest first
+func (d *DataBase) ListJobs(status string, limit int) ([]Job, error) {
+	var jobs []Job
+	result := d.db.Where("status = ?", status).Order("id asc").Limit(limit).Find(&jobs)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimJob moves job from pending to claimed for the calling worker. It
+// returns false if another worker, on this replica or another one sharing
+// the database, claimed it first.
+func (d *DataBase) ClaimJob(jobID string) (bool, error) {
+	result := d.db.Model(&Job{}).Where("job_id = ? AND status = ?", jobID, JobPending).Update("status", JobClaimed)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return false, err
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseClaimedJobs hands jobs claimed before since back to the workers,
+// their worker stopped before it recorded a transaction
+func (d *DataBase) ReleaseClaimedJobs(since time.Time) (int64, error) {
+	result := d.db.Model(&Job{}).Where("status = ? AND updated_at < ?", JobClaimed, since).Update("status", JobPending)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
+// ListRegisteredJobs returns limit jobs from offset whose DID is
+// registered on chain, mined or skipped as already registered, oldest first
+func (d *DataBase) ListRegisteredJobs(offset, limit int) ([]Job, error) {
+	var jobs []Job
+	result := d.db.Where("status IN ?", []string{JobMined, JobSkipped}).Order("id asc").Offset(offset).Limit(limit).Find(&jobs)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ListBatchJobs returns all jobs of an airdrop batch in insertion order
+func (d *DataBase) ListBatchJobs(batch string) ([]Job, error) {
+	var jobs []Job
+	result := d.db.Where("batch = ?", batch).Order("id asc").Find(&jobs)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// HasQueuedJob reports whether did has a job pending, being sent or waiting
+// for its receipt
+func (d *DataBase) HasQueuedJob(did string) (bool, error) {
+	var count int64
+	result := d.db.Model(&Job{}).Where("d_id = ? AND status IN ?", did, []string{JobPending, JobClaimed, JobSubmitted}).Count(&count)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return false, err
+	}
+	return count > 0, nil
+}
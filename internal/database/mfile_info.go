@@ -1,21 +1,46 @@
 package database
 
 import (
-	"math/big"
-
 	"gorm.io/gorm"
 )
 
+const (
+	MfileCreated    = "created"
+	MfileSubmitted  = "submitted"
+	MfileRegistered = "registered"
+	MfileFailed     = "failed"
+)
+
+// MfileInfo is an uploaded file waiting for, or done with, its mfile DID
+// registration. Message is the hex message the controller signs.
 type MfileInfo struct {
 	gorm.Model
-	Address string
-	DID     string
-	MDID    string `gorm:"uniqueIndex:mfile_composite;"`
-	Price   *big.Int
+	Address  string
+	DID      string
+	MDID     string   `gorm:"column:mdid;uniqueIndex:mfile_composite;"`
+	Price    BigInt   `gorm:"column:price"`
+	Keywords []string `gorm:"serializer:json"`
+	Message  string
+	TxHash   string
+	Status   string `gorm:"index"`
+	Error    string
 }
 
-func (d *DataBase) CreateMfileInfo(address, did, mdid string, price *big.Int) error {
-	result := d.db.Create(&MfileInfo{Address: address, DID: did, MDID: mdid, Price: price})
+// SaveMfileInfo creates the row of info.MDID or overwrites it
+func (d *DataBase) SaveMfileInfo(info *MfileInfo) error {
+	var old MfileInfo
+	result := d.db.Where("mdid = ?", info.MDID).Limit(1).Find(&old)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return err
+	}
+	if result.RowsAffected > 0 {
+		info.ID = old.ID
+		info.CreatedAt = old.CreatedAt
+	}
+
+	result = d.db.Save(info)
 	if result.Error != nil {
 		err := result.Error
 		d.logger.Error(err)
@@ -35,3 +60,27 @@ func (d *DataBase) GetMfileInfo(mdid string) (*MfileInfo, error) {
 	}
 	return &info, nil
 }
+
+// ClaimMfileInfo moves a created or failed mfile to submitted. It returns
+// false if another request got there first.
+func (d *DataBase) ClaimMfileInfo(mdid string) (bool, error) {
+	result := d.db.Model(&MfileInfo{}).
+		Where("mdid = ? AND status IN ?", mdid, []string{MfileCreated, MfileFailed}).
+		Updates(map[string]interface{}{"status": MfileSubmitted, "error": ""})
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return false, err
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (d *DataBase) UpdateMfileInfo(info *MfileInfo) error {
+	result := d.db.Save(info)
+	if result.Error != nil {
+		err := result.Error
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
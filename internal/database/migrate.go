@@ -0,0 +1,384 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/did-server/config"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+)
+
+// migrationLock is the postgres advisory lock held while migrating, so that
+// replicas starting at once migrate one after the other
+const migrationLock = 7_310_001
+
+// SchemaMigration is an applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// migration changes the schema from version-1 to version and back. Tables
+// are declared by snapshots of the models at that version, a released
+// migration never changes: later ones change its tables.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+	down    func(tx *gorm.DB) error
+}
+
+// migrations in version order, from 1 without gaps
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "numbers, jobs and mfile infos",
+		up: func(tx *gorm.DB) error {
+			// adopts tables created by AutoMigrate before migrations
+			return tx.AutoMigrate(&numberV1{}, &jobV1{}, &mfileInfoV1{})
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&mfileInfoV1{}, &jobV1{}, &numberV1{})
+		},
+	},
+	{
+		version: 2,
+		name:    "number reservations",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&numberV2{}, &numberSequenceV2{})
+		},
+		down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(&numberSequenceV2{})
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropIndex(&numberV2{}, "Status")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&numberV2{}, "Status")
+		},
+	},
+	{
+		version: 3,
+		name:    "contract events",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&eventV3{}, &indexedBlockV3{})
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&indexedBlockV3{}, &eventV3{})
+		},
+	},
+	{
+		version: 4,
+		name:    "mfile prices as numbers",
+		up: func(tx *gorm.DB) error {
+			err := normalizeMfilePrices(tx)
+			if err != nil || tx.Dialector.Name() != config.DriverPostgres {
+				return err
+			}
+			// sqlite keeps the decimal string, its numbers are 64 bit
+			return tx.Exec("ALTER TABLE mfile_infos ALTER COLUMN price TYPE numeric(78,0) USING price::numeric").Error
+		},
+		down: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != config.DriverPostgres {
+				return nil
+			}
+			return tx.Exec("ALTER TABLE mfile_infos ALTER COLUMN price TYPE text USING price::text").Error
+		},
+	},
+	{
+		version: 5,
+		name:    "signed challenges",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&challengeV5{})
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&challengeV5{})
+		},
+	},
+}
+
+// normalizeMfilePrices rewrites the legacy text prices of mfile infos as
+// plain amounts of wei, an empty one as 0. A price that is not a whole
+// amount of wei fails the migration, to be fixed by hand.
+func normalizeMfilePrices(tx *gorm.DB) error {
+	// soft deleted rows are converted as well
+	var infos []struct {
+		ID    uint
+		MDID  string `gorm:"column:mdid"`
+		Price sql.NullString
+	}
+	err := tx.Table("mfile_infos").Select("id", "mdid", "price").Find(&infos).Error
+	if err != nil {
+		return err
+	}
+
+	var invalid []string
+	for _, info := range infos {
+		price := strings.TrimSpace(info.Price.String)
+		if price == "" {
+			price = "0"
+		}
+		n, ok := new(big.Int).SetString(price, 10)
+		if !ok || n.Sign() < 0 {
+			invalid = append(invalid, fmt.Sprintf("%s (id %d) %q", info.MDID, info.ID, info.Price.String))
+			continue
+		}
+		if info.Price.Valid && n.String() == info.Price.String {
+			continue
+		}
+		err = tx.Table("mfile_infos").Where("id = ?", info.ID).Update("price", n.String()).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(invalid) > 0 {
+		return xerrors.Errorf("mfile prices are not amounts of wei: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// LatestVersion is the schema version of this server
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationStatus is a migration and whether it is applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// SchemaVersion returns the version of the last applied migration, 0 for
+// an empty database
+func (d *DataBase) SchemaVersion() (int, error) {
+	err := d.db.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		d.logger.Error(err)
+		return 0, err
+	}
+
+	version, err := schemaVersion(d.db)
+	if err != nil {
+		d.logger.Error(err)
+		return 0, err
+	}
+	return version, nil
+}
+
+func schemaVersion(tx *gorm.DB) (int, error) {
+	var version int
+	err := tx.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Migrations returns every migration of this server and whether it is
+// applied
+func (d *DataBase) Migrations() ([]MigrationStatus, error) {
+	_, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+	err = d.db.Find(&applied).Error
+	if err != nil {
+		d.logger.Error(err)
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := appliedAt[m.version]
+		status = append(status, MigrationStatus{Version: m.version, Name: m.name, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
+
+// ErrSchemaNewer is returned when the database was migrated by a newer
+// server, whose migrations this one does not know
+var ErrSchemaNewer = xerrors.New("database schema is newer than this server")
+
+// Migrate applies migrations, one transaction each, until the schema is at
+// version target. It never reverts one, a schema above target fails.
+func (d *DataBase) Migrate(target int) error {
+	return d.migrate(target, false)
+}
+
+// MigrateDown reverts migrations, one transaction each, until the schema is
+// at version target. Only did server migrate down reverts migrations.
+func (d *DataBase) MigrateDown(target int) error {
+	return d.migrate(target, true)
+}
+
+func (d *DataBase) migrate(target int, down bool) error {
+	if target < 0 || target > LatestVersion() {
+		err := xerrors.Errorf("schema version %d is not between 0 and %d", target, LatestVersion())
+		d.logger.Error(err)
+		return err
+	}
+
+	_, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for {
+		done, err := d.migrateStep(target, down)
+		if err != nil {
+			d.logger.Error(err)
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// migrateStep applies, or reverts if down, the migration next toward
+// target. It returns true once the schema is at target.
+func (d *DataBase) migrateStep(target int, down bool) (bool, error) {
+	done := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == config.DriverPostgres {
+			err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// read under the lock, another replica may have migrated meanwhile
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case version > LatestVersion():
+			return xerrors.Errorf("%w: version %d, this server knows up to %d", ErrSchemaNewer, version, LatestVersion())
+		case version == target:
+			done = true
+			return nil
+		case version < target && !down:
+			m := migrations[version]
+			d.logger.Infof("migrate up to schema version %d: %s", m.version, m.name)
+			err = m.up(tx)
+			if err != nil {
+				return xerrors.Errorf("migrate up to %d: %w", m.version, err)
+			}
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		case version > target && down:
+			m := migrations[version-1]
+			d.logger.Infof("migrate down from schema version %d: %s", m.version, m.name)
+			err = m.down(tx)
+			if err != nil {
+				return xerrors.Errorf("migrate down from %d: %w", m.version, err)
+			}
+			return tx.Delete(&SchemaMigration{}, m.version).Error
+		case down:
+			return xerrors.Errorf("schema version %d is below %d, use migrate up", version, target)
+		default:
+			return xerrors.Errorf("schema version %d is above %d, use migrate down", version, target)
+		}
+	})
+	return done, err
+}
+
+type numberV1 struct {
+	gorm.Model
+	Did         string `gorm:"uniqueIndex:number_composite;"`
+	Num         int    `gorm:"uniqueIndex:number_composite;"`
+	Deactivated bool
+}
+
+func (numberV1) TableName() string { return "numbers" }
+
+type jobV1 struct {
+	gorm.Model
+	JobID   string `gorm:"uniqueIndex"`
+	Batch   string `gorm:"index"`
+	Kind    string
+	Address string
+	Sig     []byte
+	DID     string
+	Number  int
+	TxHash  string
+	Status  string `gorm:"index"`
+	Error   string
+}
+
+func (jobV1) TableName() string { return "jobs" }
+
+type mfileInfoV1 struct {
+	gorm.Model
+	Address  string
+	DID      string
+	MDID     string   `gorm:"column:mdid;uniqueIndex:mfile_composite;"`
+	PriceWei string   `gorm:"column:price"`
+	Keywords []string `gorm:"serializer:json"`
+	Message  string
+	TxHash   string
+	Status   string `gorm:"index"`
+	Error    string
+}
+
+func (mfileInfoV1) TableName() string { return "mfile_infos" }
+
+type numberV2 struct {
+	gorm.Model
+	Did         string `gorm:"uniqueIndex:number_composite;"`
+	Num         int    `gorm:"uniqueIndex:number_composite;"`
+	Status      string `gorm:"index;default:used"`
+	Deactivated bool
+}
+
+func (numberV2) TableName() string { return "numbers" }
+
+type numberSequenceV2 struct {
+	ID   uint `gorm:"primarykey"`
+	Next int
+}
+
+func (numberSequenceV2) TableName() string { return "number_sequences" }
+
+type eventV3 struct {
+	ID          uint   `gorm:"primarykey"`
+	Name        string `gorm:"index"`
+	Contract    string
+	Did         string `gorm:"index"`
+	Mfile       string `gorm:"index"`
+	Args        string
+	BlockNumber uint64 `gorm:"index"`
+	BlockHash   string `gorm:"uniqueIndex:event_log"`
+	TxHash      string
+	LogIndex    uint `gorm:"uniqueIndex:event_log"`
+}
+
+func (eventV3) TableName() string { return "events" }
+
+type indexedBlockV3 struct {
+	Number uint64 `gorm:"primarykey;autoIncrement:false"`
+	Hash   string
+}
+
+func (indexedBlockV3) TableName() string { return "indexed_blocks" }
+
+type challengeV5 struct {
+	Nonce     string `gorm:"primarykey"`
+	Message   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (challengeV5) TableName() string { return "challenges" }
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/did-server/config"
+	klog "github.com/go-kratos/kratos/v2/log"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// forEachDriver runs test on a fresh sqlite database, and on postgres when
+// DID_TEST_POSTGRES_DSN names a database the test may wipe
+func forEachDriver(t *testing.T, test func(t *testing.T, cfg *config.DatabaseConfig)) {
+	t.Run(config.DriverSQLite, func(t *testing.T) {
+		cfg := config.Default().Database
+		cfg.Path = filepath.Join(t.TempDir(), "did.db")
+		test(t, &cfg)
+	})
+
+	t.Run(config.DriverPostgres, func(t *testing.T) {
+		dsn := os.Getenv("DID_TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("DID_TEST_POSTGRES_DSN not set")
+		}
+
+		cfg := config.Default().Database
+		cfg.Driver = config.DriverPostgres
+		cfg.DSN = dsn
+
+		db, err := OpenDB(&cfg, klog.NewHelper(klog.NewStdLogger(os.Stdout)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Migrate(LatestVersion())
+		if err == nil {
+			err = db.MigrateDown(0)
+		}
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, &cfg)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := OpenDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		version, err := db.SchemaVersion()
+		if err != nil || version != 0 {
+			t.Fatalf("empty database at schema version %d: %v", version, err)
+		}
+
+		err = db.Migrate(LatestVersion())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"numbers", "number_sequences", "jobs", "mfile_infos", "events", "indexed_blocks", "challenges"} {
+			if !db.db.Migrator().HasTable(table) {
+				t.Fatalf("no table %s at the latest version", table)
+			}
+		}
+
+		err = db.Migrate(1)
+		if err == nil {
+			t.Fatal("migrated down without MigrateDown")
+		}
+		err = db.MigrateDown(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.db.Migrator().HasTable("number_sequences") || db.db.Migrator().HasColumn(&numberV2{}, "Status") {
+			t.Fatal("number reservations not reverted")
+		}
+		if db.db.Migrator().HasTable("events") {
+			t.Fatal("contract events not reverted")
+		}
+		if !db.db.Migrator().HasTable("numbers") {
+			t.Fatal("numbers dropped at version 1")
+		}
+
+		err = db.Migrate(LatestVersion())
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err := db.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range status {
+			if !m.Applied {
+				t.Fatalf("migration %d %s not applied", m.Version, m.Name)
+			}
+		}
+
+		err = db.MigrateDown(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.db.Migrator().HasTable("numbers") {
+			t.Fatal("numbers not dropped at version 0")
+		}
+
+		err = db.Migrate(LatestVersion() + 1)
+		if err == nil {
+			t.Fatal("migrated past the latest version")
+		}
+	})
+}
+
+func TestMigrateAutoMigratedDB(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	cfg := config.Default().Database
+	cfg.Path = filepath.Join(t.TempDir(), "did.db")
+
+	// tables as created by servers before migrations
+	old, err := gorm.Open(sqlite.Open(cfg.Path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = old.AutoMigrate(&numberV1{}, &mfileInfoV1{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = old.Create(&numberV1{Did: "did:memo:old", Num: 100001}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := old.DB()
+	sqlDB.Close()
+
+	cfg.AutoMigrate = false
+	_, err = CreateDB(&cfg, logger)
+	if err == nil {
+		t.Fatal("opened an old schema without migrating")
+	}
+
+	cfg.AutoMigrate = true
+	db, err := CreateDB(&cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := db.SchemaVersion()
+	if err != nil || version != LatestVersion() {
+		t.Fatalf("schema version %d: %v", version, err)
+	}
+
+	ok, err := db.HasNumber("did:memo:old")
+	if err != nil || !ok {
+		t.Fatalf("number added before migrations lost: %t %v", ok, err)
+	}
+	num, err := db.ReserveNumber("did:memo:new")
+	if err != nil || num != 100002 {
+		t.Fatalf("reserved %d, want 100002: %v", num, err)
+	}
+}
+
+func TestCreateDBNewerSchema(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := CreateDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		// migrated by a newer server
+		err = db.db.Create(&SchemaMigration{Version: LatestVersion() + 1, Name: "from the future", AppliedAt: time.Now()}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = CreateDB(cfg, logger)
+		if !errors.Is(err, ErrSchemaNewer) {
+			t.Fatalf("opened a newer schema: %v", err)
+		}
+		err = db.Migrate(LatestVersion())
+		if !errors.Is(err, ErrSchemaNewer) {
+			t.Fatalf("migrated a newer schema: %v", err)
+		}
+		err = db.MigrateDown(1)
+		if !errors.Is(err, ErrSchemaNewer) {
+			t.Fatalf("reverted a newer schema: %v", err)
+		}
+		if !db.db.Migrator().HasColumn(&Number{}, "Status") {
+			t.Fatal("newer schema migrated down")
+		}
+
+		// leave the postgres database to the next test
+		err = db.db.Delete(&SchemaMigration{}, LatestVersion()+1).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMigrateLegacyPrices(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.DatabaseConfig) {
+		logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+		db, err := OpenDB(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.Migrate(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prices := map[string]string{"did:mfile:cid:a": " 12 ", "did:mfile:cid:b": "", "did:mfile:cid:c": "100"}
+		for mdid, price := range prices {
+			err = db.db.Create(&mfileInfoV1{MDID: mdid, PriceWei: price}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = db.db.Create(&mfileInfoV1{MDID: "did:mfile:cid:d", PriceWei: "1.5gwei"}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Migrate(LatestVersion())
+		if err == nil {
+			t.Fatal("migrated a price that is not an amount of wei")
+		}
+		version, err := db.SchemaVersion()
+		if err != nil || version != 3 {
+			t.Fatalf("schema version %d after a failed migration: %v", version, err)
+		}
+
+		err = db.db.Model(&mfileInfoV1{}).Where("mdid = ?", "did:mfile:cid:d").Update("price", "1500000000").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Migrate(LatestVersion())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{"did:mfile:cid:a": "12", "did:mfile:cid:b": "0", "did:mfile:cid:c": "100", "did:mfile:cid:d": "1500000000"}
+		for mdid, price := range want {
+			info, err := db.GetMfileInfo(mdid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Price.String() != price {
+				t.Fatalf("%s price %s, want %s", mdid, info.Price, price)
+			}
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 第一个编号
+const firstNumber = 100001
+
+const (
+	NumberReserved = "reserved" // held by a registration in flight
+	NumberUsed     = "used"     // registered on chain
+	NumberReleased = "released" // not taken on chain, handed out again
+	NumberBurned   = "burned"   // may be taken on chain, never handed out again
+)
+
+// NumberSequence is the single row holding the next number never handed
+// out. Taking a number is one UPDATE ... RETURNING, so concurrent
+// registrations can not get the same one.
+type NumberSequence struct {
+	ID   uint `gorm:"primarykey"`
+	Next int
+}
+
+// initNumberSequence creates the sequence, and moves it past numbers added
+// without it
+func (d *DataBase) initNumberSequence() error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var max int
+		err := tx.Model(&Number{}).Select("COALESCE(MAX(num), 0)").Scan(&max).Error
+		if err != nil {
+			return err
+		}
+		next := firstNumber
+		if max >= next {
+			next = max + 1
+		}
+
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&NumberSequence{ID: 1, Next: next}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&NumberSequence{}).Where("id = ? AND next < ?", 1, next).Update("next", next).Error
+	})
+}
+
+func nextNumber(tx *gorm.DB) (int, error) {
+	var seq NumberSequence
+	err := tx.Model(&seq).Clauses(clause.Returning{}).Where("id = ?", 1).Update("next", gorm.Expr("next + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	return seq.Next - 1, nil
+}
+
+// GetNumber returns the number the next reservation gets, without
+// reserving it
+func (d *DataBase) GetNumber() (int, error) {
+	var n Number
+	err := d.db.Where("status = ?", NumberReleased).Order("num asc").First(&n).Error
+	if err == nil {
+		return n.Num, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	var seq NumberSequence
+	err = d.db.First(&seq, 1).Error
+	if err != nil {
+		return 0, err
+	}
+	return seq.Next, nil
+}
+
+// ReserveNumber returns the number reserved or used by did, or reserves
+// one, the lowest released number if any
+func (d *DataBase) ReserveNumber(did string) (int, error) {
+	var num int
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var n Number
+		err := tx.Where("did = ? AND status IN ?", did, []string{NumberReserved, NumberUsed}).First(&n).Error
+		if err == nil {
+			num = n.Num
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", NumberReleased).Order("num asc").First(&n).Error
+		if err == nil {
+			num = n.Num
+			return tx.Model(&n).Updates(map[string]interface{}{"did": did, "status": NumberReserved}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		num, err = nextNumber(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&Number{Did: did, Num: num, Status: NumberReserved}).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return 0, err
+	}
+
+	return num, nil
+}
+
+// GetDIDNumber returns the number reserved or used by did
+func (d *DataBase) GetDIDNumber(did string) (*Number, error) {
+	var n Number
+	err := d.db.Where("did = ? AND status IN ?", did, []string{NumberReserved, NumberUsed}).First(&n).Error
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ListReservedNumbers returns the numbers of registrations in flight
+func (d *DataBase) ListReservedNumbers() ([]Number, error) {
+	var numbers []Number
+	err := d.db.Where("status = ?", NumberReserved).Order("num asc").Find(&numbers).Error
+	if err != nil {
+		d.logger.Error(err)
+		return nil, err
+	}
+	return numbers, nil
+}
+
+// ListNumbers returns limit numbers of any status from offset, in the
+// order they were added
+func (d *DataBase) ListNumbers(offset, limit int) ([]Number, error) {
+	var numbers []Number
+	err := d.db.Order("id asc").Offset(offset).Limit(limit).Find(&numbers).Error
+	if err != nil {
+		d.logger.Error(err)
+		return nil, err
+	}
+	return numbers, nil
+}
+
+// SetDIDNumber records num as the number of did, as found on chain. Other
+// numbers used by did are burned, as is num if released for another DID.
+func (d *DataBase) SetDIDNumber(did string, num int) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Number{}).Where("did = ? AND num <> ? AND status = ?", did, num, NumberUsed).
+			Update("status", NumberBurned).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Number{}).Where("did <> ? AND num = ? AND status = ?", did, num, NumberReleased).
+			Update("status", NumberBurned).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&Number{}).Where("did = ? AND num = ?", did, num).Update("status", NumberUsed)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		return tx.Create(&Number{Did: did, Num: num, Status: NumberUsed}).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// UnsetDIDNumber burns num used by did, which has no number on chain. It
+// is not handed out again, another DID may have taken it.
+func (d *DataBase) UnsetDIDNumber(did string, num int) error {
+	result := d.db.Model(&Number{}).Where("did = ? AND num = ? AND status = ?", did, num, NumberUsed).
+		Update("status", NumberBurned)
+	if result.Error != nil {
+		d.logger.Error(result.Error)
+		return result.Error
+	}
+	return nil
+}
+
+// AddNumber records num as used by did, a reservation of it included
+func (d *DataBase) AddNumber(did string, num int) error {
+	return d.setNumberStatus(did, num, NumberUsed)
+}
+
+// ReleaseNumber hands num out again, its registration was not mined
+func (d *DataBase) ReleaseNumber(did string, num int) error {
+	return d.setNumberStatus(did, num, NumberReleased)
+}
+
+// BurnNumber never hands num out again, its registration may be mined
+func (d *DataBase) BurnNumber(did string, num int) error {
+	return d.setNumberStatus(did, num, NumberBurned)
+}
+
+// setNumberStatus only releases or burns a reservation, never a number in
+// use
+func (d *DataBase) setNumberStatus(did string, num int, status string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Number{}).Where("did = ? AND num = ?", did, num)
+		if status != NumberUsed {
+			query = query.Where("status = ?", NumberReserved)
+		}
+		result := query.Update("status", status)
+		if result.Error != nil || result.RowsAffected > 0 || status != NumberUsed {
+			return result.Error
+		}
+		return tx.Create(&Number{Did: did, Num: num, Status: status}).Error
+	})
+	if err != nil {
+		d.logger.Error(err)
+		return err
+	}
+	return nil
+}
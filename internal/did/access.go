@@ -0,0 +1,218 @@
+package did
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+// ChallengeTTL is how long an issued challenge can be signed and used
+var ChallengeTTL = 5 * time.Minute
+
+var (
+	ErrChallengeExpired = xerrors.New("challenge expired or already used")
+	ErrReadDenied       = xerrors.New("did has no read permission on the mfile")
+	ErrNotDIDKey        = xerrors.New("address is not a verification method of the did")
+	ErrFileAction       = xerrors.New("unknown file action")
+)
+
+// Challenge is a single-use message the client signs as an ethereum message
+type Challenge struct {
+	Nonce   string
+	Msg     string // hex
+	Expires int64
+}
+
+// NewDownloadChallenge issues the challenge address signs to download mdid
+func (m *MemoDID) NewDownloadChallenge(mdid, address string) (*Challenge, error) {
+	return m.newChallenge("download "+mdid, address)
+}
+
+// actions on the files of an address. Files are private to their address,
+// each action is signed by it over a single-use challenge.
+const (
+	FileUpload   = "upload"
+	FileDownload = "download"
+	FileList     = "list"
+	FileDelete   = "delete"
+)
+
+// NewFileChallenge issues the challenge address signs to do action on its
+// file name. name is the file cid for a download by cid and is ignored for
+// a list.
+func (m *MemoDID) NewFileChallenge(action, address, name string) (*Challenge, error) {
+	a, err := fileAction(action, name)
+	if err != nil {
+		return nil, err
+	}
+	return m.newChallenge(a, address)
+}
+
+// CheckFile checks that sig over the challenge of nonce is made by address,
+// for doing action on its file name
+func (m *MemoDID) CheckFile(action, address, name, nonce string, sig []byte) error {
+	a, err := fileAction(action, name)
+	if err != nil {
+		return err
+	}
+	_, err = m.useChallenge(a, address, nonce, sig)
+	return err
+}
+
+func fileAction(action, name string) (string, error) {
+	switch action {
+	case FileUpload, FileDownload, FileDelete:
+		return action + " file " + name, nil
+	case FileList:
+		return "list files", nil
+	default:
+		return "", ErrFileAction
+	}
+}
+
+func (m *MemoDID) newChallenge(action, address string) (*Challenge, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
+	nonce := hex.EncodeToString(b)
+	expires := time.Now().Add(ChallengeTTL).Unix()
+	msg := challengeMessage(action, address, nonce, expires)
+
+	err = m.db.AddChallenge(&database.Challenge{Nonce: nonce, Message: string(msg), ExpiresAt: time.Unix(expires, 0)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Challenge{Nonce: nonce, Msg: hexutil.Encode(msg), Expires: expires}, nil
+}
+
+func challengeMessage(action, address, nonce string, expires int64) []byte {
+	return []byte(fmt.Sprintf("%s\naddress %s\nnonce %s\nexpires %d", action, common.HexToAddress(address).Hex(), nonce, expires))
+}
+
+// useChallenge takes the challenge of nonce, whatever the outcome so that
+// it is never checked twice, and returns the signer if it was issued for
+// action by address and is signed by address
+func (m *MemoDID) useChallenge(action, address, nonce string, sig []byte) (common.Address, error) {
+	c, err := m.db.TakeChallenge(nonce)
+	if errors.Is(err, database.ErrNotFound) {
+		return common.Address{}, ErrChallengeExpired
+	}
+	if err != nil {
+		m.logger.Error(err)
+		return common.Address{}, err
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return common.Address{}, ErrChallengeExpired
+	}
+
+	msg := challengeMessage(action, address, nonce, c.ExpiresAt.Unix())
+	if c.Message != string(msg) {
+		return common.Address{}, ErrSignatureMismatch
+	}
+
+	signer, err := recoverAddress(accounts.TextHash(msg), sig)
+	if err != nil || signer != common.HexToAddress(address) {
+		return common.Address{}, ErrSignatureMismatch
+	}
+
+	return signer, nil
+}
+
+// IsMfilePublic reports whether mdid is registered on chain, active and
+// priced 0, and so can be read by anyone. An unregistered mfile is not
+// public, its price reads 0 as well.
+func (m *MemoDID) IsMfilePublic(ctx context.Context, mdid string) (bool, error) {
+	mfile, err := types.ParseMfileDID(mdid)
+	if err != nil {
+		m.logger.Error(err)
+		return false, err
+	}
+
+	controller, deactivated, err := m.Controller.GetMfileController(ctx, mfile.Identifier)
+	if err != nil {
+		return false, err
+	}
+	if controller == "" || deactivated {
+		return false, nil
+	}
+
+	price, err := m.Controller.GetMfilePrice(ctx, mfile.Identifier)
+	if err != nil {
+		return false, err
+	}
+
+	return price.Sign() == 0, nil
+}
+
+// CheckMfileRead checks that sig over the download challenge of nonce is
+// made by address, that address is an active key of didStr, and that didStr
+// controls mdid or has bought or been granted read access to it
+func (m *MemoDID) CheckMfileRead(ctx context.Context, mdid, didStr, address, nonce string, sig []byte) error {
+	signer, err := m.useChallenge("download "+mdid, address, nonce, sig)
+	if err != nil {
+		return err
+	}
+
+	did, err := m.activeDID(ctx, didStr)
+	if err != nil {
+		return err
+	}
+
+	methods, err := m.Controller.GetVerificationMethods(ctx, did.Identifier)
+	if err != nil {
+		return err
+	}
+	isKey := false
+	for _, method := range methods {
+		if method.Deactivated {
+			continue
+		}
+		key, err := verificationAddress(method.MethodType, method.PubKeyData)
+		if err == nil && key == signer {
+			isKey = true
+			break
+		}
+	}
+	if !isKey {
+		return ErrNotDIDKey
+	}
+
+	mfile, err := types.ParseMfileDID(mdid)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	controller, _, err := m.Controller.GetMfileController(ctx, mfile.Identifier)
+	if err != nil {
+		return err
+	}
+	controllerI, err := didIdentifier(controller)
+	if err == nil && controllerI == did.Identifier {
+		return nil
+	}
+
+	read, err := m.Controller.CanReadMfile(ctx, mfile.Identifier, did.Identifier)
+	if err != nil {
+		return err
+	}
+	if !read {
+		return ErrReadDenied
+	}
+
+	return nil
+}
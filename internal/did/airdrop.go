@@ -0,0 +1,181 @@
+package did
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/xerrors"
+)
+
+// ErrRegistrationQueued rejects an airdrop address whose DID has a
+// registration pending or submitted by another job
+var ErrRegistrationQueued = xerrors.New("registration already queued")
+
+// AirdropResult is one line of an airdrop report
+type AirdropResult struct {
+	Address string `json:"address"`
+	DID     string `json:"did"`
+	Number  int    `json:"number"`
+	TxHash  string `json:"txHash"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// EnqueueAirdrop queues admin registrations for a list of addresses under
+// one batch. Addresses that already have a job in the batch are left alone,
+// so an interrupted batch can simply be submitted again. Addresses whose DID
+// is in the Number table or already verified on chain are marked skipped.
+// Addresses whose DID has a registration queued by another job are rejected
+// without a job, they are checked again when the batch is resubmitted.
+func (m *MemoDID) EnqueueAirdrop(ctx context.Context, batch string, addresses []string) ([]AirdropResult, error) {
+	jobs, err := m.db.ListBatchJobs(batch)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, job := range jobs {
+		seen[job.Address] = true
+	}
+
+	todo, results := airdropAddresses(addresses, seen)
+
+	var lk sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, m.concurrency)
+	for _, address := range todo {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(address string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// no job is stored on error, the address is checked again on resubmit
+			err := m.enqueueAirdropAddress(ctx, batch, address)
+			if err != nil {
+				lk.Lock()
+				results = append(results, AirdropResult{Address: address, Status: database.JobFailed, Error: err.Error()})
+				lk.Unlock()
+			}
+		}(address)
+	}
+	wg.Wait()
+
+	m.wakeJobs()
+
+	report, err := m.AirdropReport(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(results, report...), nil
+}
+
+// airdropAddresses returns the checksummed addresses not seen yet, each once,
+// and a failed result for every invalid one
+func airdropAddresses(addresses []string, seen map[string]bool) ([]string, []AirdropResult) {
+	var results []AirdropResult
+	var todo []string
+	for _, address := range addresses {
+		address = strings.TrimSpace(address)
+		if !common.IsHexAddress(address) {
+			results = append(results, AirdropResult{Address: address, Status: database.JobFailed, Error: "invalid address"})
+			continue
+		}
+
+		address = common.HexToAddress(address).Hex()
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		todo = append(todo, address)
+	}
+
+	return todo, results
+}
+
+func (m *MemoDID) enqueueAirdropAddress(ctx context.Context, batch, address string) error {
+	did, err := m.CreateDIDByAddress(ctx, address)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	job := &database.Job{
+		Batch:   batch,
+		Kind:    database.JobRegisterDIDAdmin,
+		Address: address,
+		DID:     did.String(),
+		Status:  database.JobPending,
+	}
+
+	queued, err := m.db.HasQueuedJob(job.DID)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+	if queued {
+		return ErrRegistrationQueued
+	}
+
+	exist, err := m.db.HasNumber(job.DID)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	if !exist {
+		verify, err := m.Controller.GetDIDVerify(ctx, did.Identifier)
+		if err != nil {
+			m.logger.Error(err)
+			return err
+		}
+		exist = verify > 0
+	}
+
+	if exist {
+		job.Status = database.JobSkipped
+	}
+
+	return m.db.AddJob(job)
+}
+
+// AirdropReport returns the current state of every address in a batch
+func (m *MemoDID) AirdropReport(batch string) ([]AirdropResult, error) {
+	jobs, err := m.db.ListBatchJobs(batch)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
+
+	results := make([]AirdropResult, 0, len(jobs))
+	for _, job := range jobs {
+		results = append(results, AirdropResult{
+			Address: job.Address,
+			DID:     job.DID,
+			Number:  job.Number,
+			TxHash:  job.TxHash,
+			Status:  job.Status,
+			Error:   job.Error,
+		})
+	}
+
+	return results, nil
+}
+
+// AirdropDone reports whether no job of the batch is pending, claimed or
+// submitted
+func AirdropDone(results []AirdropResult) bool {
+	for _, r := range results {
+		if r.Status == database.JobPending || r.Status == database.JobClaimed || r.Status == database.JobSubmitted {
+			return false
+		}
+	}
+	return true
+}
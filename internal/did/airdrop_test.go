@@ -0,0 +1,40 @@
+package did
+
+import (
+	"testing"
+
+	"github.com/did-server/internal/database"
+)
+
+func TestAirdropAddresses(t *testing.T) {
+	a := "0xc145A262565C746fc1596ba92b85E43F006b9566"
+	b := "0x8E6EF5C8FF4e2A7c4Cc2d8c9b6Fa3b36D1A3d4e1"
+	c := "0x5B38Da6a701c568545dCfcB03FcB875f56beddC4"
+
+	// c is in the batch already
+	seen := map[string]bool{c: true}
+	todo, results := airdropAddresses([]string{
+		a,
+		" 0xc145a262565c746fc1596ba92b85e43f006b9566 ",
+		"not an address",
+		b,
+		c,
+		a,
+	}, seen)
+
+	if len(todo) != 2 || todo[0] != a || todo[1] != b {
+		t.Fatalf("todo %v", todo)
+	}
+	if len(results) != 1 || results[0].Address != "not an address" || results[0].Status != database.JobFailed {
+		t.Fatalf("results %+v", results)
+	}
+	if !seen[a] || !seen[b] {
+		t.Fatalf("seen %v", seen)
+	}
+
+	// the next batch of the same run sends nothing again
+	todo, _ = airdropAddresses([]string{b, a}, seen)
+	if len(todo) != 0 {
+		t.Fatalf("todo again %v", todo)
+	}
+}
@@ -0,0 +1,132 @@
+package did
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/did-server/internal/contract"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+var ErrInvalidDID = xerrors.New("did is not a did:memo or did:mfile identifier")
+
+// DIDDocument is a W3C DID Document, https://www.w3.org/TR/did-core
+type DIDDocument struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	Controller         string               `json:"controller,omitempty"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod,omitempty"`
+	Authentication     []string             `json:"authentication,omitempty"`
+}
+
+type VerificationMethod struct {
+	ID                  string `json:"id"`
+	Type                string `json:"type"`
+	Controller          string `json:"controller"`
+	BlockchainAccountID string `json:"blockchainAccountId,omitempty"`
+	PublicKeyHex        string `json:"publicKeyHex,omitempty"`
+}
+
+type DIDDocumentMetadata struct {
+	Deactivated bool `json:"deactivated"`
+}
+
+// ResolveDID builds the DID Document of a did:memo or did:mfile DID from the
+// contracts. A deactivated DID resolves to a document without keys.
+func (m *MemoDID) ResolveDID(ctx context.Context, didStr string) (*DIDDocument, *DIDDocumentMetadata, error) {
+	switch {
+	case strings.HasPrefix(didStr, "did:memo:"):
+		return m.resolveMemoDID(ctx, didStr)
+	case strings.HasPrefix(didStr, "did:mfile:"):
+		return m.resolveMfileDID(ctx, didStr)
+	default:
+		return nil, nil, ErrInvalidDID
+	}
+}
+
+func (m *MemoDID) resolveMemoDID(ctx context.Context, didStr string) (*DIDDocument, *DIDDocumentMetadata, error) {
+	did, err := types.ParseMemoDID(didStr)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%s: %w", err, ErrInvalidDID)
+	}
+
+	status, err := m.GetDIDStatus(ctx, did.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &DIDDocument{
+		Context: []string{contract.DefaultContext},
+		ID:      did.String(),
+	}
+	if status == DIDStatusDeactivated {
+		return doc, &DIDDocumentMetadata{Deactivated: true}, nil
+	}
+
+	methods, err := m.Controller.GetVerificationMethods(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, nil, err
+	}
+
+	for i, method := range methods {
+		if method.Deactivated {
+			continue
+		}
+
+		controller := method.Controller
+		if controller == "" {
+			controller = did.String()
+		}
+		if i == 0 {
+			doc.Controller = controller
+		}
+
+		vm := VerificationMethod{
+			ID:         did.String() + "#keys-" + strconv.Itoa(i),
+			Type:       method.MethodType,
+			Controller: controller,
+		}
+		if method.MethodType == m.getMethodType("address") && len(method.PubKeyData) == common.AddressLength {
+			vm.BlockchainAccountID = "eip155:" + m.Controller.ChainID().String() + ":" + common.BytesToAddress(method.PubKeyData).Hex()
+		} else {
+			vm.PublicKeyHex = strings.TrimPrefix(hexutil.Encode(method.PubKeyData), "0x")
+		}
+
+		doc.VerificationMethod = append(doc.VerificationMethod, vm)
+		doc.Authentication = append(doc.Authentication, vm.ID)
+	}
+
+	return doc, &DIDDocumentMetadata{}, nil
+}
+
+func (m *MemoDID) resolveMfileDID(ctx context.Context, didStr string) (*DIDDocument, *DIDDocumentMetadata, error) {
+	mfile, err := types.ParseMfileDID(didStr)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%s: %w", err, ErrInvalidDID)
+	}
+
+	controller, deactivated, err := m.Controller.GetMfileController(ctx, mfile.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, nil, err
+	}
+	if controller == "" {
+		return nil, nil, ErrDIDNotFound
+	}
+	if !strings.HasPrefix(controller, "did:") {
+		controller = memoDIDString(controller)
+	}
+
+	doc := &DIDDocument{
+		Context:    []string{contract.DefaultContext},
+		ID:         mfile.String(),
+		Controller: controller,
+	}
+
+	return doc, &DIDDocumentMetadata{Deactivated: deactivated}, nil
+}
@@ -0,0 +1,36 @@
+package did
+
+import (
+	"github.com/did-server/internal/database"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+var ErrIndexerDisabled = xerrors.New("event indexer is disabled")
+
+// DIDEvents returns the indexed contract events of a did:memo DID, those of
+// the mfile DIDs it controls included, and the newest indexed block
+func (m *MemoDID) DIDEvents(didStr, name string, offset, limit int) ([]database.Event, uint64, error) {
+	if m.Indexer == nil {
+		return nil, 0, ErrIndexerDisabled
+	}
+
+	did, err := types.ParseMemoDID(didStr)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("%s: %w", err, ErrInvalidDID)
+	}
+
+	events, err := m.Indexer.Events(did.Identifier, name, offset, limit)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, 0, err
+	}
+
+	head, err := m.Indexer.Head()
+	if err != nil {
+		m.logger.Error(err)
+		return nil, 0, err
+	}
+
+	return events, head, nil
+}
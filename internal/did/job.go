@@ -0,0 +1,291 @@
+package did
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+var jobPollInterval = 5 * time.Second
+
+// jobClaimTimeout is how long a job may stay claimed before it is taken as
+// left by a worker that stopped while sending it, and is queued again. Its
+// DID then resolves as existed if the transaction went through.
+var jobClaimTimeout = 10 * time.Minute
+
+// EnqueueRegisterDID stores a registration job and returns at once, the
+// transaction is sent by RunJobs
+func (m *MemoDID) EnqueueRegisterDID(ctx context.Context, kind, addressStr string, sig []byte) (*database.Job, error) {
+	did, err := m.CreateDIDByAddress(ctx, addressStr)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
+
+	job, err := m.db.CreateJob(kind, addressStr, did.String(), sig)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
+
+	m.wakeJobs()
+
+	return job, nil
+}
+
+func (m *MemoDID) wakeJobs() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MemoDID) GetJob(jobID string) (*database.Job, error) {
+	return m.db.GetJob(jobID)
+}
+
+// RunJobs processes queued registrations until ctx is done. Number
+// reservations left by a restart are reconciled with the chain, and jobs
+// whose transaction was submitted before it resume receipt polling first.
+// Transactions are sent one by one, but up to the job concurrency of them may
+// wait for their receipt at the same time.
+func (m *MemoDID) RunJobs(ctx context.Context) {
+	inflight := make(chan struct{}, m.concurrency)
+
+	err := m.ReconcileNumbers(ctx)
+	if err != nil {
+		m.logger.Error(err)
+	}
+
+	submitted, err := m.db.ListJobs(database.JobSubmitted, -1)
+	if err != nil {
+		m.logger.Error(err)
+	}
+	for i := range submitted {
+		m.logger.Infof("resume job %s tx %s", submitted[i].JobID, submitted[i].TxHash)
+		inflight <- struct{}{}
+		go func(job *database.Job) {
+			defer func() { <-inflight }()
+			m.waitJob(ctx, job)
+		}(&submitted[i])
+	}
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.runPendingJobs(ctx, inflight)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runPendingJobs sends pending jobs until none is left. Every replica sharing
+// the database runs it, a job is claimed before it is sent so that only one
+// of them sends it.
+func (m *MemoDID) runPendingJobs(ctx context.Context, inflight chan struct{}) {
+	released, err := m.db.ReleaseClaimedJobs(time.Now().Add(-jobClaimTimeout))
+	if err != nil {
+		m.logger.Error(err)
+	}
+	if released > 0 {
+		m.logger.Warnf("%d jobs claimed for %s queued again", released, jobClaimTimeout)
+	}
+
+	for ctx.Err() == nil {
+		// jobs stay queued until the admin account is funded again
+		if m.Controller.Balance().Get().Low {
+			return
+		}
+
+		jobs, err := m.db.ListJobs(database.JobPending, 1)
+		if err != nil || len(jobs) == 0 {
+			return
+		}
+
+		ok, err := m.db.ClaimJob(jobs[0].JobID)
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+		jobs[0].Status = database.JobClaimed
+
+		inflight <- struct{}{}
+		if !m.runJob(ctx, &jobs[0]) {
+			<-inflight
+			continue
+		}
+
+		go func(job *database.Job) {
+			defer func() { <-inflight }()
+			m.waitJob(ctx, job)
+		}(&jobs[0])
+	}
+}
+
+// runJob sends the transaction of a pending job, it returns true if the
+// job was submitted and needs to wait for its receipt
+func (m *MemoDID) runJob(ctx context.Context, job *database.Job) bool {
+	txHash, err := m.submitJob(ctx, job)
+	if err != nil {
+		if job.Number != 0 {
+			m.settleNumber(job.DID, job.Number, err)
+		}
+		if strings.Contains(err.Error(), "existed") {
+			m.skipJob(ctx, job)
+			return false
+		}
+		m.failJob(ctx, job, err)
+		return false
+	}
+
+	// the job must not stay claimed, it would be sent again. If ctx is done
+	// first it is, once its claim times out, and its number is resolved as
+	// existed.
+	job.TxHash = txHash.Hex()
+	job.Status = database.JobSubmitted
+	err = m.saveJob(ctx, job)
+	if err != nil {
+		m.logger.Error(err)
+	}
+
+	return true
+}
+
+// skipJob settles a job whose DID was already registered on chain, by an
+// earlier run of it or by another registration. Nothing was sent, the
+// number the DID has on chain is recorded as its own.
+func (m *MemoDID) skipJob(ctx context.Context, job *database.Job) {
+	job.Status = database.JobSkipped
+	job.Number = 0
+
+	if job.Kind != database.JobRegisterDIDTon {
+		num, err := m.chainNumber(ctx, job.DID)
+		if err != nil {
+			m.logger.Warnf("job %s: number of %s on chain: %s", job.JobID, job.DID, err)
+			job.Error = err.Error()
+		} else {
+			job.Number = num
+		}
+	}
+
+	err := m.saveJob(ctx, job)
+	if err != nil {
+		m.logger.Error(err)
+	}
+}
+
+// chainNumber records the number did registered with on chain and returns it
+func (m *MemoDID) chainNumber(ctx context.Context, didStr string) (int, error) {
+	did, err := types.ParseMemoDID(didStr)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := m.Controller.GetDIDNumber(ctx, did.Identifier)
+	if err != nil {
+		return 0, err
+	}
+	if number.Sign() == 0 || !number.IsInt64() {
+		return 0, xerrors.Errorf("%s has number %s on chain", didStr, number)
+	}
+
+	num := int(number.Int64())
+	return num, m.db.SetDIDNumber(didStr, num)
+}
+
+// saveJob writes job until it succeeds or ctx is done
+func (m *MemoDID) saveJob(ctx context.Context, job *database.Job) error {
+	for {
+		err := m.db.UpdateJob(job)
+		if err == nil {
+			return nil
+		}
+		m.logger.Errorf("save job %s: %s", job.JobID, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+func (m *MemoDID) submitJob(ctx context.Context, job *database.Job) (common.Hash, error) {
+	did, err := types.ParseMemoDID(job.DID)
+	if err != nil {
+		m.logger.Error(err)
+		return common.Hash{}, err
+	}
+
+	address := common.HexToAddress(job.Address)
+
+	if job.Kind == database.JobRegisterDIDTon {
+		return m.Controller.SubmitRegisterDIDByTonAdmin(ctx, did.Identifier, m.getMethodType("ton"), address.Bytes())
+	}
+
+	// a job run again after a restart gets its reservation back
+	num, err := m.db.ReserveNumber(job.DID)
+	if err != nil {
+		m.logger.Error(err)
+		return common.Hash{}, err
+	}
+	job.Number = num
+
+	m.logger.Info("register did: ", job.DID, " number: ", num)
+
+	if job.Kind == database.JobRegisterDIDAdmin {
+		return m.Controller.SubmitRegisterDIDByAdmin(ctx, did.Identifier, m.getMethodType("address"), address.Bytes(), big.NewInt(int64(num)))
+	}
+
+	return m.Controller.SubmitRegisterDID(ctx, did.Identifier, m.getMethodType("address"), address.Bytes(), job.Sig, big.NewInt(int64(num)))
+}
+
+func (m *MemoDID) waitJob(ctx context.Context, job *database.Job) {
+	err := m.Controller.CheckTx(ctx, common.HexToHash(job.TxHash), "RegisterDID")
+	if err != nil {
+		// stopped, the job stays submitted and is waited for on restart
+		if ctx.Err() != nil {
+			return
+		}
+		if job.Kind != database.JobRegisterDIDTon {
+			m.settleNumber(job.DID, job.Number, err)
+		}
+		m.failJob(ctx, job, err)
+		return
+	}
+
+	if job.Kind != database.JobRegisterDIDTon {
+		m.settleNumber(job.DID, job.Number, nil)
+	}
+
+	// a job left submitted is waited for again on restart
+	job.Status = database.JobMined
+	err = m.saveJob(ctx, job)
+	if err != nil {
+		m.logger.Error(err)
+	}
+}
+
+func (m *MemoDID) failJob(ctx context.Context, job *database.Job, err error) {
+	m.logger.Errorf("job %s failed: %s", job.JobID, err)
+	job.Status = database.JobFailed
+	job.Error = err.Error()
+	serr := m.saveJob(ctx, job)
+	if serr != nil {
+		m.logger.Error(serr)
+	}
+}
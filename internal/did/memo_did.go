@@ -6,58 +6,76 @@ import (
 	"encoding/hex"
 	"math/big"
 	"strings"
+	"sync"
 
+	"github.com/did-server/config"
 	"github.com/did-server/internal/contract"
 	"github.com/did-server/internal/database"
+	"github.com/did-server/internal/indexer"
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
 
-	com "github.com/memoio/contractsv2/common"
 	"github.com/memoio/go-did/types"
 )
 
 type MemoDID struct {
-	Controller *contract.Controller
-	chain      string
-	logger     *log.Helper
-	db         *database.DataBase
+	Controller  *contract.Controller
+	Indexer     *indexer.Indexer // nil unless enabled
+	chain       string
+	logger      *log.Helper
+	db          *database.DataBase
+	wake        chan struct{}
+	concurrency int
+
+	reconcileLock sync.Mutex
+	lastReconcile *ReconcileReport
 }
 
-func NewMemoDID(chain string, logger *log.Helper) (*MemoDID, error) {
-	controller, err := contract.NewController(chain, logger)
+func NewMemoDID(cfg *config.Config, logger *log.Helper) (*MemoDID, error) {
+	controller, err := contract.NewController(&cfg.Chain, &cfg.Signer, logger)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
 	}
 
-	db, err := database.CreateDB(logger)
+	return NewMemoDIDWithController(cfg, controller, logger)
+}
+
+// NewMemoDIDWithController uses controller for the chain, e.g. one on a
+// simulated backend
+func NewMemoDIDWithController(cfg *config.Config, controller *contract.Controller, logger *log.Helper) (*MemoDID, error) {
+	db, err := database.CreateDB(&cfg.Database, logger)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
 	}
 
+	var idx *indexer.Indexer
+	if cfg.Indexer.Enabled {
+		idx, err = indexer.New(controller, db, &cfg.Indexer, logger)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+	}
+
 	return &MemoDID{
-		Controller: controller,
-		chain:      chain,
-		logger:     logger,
-		db:         db,
+		Controller:  controller,
+		Indexer:     idx,
+		chain:       cfg.Chain.Name,
+		logger:      logger,
+		db:          db,
+		wake:        make(chan struct{}, 1),
+		concurrency: cfg.Job.Concurrency,
 	}, nil
 }
 
 // Create unregistered DID
-func (m *MemoDID) CreateDIDByPubKey(publicKeyStr string) (*types.MemoDID, error) {
-	_, endpoint := com.GetInsEndPointByChain(m.chain)
-
-	client, err := ethclient.DialContext(context.TODO(), endpoint)
-	if err != nil {
-		m.logger.Error(err)
-		return nil, err
-	}
-	defer client.Close()
-
+func (m *MemoDID) CreateDIDByPubKey(ctx context.Context, publicKeyStr string) (*types.MemoDID, error) {
 	publicKeyECDSA, err := m.publickeyFromString(publicKeyStr)
 	if err != nil {
 		m.logger.Error(err)
@@ -65,7 +83,7 @@ func (m *MemoDID) CreateDIDByPubKey(publicKeyStr string) (*types.MemoDID, error)
 	}
 
 	address := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.TODO(), address)
+	nonce, err := m.Controller.Backend().PendingNonceAt(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return nil, err
@@ -80,18 +98,9 @@ func (m *MemoDID) CreateDIDByPubKey(publicKeyStr string) (*types.MemoDID, error)
 	}, nil
 }
 
-func (m *MemoDID) CreateDIDByAddress(addressStr string) (*types.MemoDID, error) {
-	_, endpoint := com.GetInsEndPointByChain(m.chain)
-
-	client, err := ethclient.DialContext(context.TODO(), endpoint)
-	if err != nil {
-		m.logger.Error(err)
-		return nil, err
-	}
-	defer client.Close()
-
+func (m *MemoDID) CreateDIDByAddress(ctx context.Context, addressStr string) (*types.MemoDID, error) {
 	address := common.HexToAddress(addressStr)
-	nonce, err := client.PendingNonceAt(context.TODO(), address)
+	nonce, err := m.Controller.Backend().PendingNonceAt(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return nil, err
@@ -106,27 +115,38 @@ func (m *MemoDID) CreateDIDByAddress(addressStr string) (*types.MemoDID, error)
 	}, nil
 }
 
-func (m *MemoDID) GetDIDNumber() (int, error) {
-	num, err := m.db.GetNumber()
+func (m *MemoDID) RegisterDIDByAddress(ctx context.Context, addressStr string, sig []byte) (string, error) {
+	did, err := m.CreateDIDByAddress(ctx, addressStr)
 	if err != nil {
 		m.logger.Error(err)
-		return 0, err
+		return "", err
 	}
 
-	return num, nil
-}
+	address := common.HexToAddress(addressStr)
 
-func (m *MemoDID) AddDIDNumber(address string, num int) error {
-	did, err := m.CreateDIDByAddress(address)
+	num, err := m.db.ReserveNumber(did.String())
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return "", err
 	}
 
-	return m.db.AddNumber(did.String(), num)
+	m.logger.Info("register did: ", did.String(), " number: ", num)
+
+	err = m.Controller.RegisterDID(ctx, did.Identifier, m.getMethodType("address"), address.Bytes(), sig, big.NewInt(int64(num)))
+	m.settleNumber(did.String(), num, err)
+	if err != nil {
+		if strings.Contains(err.Error(), "existed") {
+			return did.String(), nil
+		}
+		m.logger.Error(err)
+		return "", err
+	}
+
+	return did.String(), nil
 }
-func (m *MemoDID) RegisterDIDByAddress(addressStr string, sig []byte) (string, error) {
-	did, err := m.CreateDIDByAddress(addressStr)
+
+func (m *MemoDID) RegisterDIDByAddressByAdmin(ctx context.Context, addressStr string) (string, error) {
+	did, err := m.CreateDIDByAddress(ctx, addressStr)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
@@ -134,7 +154,7 @@ func (m *MemoDID) RegisterDIDByAddress(addressStr string, sig []byte) (string, e
 
 	address := common.HexToAddress(addressStr)
 
-	num, err := m.db.GetNumber()
+	num, err := m.db.ReserveNumber(did.String())
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
@@ -142,7 +162,8 @@ func (m *MemoDID) RegisterDIDByAddress(addressStr string, sig []byte) (string, e
 
 	m.logger.Info("register did: ", did.String(), " number: ", num)
 
-	err = m.Controller.RegisterDID(did.Identifier, m.getMethodType("address"), address.Bytes(), sig, big.NewInt(int64(num)))
+	err = m.Controller.RegisterDIDByAdmin(ctx, did.Identifier, m.getMethodType("address"), address.Bytes(), big.NewInt(int64(num)))
+	m.settleNumber(did.String(), num, err)
 	if err != nil {
 		if strings.Contains(err.Error(), "existed") {
 			return did.String(), nil
@@ -151,107 +172,155 @@ func (m *MemoDID) RegisterDIDByAddress(addressStr string, sig []byte) (string, e
 		return "", err
 	}
 
-	err = m.db.AddNumber(did.String(), num)
+	return did.String(), nil
+}
+
+func (m *MemoDID) RegisterDIDByTomAdmin(ctx context.Context, addressStr string) (string, error) {
+	did, err := m.CreateDIDByAddress(ctx, addressStr)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	return did.String(), nil
-}
+	address := common.HexToAddress(addressStr)
 
-func (m *MemoDID) RegisterDIDByAddressByAdmin(addressStr string) (string, error) {
-	did, err := m.CreateDIDByAddress(addressStr)
+	err = m.Controller.RegisterDIDByTonAdmin(ctx, did.Identifier, m.getMethodType("ton"), address.Bytes())
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	address := common.HexToAddress(addressStr)
+	return did.String(), nil
+}
 
-	num, err := m.db.GetNumber()
+func (m *MemoDID) RegisterDIDByPublic(ctx context.Context, publicKeyStr string, sig []byte) (string, error) {
+	did, err := m.CreateDIDByPubKey(ctx, publicKeyStr)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	m.logger.Info("register did: ", did.String(), " number: ", num)
-
-	err = m.Controller.RegisterDIDByAdmin(did.Identifier, m.getMethodType("address"), address.Bytes(), big.NewInt(int64(num)))
+	publicKeyByte, err := hexutil.Decode(publicKeyStr)
 	if err != nil {
-		if strings.Contains(err.Error(), "existed") {
-			return did.String(), nil
-		}
 		m.logger.Error(err)
 		return "", err
 	}
 
-	err = m.db.AddNumber(did.String(), num)
+	num, err := m.db.ReserveNumber(did.String())
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
+	err = m.Controller.RegisterDID(ctx, did.Identifier, m.getMethodType("pubkey"), publicKeyByte, sig, big.NewInt(int64(num)))
+	m.settleNumber(did.String(), num, err)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
 	return did.String(), nil
 }
 
-func (m *MemoDID) RegisterDIDByTomAdmin(addressStr string) (string, error) {
-	did, err := m.CreateDIDByAddress(addressStr)
+var (
+	ErrDIDNotFound    = xerrors.New("did not found")
+	ErrDIDDeactivated = xerrors.New("did is deactivated")
+)
+
+const (
+	DIDStatusActive      = "active"
+	DIDStatusDeactivated = "deactivated"
+)
+
+// GetDIDStatus returns DIDStatusActive or DIDStatusDeactivated, or
+// ErrDIDNotFound if the DID was never registered
+func (m *MemoDID) GetDIDStatus(ctx context.Context, didStr string) (string, error) {
+	did, err := types.ParseMemoDID(didStr)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	address := common.HexToAddress(addressStr)
+	verify, err := m.Controller.GetDIDVerify(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+	if verify == 0 {
+		return "", ErrDIDNotFound
+	}
 
-	err = m.Controller.RegisterDIDByTonAdmin(did.Identifier, m.getMethodType("ton"), address.Bytes())
+	deactivated, err := m.Controller.GetDIDStatus(ctx, didStr)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
+	if deactivated {
+		return DIDStatusDeactivated, nil
+	}
 
-	return did.String(), nil
+	return DIDStatusActive, nil
 }
 
-func (m *MemoDID) RegisterDIDByPublic(publicKeyStr string, sig []byte) (string, error) {
-	did, err := m.CreateDIDByPubKey(publicKeyStr)
+// DeactivateDID checks sig over the message of GetDeleteSignatureMassage
+// against the key controlling the DID, deactivates it on chain and marks it
+// in the database. Like GetDeleteSignatureMassage it takes a full did:memo
+// or a bare identifier.
+func (m *MemoDID) DeactivateDID(ctx context.Context, didStr string, sig []byte) error {
+	didI, err := didIdentifier(didStr)
 	if err != nil {
 		m.logger.Error(err)
-		return "", err
+		return err
+	}
+	did, err := types.ParseMemoDID(memoDIDString(didI))
+	if err != nil {
+		m.logger.Error(err)
+		return err
 	}
 
-	publicKeyByte, err := hexutil.Decode(publicKeyStr)
+	status, err := m.GetDIDStatus(ctx, did.String())
+	if err != nil {
+		return err
+	}
+	if status == DIDStatusDeactivated {
+		return ErrDIDDeactivated
+	}
+
+	nonce, err := m.Controller.GetNonce(ctx, did.Identifier)
 	if err != nil {
 		m.logger.Error(err)
-		return "", err
+		return err
 	}
 
-	num, err := m.db.GetNumber()
+	hash, err := m.getDeleteDIDHash(did.Identifier, nonce)
 	if err != nil {
 		m.logger.Error(err)
-		return "", err
+		return err
 	}
 
-	err = m.Controller.RegisterDID(did.Identifier, m.getMethodType("pubkey"), publicKeyByte, sig, big.NewInt(int64(num)))
+	hashB := hexutil.MustDecode(hash)
+	err = m.verifyController(ctx, did.Identifier, sig, hashB, accounts.TextHash(hashB))
 	if err != nil {
 		m.logger.Error(err)
-		return "", err
+		return err
 	}
-	return did.String(), nil
-}
 
-func (m *MemoDID) GetDIDStatus() {
+	err = m.Controller.DeleteDID(ctx, did.Identifier, sig)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
 
+	return m.db.SetDeactivated(did.String())
 }
 
-func (m *MemoDID) GetDIDInfo(address string) (string, string, error) {
-	did, err := m.CreateDIDByAddress(address)
+func (m *MemoDID) GetDIDInfo(ctx context.Context, address string) (string, string, error) {
+	did, err := m.CreateDIDByAddress(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return "", "", err
 	}
 
-	number, err := m.Controller.GetDIDInfo(did.Identifier)
+	number, err := m.Controller.GetDIDInfo(ctx, did.Identifier)
 	if err != nil {
 		m.logger.Error(err)
 		return "", "", err
@@ -260,14 +329,14 @@ func (m *MemoDID) GetDIDInfo(address string) (string, string, error) {
 	return did.String(), number, nil
 }
 
-func (m *MemoDID) GetDIDExist(address string) (int, error) {
-	did, err := m.CreateDIDByAddress(address)
+func (m *MemoDID) GetDIDExist(ctx context.Context, address string) (int, error) {
+	did, err := m.CreateDIDByAddress(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return 0, err
 	}
 
-	number, err := m.Controller.GetDIDVerify(did.Identifier)
+	number, err := m.Controller.GetDIDVerify(ctx, did.Identifier)
 	if err != nil {
 		m.logger.Error(err)
 		return 0, err
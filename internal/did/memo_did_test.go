@@ -1,12 +1,21 @@
 package did
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/did-server/config"
+	"github.com/did-server/internal/contract"
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	klog "github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
 )
 
 const (
@@ -17,18 +26,28 @@ const (
 	address1   = "0x594CE7BA907710f5647C6ec58db168B0a2686de4"
 )
 
+// testConfig reads the admin key from DID_PRIVATE_KEY
+func testConfig(chain string) *config.Config {
+	cfg, err := config.Load("")
+	if err != nil {
+		panic(err)
+	}
+	cfg.Chain.Name = chain
+	return cfg
+}
+
 func TestCreateDID(t *testing.T) {
 	logger := klog.With(klog.NewStdLogger(os.Stdout),
 		"ts", klog.DefaultTimestamp,
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.CreateDIDByAddress(address)
+	did, err := memoDID.CreateDIDByAddress(context.Background(), address)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,19 +62,19 @@ func TestGetNonce(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("product", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("product"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.CreateDIDByAddress(addr)
+	did, err := memoDID.CreateDIDByAddress(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	t.Logf("endpoint: %s, ins: %s, proxy: %s, account: %s", memoDID.Controller.EndPoint(), memoDID.Controller.Instance().String(), memoDID.Controller.Proxy().String(), memoDID.Controller.Account().String())
 
-	nonce, err := memoDID.Controller.GetNonce(did.Identifier)
+	nonce, err := memoDID.Controller.GetNonce(context.Background(), did.Identifier)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -69,17 +88,17 @@ func TestRegisterDID(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.CreateDIDByAddress(address1)
+	did, err := memoDID.CreateDIDByAddress(context.Background(), address1)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	nonce, err := memoDID.Controller.GetNonce(did.String())
+	nonce, err := memoDID.Controller.GetNonce(context.Background(), did.String())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -105,7 +124,7 @@ func TestRegisterDID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	didStr, err := memoDID.RegisterDIDByPublic(publickey, sig)
+	didStr, err := memoDID.RegisterDIDByPublic(context.Background(), publickey, sig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -121,18 +140,18 @@ func TestGetHashByAddress(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.CreateDIDByAddress(addr)
+	did, err := memoDID.CreateDIDByAddress(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Log("did:", did.String())
 
-	nonce, err := memoDID.Controller.GetNonce(did.Identifier)
+	nonce, err := memoDID.Controller.GetNonce(context.Background(), did.Identifier)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -154,18 +173,18 @@ func TestRegisterDIDByAddress(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.CreateDIDByAddress(addr)
+	did, err := memoDID.CreateDIDByAddress(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Log("did:", did.String())
 
-	didStr, err := memoDID.RegisterDIDByAddressByAdmin(addr)
+	didStr, err := memoDID.RegisterDIDByAddressByAdmin(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -180,12 +199,12 @@ func TestGetDIDInfo(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, number, err := memoDID.GetDIDInfo(addr)
+	did, number, err := memoDID.GetDIDInfo(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -200,12 +219,12 @@ func TestGetDIDExist(t *testing.T) {
 		"caller", klog.DefaultCaller,
 	)
 
-	memoDID, err := NewMemoDID("dev", klog.NewHelper(logger))
+	memoDID, err := NewMemoDID(testConfig("dev"), klog.NewHelper(logger))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	did, err := memoDID.GetDIDExist(addr)
+	did, err := memoDID.GetDIDExist(context.Background(), addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -214,5 +233,232 @@ func TestGetDIDExist(t *testing.T) {
 }
 
 func TestParseMfileDID(t *testing.T) {
-	
-}
\ No newline at end of file
+
+}
+
+func TestVerifyDeleteSignature(t *testing.T) {
+	sk, err := crypto.HexToECDSA(privatekey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := crypto.Keccak256([]byte("deleteDID"))
+	sig, err := crypto.Sign(hash, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	signer, err := recoverAddress(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byAddress, err := verificationAddress("EcdsaSecp256k1RecoveryMethod2020", hexutil.MustDecode(address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPubKey, err := verificationAddress("EcdsaSecp256k1VerificationKey2019", hexutil.MustDecode(publickey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signer != byAddress || signer != byPubKey {
+		t.Fatalf("signer %s, address method %s, pubkey method %s", signer, byAddress, byPubKey)
+	}
+}
+
+func TestVerificationKey(t *testing.T) {
+	tests := []struct {
+		mtype string
+		key   string
+		size  int
+	}{
+		{"address", address, 20},
+		{"pubkey", publickey, 33},
+		{"ton", "f7d6c1b9a08aaa5f9b0e4a3c44fcbcc6a2c4e0e4b1a0f0f3a3b2e1c1d0e0f0a1", 32},
+		{"ton", "0x1234", 0},
+		{"pubkey", address, 0},
+		{"address", "0x1234", 0},
+		{"rsa", address, 0},
+	}
+
+	for _, test := range tests {
+		data, err := verificationKey(test.mtype, test.key)
+		if test.size == 0 {
+			if !errors.Is(err, ErrInvalidVerificationMethod) {
+				t.Fatalf("%s %s accepted", test.mtype, test.key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != test.size {
+			t.Fatalf("%s key has %d bytes, want %d", test.mtype, len(data), test.size)
+		}
+	}
+}
+
+func TestDownloadChallenge(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+	db, err := database.CreateDB(&cfg.Database, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MemoDID{logger: logger, db: db}
+
+	mdid := "did:mfile:cid:bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy"
+	did := "did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac"
+	sk, err := crypto.HexToECDSA(privatekey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(c *Challenge) []byte {
+		sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(c.Msg)), sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	// signed by the key of address, not address1
+	c, err := m.NewDownloadChallenge(mdid, address1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckMfileRead(context.Background(), mdid, did, address1, c.Nonce, sign(c))
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("challenge of another address accepted: %v", err)
+	}
+
+	// a challenge is checked once, whatever the outcome
+	err = m.CheckMfileRead(context.Background(), mdid, did, address1, c.Nonce, sign(c))
+	if !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("challenge used twice: %v", err)
+	}
+
+	// issued for another mfile
+	c, err = m.NewDownloadChallenge(mdid, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckMfileRead(context.Background(), "did:mfile:cid:other", did, address, c.Nonce, sign(c))
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("challenge of another mfile accepted: %v", err)
+	}
+
+	err = m.CheckMfileRead(context.Background(), mdid, did, address, "unknown", sign(c))
+	if !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("challenge never issued accepted: %v", err)
+	}
+
+	ttl := ChallengeTTL
+	ChallengeTTL = -time.Minute
+	defer func() { ChallengeTTL = ttl }()
+	c, err = m.NewDownloadChallenge(mdid, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckMfileRead(context.Background(), mdid, did, address, c.Nonce, sign(c))
+	if !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("expired challenge accepted: %v", err)
+	}
+}
+
+func TestFileChallenge(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+	db, err := database.CreateDB(&cfg.Database, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MemoDID{logger: logger, db: db}
+
+	sk, err := crypto.HexToECDSA(privatekey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.NewFileChallenge(FileDelete, address, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(c.Msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.CheckFile(FileDelete, address, "b.txt", c.Nonce, sig)
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("challenge of another file accepted: %v", err)
+	}
+
+	c, err = m.NewFileChallenge(FileDelete, address, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = crypto.Sign(accounts.TextHash(hexutil.MustDecode(c.Msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckFile(FileDelete, address, "a.txt", c.Nonce, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckFile(FileDelete, address, "a.txt", c.Nonce, sig)
+	if !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("challenge used twice: %v", err)
+	}
+
+	c, err = m.NewFileChallenge(FileUpload, address, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = crypto.Sign(accounts.TextHash(hexutil.MustDecode(c.Msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CheckFile(FileDelete, address, "a.txt", c.Nonce, sig)
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("upload challenge accepted for a delete: %v", err)
+	}
+
+	_, err = m.NewFileChallenge("rename", address, "a.txt")
+	if !errors.Is(err, ErrFileAction) {
+		t.Fatalf("challenge of an unknown action: %v", err)
+	}
+}
+
+func TestNumberFree(t *testing.T) {
+	tests := []struct {
+		err  error
+		free bool
+	}{
+		{&contract.RevertError{Reason: "existed"}, true},
+		{xerrors.New("insufficient funds for gas * price + value"), true},
+		{xerrors.Errorf("RegisterDID: transaction(0x01): %w", contract.ErrTxDropped), false},
+		{xerrors.Errorf("RegisterDID: transaction(0x01): %w", contract.ErrTxReplaced), false},
+		{xerrors.Errorf("RegisterDID: transaction(0x01): %w", contract.ErrTxPending), false},
+		{context.DeadlineExceeded, false},
+	}
+
+	for _, test := range tests {
+		if numberFree(test.err) != test.free {
+			t.Fatalf("%v frees the number: %t", test.err, !test.free)
+		}
+	}
+}
+
+func TestResolveInvalidDID(t *testing.T) {
+	memoDID := &MemoDID{logger: klog.NewHelper(klog.NewStdLogger(os.Stdout))}
+
+	for _, didStr := range []string{"", "did:example:123", "memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac"} {
+		_, _, err := memoDID.ResolveDID(context.Background(), didStr)
+		if !errors.Is(err, ErrInvalidDID) {
+			t.Fatalf("resolve %q: %v", didStr, err)
+		}
+	}
+}
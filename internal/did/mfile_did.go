@@ -1,9 +1,30 @@
 package did
 
 import (
+	"context"
+	"errors"
 	"math/big"
+	"time"
 
+	"github.com/did-server/internal/contract"
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+// mfileSubmitTimeout is how long a submitted mfile may have no tx hash
+// before its submit is taken as lost, e.g. in a crash
+var mfileSubmitTimeout = time.Minute
+
+var (
+	ErrMfileNotFound    = xerrors.New("mfile did not found")
+	ErrMfileRegistered  = xerrors.New("mfile did already registered")
+	ErrMfileRegistering = xerrors.New("mfile did registration in progress")
+	ErrMfileTaken       = xerrors.New("mfile did created by another uploader")
+	ErrNotController    = xerrors.New("address is not the controller of the did")
 )
 
 func (m *MemoDID) CreateMfileDID(cid string) (*types.MfileDID, error) {
@@ -14,47 +35,204 @@ func (m *MemoDID) CreateMfileDID(cid string) (*types.MfileDID, error) {
 	}, nil
 }
 
-func (m *MemoDID) CreateMfileInfo(address, cid string, price *big.Int) error {
-	did, err := m.CreateDIDByAddress(address)
+// CreateMfileInfo stores the metadata of an uploaded file and returns its
+// mfile DID with the message its controller signs to register it. address
+// must control the DID. Creating it again before it is registered replaces
+// price and keywords, only for the same uploader.
+func (m *MemoDID) CreateMfileInfo(ctx context.Context, address, didStr, cid string, price *big.Int, keywords []string) (string, string, error) {
+	did, err := types.ParseMemoDID(didStr)
+	if err != nil {
+		m.logger.Error(err)
+		return "", "", err
+	}
+
+	controller, err := m.controllerAddress(ctx, did.Identifier)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return "", "", err
+	}
+	if controller != common.HexToAddress(address) {
+		return "", "", ErrNotController
 	}
 
 	mfile, err := m.CreateMfileDID(cid)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return "", "", err
 	}
 
-	return m.db.CreateMfileInfo(address, did.String(), mfile.String(), price)
-} 
+	old, err := m.db.GetMfileInfo(mfile.String())
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return "", "", err
+	}
+	if err == nil {
+		switch old.Status {
+		case database.MfileRegistered:
+			return "", "", ErrMfileRegistered
+		case database.MfileSubmitted:
+			return "", "", ErrMfileRegistering
+		}
+		if common.HexToAddress(old.Address) != controller {
+			return "", "", ErrMfileTaken
+		}
+	}
 
-func (m *MemoDID) RegisterMfileDID(mdidString string, sig []byte) error {
+	message, err := m.CreateMDIDMessage(ctx, mfile.Identifier, did.Identifier, price, keywords)
+	if err != nil {
+		m.logger.Error(err)
+		return "", "", err
+	}
+
+	err = m.db.SaveMfileInfo(&database.MfileInfo{
+		Address:  address,
+		DID:      did.String(),
+		MDID:     mfile.String(),
+		Price:    database.NewBigInt(price),
+		Keywords: keywords,
+		Message:  message,
+		Status:   database.MfileCreated,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return mfile.String(), message, nil
+}
+
+func (m *MemoDID) GetMfileInfo(mdidString string) (*database.MfileInfo, error) {
 	minfo, err := m.db.GetMfileInfo(mdidString)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrMfileNotFound
+	}
+	return minfo, err
+}
+
+// RegisterMfileDID checks sig over the stored message against the controller
+// of the DID and registers the mfile DID on chain. Confirming a registered
+// mfile again returns its row without sending anything, confirming a
+// submitted one checks its transaction again.
+func (m *MemoDID) RegisterMfileDID(ctx context.Context, mdidString string, sig []byte) (*database.MfileInfo, error) {
+	minfo, err := m.GetMfileInfo(mdidString)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return nil, err
 	}
 
+	switch minfo.Status {
+	case database.MfileRegistered:
+		return minfo, nil
+	case database.MfileSubmitted:
+		retry, err := m.resolveSubmittedMfile(ctx, minfo)
+		if !retry {
+			return minfo, err
+		}
+	}
+
+	message, err := hexutil.Decode(minfo.Message)
+	if err != nil {
+		m.logger.Error(err)
+		return nil, err
+	}
 	did, err := types.ParseMemoDID(minfo.DID)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return nil, err
+	}
+	err = m.verifyController(ctx, did.Identifier, sig, accounts.TextHash(message))
+	if err != nil {
+		return nil, err
 	}
 	mfile, err := types.ParseMfileDID(mdidString)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return nil, err
 	}
 
-	err = m.Controller.RegisterMfile(mfile.Identifier, did.Identifier, minfo.Price, sig)
+	ok, err := m.db.ClaimMfileInfo(mdidString)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return minfo, ErrMfileRegistering
+	}
+	minfo.Status = database.MfileSubmitted
+	minfo.Error = ""
+
+	txHash, err := m.Controller.SubmitRegisterMfile(ctx, mfile.Identifier, did.Identifier, minfo.Price.Int, minfo.Keywords, sig)
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return minfo, m.failMfile(minfo, err)
 	}
 
-	return nil
+	minfo.TxHash = txHash.Hex()
+	err = m.db.UpdateMfileInfo(minfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return minfo, m.confirmMfile(context.WithoutCancel(ctx), minfo)
+}
+
+// resolveSubmittedMfile settles a mfile left submitted by a crash or by a
+// confirmation that timed out. A stored transaction is checked again.
+// Without one, once the submit is surely over, the chain tells whether the
+// mfile was registered, and if not it is failed so that it is submitted
+// again: it returns true then.
+func (m *MemoDID) resolveSubmittedMfile(ctx context.Context, minfo *database.MfileInfo) (bool, error) {
+	if minfo.TxHash != "" {
+		return false, m.confirmMfile(ctx, minfo)
+	}
+	if time.Since(minfo.UpdatedAt) < mfileSubmitTimeout {
+		return false, ErrMfileRegistering
+	}
+
+	mfile, err := types.ParseMfileDID(minfo.MDID)
+	if err != nil {
+		m.logger.Error(err)
+		return false, err
+	}
+	controller, _, err := m.Controller.GetMfileController(ctx, mfile.Identifier)
+	if err != nil {
+		return false, err
+	}
+	if controller != "" {
+		minfo.Status = database.MfileRegistered
+		minfo.Error = ""
+		return false, m.db.UpdateMfileInfo(minfo)
+	}
+
+	m.logger.Warnf("mfile %s submitted without a transaction since %s, submitting again", minfo.MDID, minfo.UpdatedAt)
+	m.failMfile(minfo, xerrors.New("submit interrupted before the transaction was sent"))
+	return true, nil
+}
+
+// confirmMfile waits for the transaction of a submitted mfile. One still
+// pending after the tx timeout leaves it submitted, to be checked again on
+// the next confirmation rather than sent twice.
+func (m *MemoDID) confirmMfile(ctx context.Context, minfo *database.MfileInfo) error {
+	err := m.Controller.CheckTx(ctx, common.HexToHash(minfo.TxHash), "RegisterMfileDid")
+	if errors.Is(err, contract.ErrTxPending) {
+		return ErrMfileRegistering
+	}
+	if err != nil {
+		m.logger.Error(err)
+		return m.failMfile(minfo, err)
+	}
+
+	minfo.Status = database.MfileRegistered
+	minfo.Error = ""
+	return m.db.UpdateMfileInfo(minfo)
+}
+
+// failMfile records err so that the upload can be confirmed again
+func (m *MemoDID) failMfile(minfo *database.MfileInfo, err error) error {
+	minfo.Status = database.MfileFailed
+	minfo.Error = err.Error()
+	uerr := m.db.UpdateMfileInfo(minfo)
+	if uerr != nil {
+		m.logger.Error(uerr)
+	}
+	return err
 }
 
 func ParaseMfileDID(didString string) (*types.MfileDID, error) {
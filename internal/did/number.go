@@ -0,0 +1,142 @@
+package did
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/did-server/internal/contract"
+	"github.com/did-server/internal/database"
+	"github.com/memoio/go-did/types"
+)
+
+// errors of transactions that certainly did not take their number
+var numberFreeErrors = []string{
+	"execution reverted",
+	"existed",
+	"insufficient funds",
+}
+
+// settleNumber marks the number reserved for did used once its registration
+// is mined, released when the transaction certainly did not take it and
+// burned when that is unknown. A dropped or replaced transaction burns its
+// number: the nonce manager keeps sending it with bumped fees until its
+// nonce is mined, and dropped only means some nodes did not see it.
+func (m *MemoDID) settleNumber(did string, num int, err error) {
+	switch {
+	case err == nil:
+		err = m.db.AddNumber(did, num)
+	case numberFree(err):
+		err = m.db.ReleaseNumber(did, num)
+	default:
+		m.logger.Warnf("number %d of %s burned: %s", num, did, err)
+		err = m.db.BurnNumber(did, num)
+	}
+	if err != nil {
+		m.logger.Error(err)
+	}
+}
+
+func numberFree(err error) bool {
+	if errors.Is(err, contract.ErrTxDropped) || errors.Is(err, contract.ErrTxReplaced) {
+		return false
+	}
+	var revert *contract.RevertError
+	if errors.As(err, &revert) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, s := range numberFreeErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDIDNumber returns the number of the DID of address, or the number it
+// would get if it has none yet, without reserving it
+func (m *MemoDID) GetDIDNumber(ctx context.Context, address string) (int, bool, error) {
+	did, err := m.CreateDIDByAddress(ctx, address)
+	if err != nil {
+		m.logger.Error(err)
+		return 0, false, err
+	}
+
+	n, err := m.db.GetDIDNumber(did.String())
+	if err == nil {
+		return n.Num, true, nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		m.logger.Error(err)
+		return 0, false, err
+	}
+
+	num, err := m.db.GetNumber()
+	if err != nil {
+		m.logger.Error(err)
+		return 0, false, err
+	}
+	return num, false, nil
+}
+
+// ReconcileNumbers settles reservations left behind by a restart against
+// the numbers on chain. Reservations of DIDs with a queued job are left to
+// the job. A DID registered on chain, deactivated or not, has its number
+// recorded and a different reserved number released, one not registered
+// releases it.
+func (m *MemoDID) ReconcileNumbers(ctx context.Context) error {
+	reserved, err := m.db.ListReservedNumbers()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range reserved {
+		queued, err := m.db.HasQueuedJob(n.Did)
+		if err != nil {
+			return err
+		}
+		if queued {
+			continue
+		}
+
+		did, err := types.ParseMemoDID(n.Did)
+		if err != nil {
+			m.logger.Error(err)
+			continue
+		}
+
+		number, err := m.Controller.GetDIDNumber(ctx, did.Identifier)
+		if err != nil {
+			m.logger.Warnf("reconcile number %d of %s: %s", n.Num, n.Did, err)
+			continue
+		}
+		if number.Sign() == 0 {
+			err = m.db.ReleaseNumber(n.Did, n.Num)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !number.IsInt64() {
+			m.logger.Warnf("%s has number %s on chain, keeping reserved %d", n.Did, number, n.Num)
+			continue
+		}
+
+		onchain := int(number.Int64())
+		err = m.db.SetDIDNumber(n.Did, onchain)
+		if err != nil {
+			return err
+		}
+		if onchain != n.Num {
+			m.logger.Warnf("%s has number %d on chain, releasing reserved %d", n.Did, onchain, n.Num)
+			err = m.db.ReleaseNumber(n.Did, n.Num)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
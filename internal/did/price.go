@@ -0,0 +1,57 @@
+package did
+
+import (
+	"math/big"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var ErrInvalidPrice = xerrors.New("price is not a decimal amount of wei, gwei or ether")
+
+// priceUnits by decimals, gwei before wei that it ends with
+var priceUnits = []struct {
+	name     string
+	decimals int
+}{
+	{"ether", 18},
+	{"gwei", 9},
+	{"wei", 0},
+}
+
+// ParsePrice reads a price in wei from a decimal amount with an optional
+// unit, e.g. 1000, 1000wei, 1.5gwei or "0.01 ether". An amount without
+// unit is in wei. Amounts with more decimals than the unit are rejected
+// rather than rounded.
+func ParsePrice(s string) (*big.Int, error) {
+	amount := strings.ToLower(strings.TrimSpace(s))
+	decimals := 0
+	for _, unit := range priceUnits {
+		if strings.HasSuffix(amount, unit.name) {
+			amount = strings.TrimSpace(strings.TrimSuffix(amount, unit.name))
+			decimals = unit.decimals
+			break
+		}
+	}
+
+	whole, frac, _ := strings.Cut(amount, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) || len(frac) > decimals {
+		return nil, xerrors.Errorf("%q: %w", s, ErrInvalidPrice)
+	}
+
+	digits := whole + frac + strings.Repeat("0", decimals-len(frac))
+	price, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, xerrors.Errorf("%q: %w", s, ErrInvalidPrice)
+	}
+	return price, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package did
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	above63, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	ethers, _ := new(big.Int).SetString("100000000000000000000000000000", 10)
+
+	for _, tc := range []struct {
+		in   string
+		want *big.Int
+	}{
+		{"1000", big.NewInt(1000)},
+		{"0", big.NewInt(0)},
+		{"1000wei", big.NewInt(1000)},
+		{"1.5gwei", big.NewInt(1500000000)},
+		{" 0.01 ether ", big.NewInt(1e16)},
+		{"1 Ether", big.NewInt(1e18)},
+		{".5gwei", big.NewInt(500000000)},
+		{"123456789012345678901234567890", above63},
+		{"100000000000ether", ethers},
+	} {
+		got, err := ParsePrice(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.in, err)
+		}
+		if got.Cmp(tc.want) != 0 {
+			t.Fatalf("%q: got %s, want %s", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "-1", "+1", "1.5wei", "1e18", "abc", "1.0000000001gwei", ".", "ether", "1.2.3ether", "1 eth"} {
+		_, err := ParsePrice(in)
+		if !errors.Is(err, ErrInvalidPrice) {
+			t.Fatalf("%q: got %v, want ErrInvalidPrice", in, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package did
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/did-server/internal/database"
+	"github.com/memoio/go-did/types"
+)
+
+const reconcilePage = 500
+
+// kinds of mismatches between the numbers DB and the chain
+const (
+	MismatchMissingLocal = "missing_local" // number on chain, none used locally
+	MismatchMissingChain = "missing_chain" // number used locally, none on chain
+	MismatchNumber       = "number"        // numbers differ
+	MismatchDeactivated  = "deactivated"   // deactivated on chain, not locally
+)
+
+type Mismatch struct {
+	DID      string `json:"did"`
+	Kind     string `json:"kind"`
+	Local    int    `json:"local"`
+	Chain    int    `json:"chain"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Conflict is a number held by several DIDs, in the numbers DB or on
+// chain. It is not repaired, one of the registrations has to be undone.
+type Conflict struct {
+	Num    int      `json:"num"`
+	Source string   `json:"source"` // local or chain
+	DIDs   []string `json:"dids"`
+}
+
+type ReconcileReport struct {
+	Repair     bool       `json:"repair"`
+	Checked    int        `json:"checked"`
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Mismatches []Mismatch `json:"mismatches"`
+	Conflicts  []Conflict `json:"conflicts"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt time.Time  `json:"finishedAt"`
+}
+
+// localDID is what the numbers DB holds about one DID
+type localDID struct {
+	num         int
+	reserved    bool
+	deactivated bool
+}
+
+// Reconcile compares every DID in the numbers DB or of a registration job
+// that went through with its number and status on chain, and with repair
+// fixes the DB after the chain. DIDs with a registration in flight are
+// skipped. The number of a DID deactivated on chain is not checked. Numbers
+// used by several DIDs, locally or on chain, are reported as conflicts.
+func (m *MemoDID) Reconcile(ctx context.Context, repair bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{Repair: repair, StartedAt: time.Now()}
+
+	var dids []string
+	local := make(map[string]*localDID)
+	add := func(did string) *localDID {
+		l, ok := local[did]
+		if !ok {
+			l = &localDID{}
+			local[did] = l
+			dids = append(dids, did)
+		}
+		return l
+	}
+	for offset := 0; ; offset += reconcilePage {
+		numbers, err := m.db.ListNumbers(offset, reconcilePage)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range numbers {
+			l := add(n.Did)
+			switch n.Status {
+			case database.NumberUsed:
+				l.num = n.Num
+			case database.NumberReserved:
+				l.reserved = true
+			}
+			l.deactivated = l.deactivated || n.Deactivated
+		}
+
+		if len(numbers) < reconcilePage {
+			break
+		}
+	}
+
+	// a registered DID may have no number row, e.g. when its job found it
+	// already registered
+	for offset := 0; ; offset += reconcilePage {
+		jobs, err := m.db.ListRegisteredJobs(offset, reconcilePage)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, job := range jobs {
+			if job.Kind != database.JobRegisterDIDTon {
+				add(job.DID)
+			}
+		}
+
+		if len(jobs) < reconcilePage {
+			break
+		}
+	}
+
+	localHolders := make(map[int][]string)
+	chainHolders := make(map[int][]string)
+	for _, did := range dids {
+		if l := local[did]; l.num != 0 {
+			localHolders[l.num] = append(localHolders[l.num], did)
+		}
+	}
+
+	for _, did := range dids {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		l := local[did]
+		queued, err := m.db.HasQueuedJob(did)
+		if err != nil {
+			return nil, err
+		}
+		if l.reserved || queued {
+			report.Skipped++
+			continue
+		}
+
+		chain, mismatch, err := m.reconcileDID(ctx, did, l)
+		if err != nil {
+			m.logger.Warnf("reconcile %s: %s", did, err)
+			report.Failed++
+			continue
+		}
+		report.Checked++
+		if chain != 0 {
+			chainHolders[chain] = append(chainHolders[chain], did)
+		}
+		if mismatch == nil {
+			continue
+		}
+
+		if repair {
+			err = m.repairDID(mismatch)
+			if err != nil {
+				mismatch.Error = err.Error()
+			} else {
+				mismatch.Repaired = true
+			}
+		}
+		m.logger.Warnf("reconcile %s: %s, local number %d, chain number %d, repaired %t",
+			mismatch.DID, mismatch.Kind, mismatch.Local, mismatch.Chain, mismatch.Repaired)
+		report.Mismatches = append(report.Mismatches, *mismatch)
+	}
+
+	report.Conflicts = append(conflicts("local", localHolders), conflicts("chain", chainHolders)...)
+	for _, c := range report.Conflicts {
+		m.logger.Warnf("reconcile: number conflict, %d held by %v on %s", c.Num, c.DIDs, c.Source)
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// conflicts returns the numbers of holders held by more than one DID
+func conflicts(source string, holders map[int][]string) []Conflict {
+	var res []Conflict
+	for num, dids := range holders {
+		if len(dids) > 1 {
+			res = append(res, Conflict{Num: num, Source: source, DIDs: dids})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Num < res[j].Num })
+	return res
+}
+
+// reconcileDID returns the number of did on chain and how the DB differs
+// from the chain about it, nil when it does not
+func (m *MemoDID) reconcileDID(ctx context.Context, did string, l *localDID) (int, *Mismatch, error) {
+	memoDID, err := types.ParseMemoDID(did)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	deactivated, err := m.Controller.GetDIDStatus(ctx, did)
+	if err != nil {
+		return 0, nil, err
+	}
+	if deactivated {
+		if l.deactivated {
+			return 0, nil, nil
+		}
+		return 0, &Mismatch{DID: did, Kind: MismatchDeactivated, Local: l.num}, nil
+	}
+
+	number, err := m.Controller.GetDIDNumber(ctx, memoDID.Identifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	chain := int(number.Int64())
+
+	mismatch := &Mismatch{DID: did, Local: l.num, Chain: chain}
+	switch {
+	case chain == l.num:
+		return chain, nil, nil
+	case l.num == 0:
+		mismatch.Kind = MismatchMissingLocal
+	case chain == 0:
+		mismatch.Kind = MismatchMissingChain
+	default:
+		mismatch.Kind = MismatchNumber
+	}
+	return chain, mismatch, nil
+}
+
+func (m *MemoDID) repairDID(mismatch *Mismatch) error {
+	switch mismatch.Kind {
+	case MismatchDeactivated:
+		return m.db.SetDeactivated(mismatch.DID)
+	case MismatchMissingChain:
+		return m.db.UnsetDIDNumber(mismatch.DID, mismatch.Local)
+	default:
+		return m.db.SetDIDNumber(mismatch.DID, mismatch.Chain)
+	}
+}
+
+// RunReconcile reconciles the numbers DB with the chain every interval
+// until ctx is done. The last report is kept for LastReconcile.
+func (m *MemoDID) RunReconcile(ctx context.Context, interval time.Duration, repair bool) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := m.Reconcile(ctx, repair)
+		if err != nil {
+			if ctx.Err() == nil {
+				m.logger.Error(err)
+			}
+			continue
+		}
+		m.logger.Infof("reconcile: %d DIDs checked, %d skipped, %d failed, %d mismatches, %d number conflicts",
+			report.Checked, report.Skipped, report.Failed, len(report.Mismatches), len(report.Conflicts))
+
+		m.reconcileLock.Lock()
+		m.lastReconcile = report
+		m.reconcileLock.Unlock()
+	}
+}
+
+// LastReconcile returns the report of the last background reconciliation,
+// nil before the first one
+func (m *MemoDID) LastReconcile() *ReconcileReport {
+	m.reconcileLock.Lock()
+	defer m.reconcileLock.Unlock()
+
+	return m.lastReconcile
+}
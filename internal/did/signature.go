@@ -1,6 +1,7 @@
 package did
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/binary"
 	"fmt"
@@ -10,16 +11,18 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
 )
 
-func (m *MemoDID) GetCreateSignatureMassageByPubKey(publickey string) (string, error) {
-	did, err := m.CreateDIDByPubKey(publickey)
+func (m *MemoDID) GetCreateSignatureMassageByPubKey(ctx context.Context, publickey string) (string, error) {
+	did, err := m.CreateDIDByPubKey(ctx, publickey)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	nonce, err := m.Controller.GetNonce(did.String())
+	nonce, err := m.Controller.GetNonce(ctx, did.String())
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
@@ -28,14 +31,14 @@ func (m *MemoDID) GetCreateSignatureMassageByPubKey(publickey string) (string, e
 	return m.getCreateDIDHashPubkey(did.Identifier, publickey, nonce)
 }
 
-func (m *MemoDID) GetCreateSignatureMassageByAddress(address string) (string, error) {
-	did, err := m.CreateDIDByAddress(address)
+func (m *MemoDID) GetCreateSignatureMassageByAddress(ctx context.Context, address string) (string, error) {
+	did, err := m.CreateDIDByAddress(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	nonce, err := m.Controller.GetNonce(did.String())
+	nonce, err := m.Controller.GetNonce(ctx, did.String())
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
@@ -44,19 +47,19 @@ func (m *MemoDID) GetCreateSignatureMassageByAddress(address string) (string, er
 	return m.CreateDIDMessageByAddress(did.Identifier, address, nonce)
 }
 
-func (m *MemoDID) VerifySign(sign, address string) (bool, error) {
+func (m *MemoDID) VerifySign(ctx context.Context, sign, address string) (bool, error) {
 	sig := hexutil.MustDecode(sign)
 	if sig[64] == 27 || sig[64] == 28 {
 		sig[64] -= 27
 	}
 
-	did, err := m.CreateDIDByAddress(address)
+	did, err := m.CreateDIDByAddress(ctx, address)
 	if err != nil {
 		m.logger.Error(err)
 		return false, err
 	}
 
-	nonce, err := m.Controller.GetNonce(did.Identifier)
+	nonce, err := m.Controller.GetNonce(ctx, did.Identifier)
 	if err != nil {
 		m.logger.Error(err)
 		return false, err
@@ -90,14 +93,110 @@ func (m *MemoDID) VerifySign(sign, address string) (bool, error) {
 	return true, nil
 }
 
-func (m *MemoDID) GetDeleteSignatureMassage(did string) (string, error) {
-	nonce, err := m.Controller.GetNonce(did)
+// GetDeleteSignatureMassage accepts a full did or its identifier
+func (m *MemoDID) GetDeleteSignatureMassage(ctx context.Context, did string) (string, error) {
+	didI, err := didIdentifier(did)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
 	}
 
-	return m.getDeleteDIDHash(did, nonce)
+	nonce, err := m.Controller.GetNonce(ctx, didI)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	return m.getDeleteDIDHash(didI, nonce)
+}
+
+var ErrSignatureMismatch = xerrors.New("signature is not from the did controller")
+
+// verifyController checks that sig over one of hashes is made by the master
+// verification method of didI
+func (m *MemoDID) verifyController(ctx context.Context, didI string, sig []byte, hashes ...[]byte) error {
+	want, err := m.controllerAddress(ctx, didI)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		signer, err := recoverAddress(hash, sig)
+		if err == nil && signer == want {
+			return nil
+		}
+	}
+
+	return ErrSignatureMismatch
+}
+
+// controllerAddress returns the account of the master verification method
+// of didI
+func (m *MemoDID) controllerAddress(ctx context.Context, didI string) (common.Address, error) {
+	methodType, pubKeyData, err := m.Controller.GetMasterVerification(ctx, didI)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return verificationAddress(methodType, pubKeyData)
+}
+
+// verificationAddress returns the account of a secp256k1 verification method
+func verificationAddress(methodType string, pubKeyData []byte) (common.Address, error) {
+	switch methodType {
+	case "EcdsaSecp256k1RecoveryMethod2020":
+		if len(pubKeyData) != common.AddressLength {
+			return common.Address{}, xerrors.Errorf("invalid address length %d", len(pubKeyData))
+		}
+		return common.BytesToAddress(pubKeyData), nil
+	case "EcdsaSecp256k1VerificationKey2019":
+		pubKey, err := crypto.DecompressPubkey(pubKeyData)
+		if err != nil {
+			pubKey, err = crypto.UnmarshalPubkey(pubKeyData)
+			if err != nil {
+				return common.Address{}, err
+			}
+		}
+		return crypto.PubkeyToAddress(*pubKey), nil
+	default:
+		return common.Address{}, xerrors.Errorf("can not verify signatures of %s", methodType)
+	}
+}
+
+func recoverAddress(hash, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, xerrors.Errorf("invalid signature length %d", len(sig))
+	}
+
+	sigCopy := make([]byte, len(sig))
+	copy(sigCopy, sig)
+	if sigCopy[64] >= 27 {
+		sigCopy[64] -= 27
+	}
+
+	pubKey, err := crypto.SigToPub(hash, sigCopy)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+// didIdentifier strips did:memo: from a did, identifiers are returned as is
+func didIdentifier(did string) (string, error) {
+	if !strings.HasPrefix(did, "did:") {
+		return did, nil
+	}
+
+	memoDID, err := types.ParseMemoDID(did)
+	if err != nil {
+		return "", err
+	}
+	return memoDID.Identifier, nil
+}
+
+// memoDIDString is the full did of an identifier
+func memoDIDString(didI string) string {
+	did := types.MemoDID{Method: "memo", Identifier: didI}
+	return did.String()
 }
 
 func (m *MemoDID) getCreateDIDHashPubkey(did, publickeyStr string, nonce uint64) (string, error) {
@@ -144,6 +243,115 @@ func (m *MemoDID) getDeleteDIDHash(did string, nonce uint64) (string, error) {
 	return hexutil.Encode(hash), nil
 }
 
+// GetAddVerifySignatureMassage returns the message the DID controller signs,
+// as an ethereum message, to add a verification method of mtype
+func (m *MemoDID) GetAddVerifySignatureMassage(ctx context.Context, did, mtype, key string) (string, error) {
+	didI, err := didIdentifier(did)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	pubKeyData, err := verificationKey(mtype, key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := m.Controller.GetNonce(ctx, didI)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	return hexutil.Encode(m.addVerificationMessage(didI, mtype, memoDIDString(didI), pubKeyData, nonce)), nil
+}
+
+// GetChangeVerifySignatureMassage returns the message to rotate the
+// verification method at index to key, or to revoke it if action is revoke
+func (m *MemoDID) GetChangeVerifySignatureMassage(ctx context.Context, did string, index uint64, action, mtype, key string) (string, error) {
+	didI, err := didIdentifier(did)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	nonce, err := m.Controller.GetNonce(ctx, didI)
+	if err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	switch action {
+	case VerifyActionRotate:
+		pubKeyData, err := verificationKey(mtype, key)
+		if err != nil {
+			return "", err
+		}
+		return hexutil.Encode(m.updateVerificationMessage(didI, index, mtype, pubKeyData, nonce)), nil
+	case VerifyActionRevoke:
+		return hexutil.Encode(revokeVerificationMessage(didI, index, nonce)), nil
+	default:
+		return "", ErrInvalidVerifyAction
+	}
+}
+
+func (m *MemoDID) addVerificationMessage(didI, mtype, controller string, pubKeyData []byte, nonce uint64) []byte {
+	tmp8 := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmp8, nonce)
+
+	addVerification := []byte("addVerificationMethod")
+	didByte := []byte(didI)
+	method := []byte(m.getMethodType(mtype))
+	controllerByte := []byte(controller)
+
+	message := append(addVerification, didByte...)
+	message = append(message, method...)
+	message = append(message, controllerByte...)
+	message = append(message, pubKeyData...)
+	message = append(message, tmp8...)
+
+	return message
+}
+
+func (m *MemoDID) updateVerificationMessage(didI string, index uint64, mtype string, pubKeyData []byte, nonce uint64) []byte {
+	tmp8 := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmp8, nonce)
+
+	tmpIndex := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmpIndex, index)
+
+	updateVerification := []byte("updateVerificationMethod")
+	didByte := []byte(didI)
+	method := []byte(m.getMethodType(mtype))
+
+	message := append(updateVerification, didByte...)
+	message = append(message, tmpIndex...)
+	message = append(message, method...)
+	message = append(message, pubKeyData...)
+	message = append(message, tmp8...)
+
+	return message
+}
+
+func revokeVerificationMessage(didI string, index uint64, nonce uint64) []byte {
+	tmp8 := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmp8, nonce)
+
+	tmpIndex := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmpIndex, index)
+
+	deactivateVerification := []byte("deactivateVerificationMethod")
+	didByte := []byte(didI)
+	deactivate := []byte{1}
+
+	message := append(deactivateVerification, didByte...)
+	message = append(message, tmpIndex...)
+	message = append(message, deactivate...)
+	message = append(message, tmp8...)
+
+	return message
+}
+
 func (m *MemoDID) CreateDIDMessageByAddress(didI, addressStr string, nonce uint64) (string, error) {
 	m.logger.Infof("didI = %s, addressStr = %s, nonce = %d", didI, addressStr, nonce)
 	tmp8 := make([]byte, 8)
@@ -163,8 +371,8 @@ func (m *MemoDID) CreateDIDMessageByAddress(didI, addressStr string, nonce uint6
 	return hexutil.Encode(message), nil
 }
 
-func (m *MemoDID) CreateMDIDMessage(mdidI, didiI string, price *big.Int) (string, error) {
-	nonce, err := m.Controller.GetNonceMDID(didiI)
+func (m *MemoDID) CreateMDIDMessage(ctx context.Context, mdidI, didiI string, price *big.Int, keywords []string) (string, error) {
+	nonce, err := m.Controller.GetNonceMDID(ctx, didiI)
 	if err != nil {
 		m.logger.Error(err)
 		return "", err
@@ -182,6 +390,9 @@ func (m *MemoDID) CreateMDIDMessage(mdidI, didiI string, price *big.Int) (string
 	controller := []byte(didiI)
 	priceByte := price.Bytes()
 	keywordsByte := []byte{}
+	for _, keyword := range keywords {
+		keywordsByte = append(keywordsByte, []byte(keyword)...)
+	}
 
 	message := append(createDID, encode...)
 	message = append(message, mfileDID...)
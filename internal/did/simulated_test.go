@@ -0,0 +1,446 @@
+package did
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/contract/simchain"
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+// newSimulatedMemoDID is a MemoDID on a simulated chain with a fresh database
+func newSimulatedMemoDID(t *testing.T) *MemoDID {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	chain, err := simchain.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Close() })
+
+	controller, err := chain.Controller(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+	memoDID, err := NewMemoDIDWithController(cfg, controller, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return memoDID
+}
+
+func TestSimulatedDIDLifecycle(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(sk.PublicKey).Hex()
+
+	didStr, err := memoDID.RegisterDIDByAddressByAdmin(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := memoDID.GetDIDStatus(context.Background(), didStr)
+	if err != nil || status != DIDStatusActive {
+		t.Fatalf("status after register: %s %v", status, err)
+	}
+
+	doc, _, err := memoDID.ResolveDID(context.Background(), didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.VerificationMethod) != 1 {
+		t.Fatalf("resolved %d verification methods", len(doc.VerificationMethod))
+	}
+
+	msg, err := memoDID.GetDeleteSignatureMassage(context.Background(), didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	// a bare identifier is taken as GetDeleteSignatureMassage takes it
+	err = memoDID.DeactivateDID(context.Background(), strings.TrimPrefix(didStr, "did:memo:"), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = memoDID.GetDIDStatus(context.Background(), didStr)
+	if err != nil || status != DIDStatusDeactivated {
+		t.Fatalf("status after deactivate: %s %v", status, err)
+	}
+
+	// the nonce moved on, the same signature can not be replayed
+	err = memoDID.DeactivateDID(context.Background(), didStr, sig)
+	if err != ErrDIDDeactivated {
+		t.Fatalf("deactivate again: %v", err)
+	}
+}
+
+func TestSimulatedMfile(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(sk.PublicKey).Hex()
+
+	didStr, err := memoDID.RegisterDIDByAddressByAdmin(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cid := "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+	mdid, msg, err := memoDID.CreateMfileInfo(context.Background(), addr, didStr, cid, big.NewInt(0), []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the controller of the DID creates its mfile, and another uploader
+	// does not replace it
+	otherSK, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := crypto.PubkeyToAddress(otherSK.PublicKey).Hex()
+	_, _, err = memoDID.CreateMfileInfo(context.Background(), other, didStr, cid, big.NewInt(0), nil)
+	if err != ErrNotController {
+		t.Fatalf("mfile created by another address: %v", err)
+	}
+	otherDID, err := memoDID.RegisterDIDByAddressByAdmin(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = memoDID.CreateMfileInfo(context.Background(), other, otherDID, cid, big.NewInt(0), nil)
+	if err != ErrMfileTaken {
+		t.Fatalf("mfile replaced by another uploader: %v", err)
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	minfo, err := memoDID.RegisterMfileDID(context.Background(), mdid, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minfo.Status != database.MfileRegistered {
+		t.Fatalf("mfile status %s: %s", minfo.Status, minfo.Error)
+	}
+
+	public, err := memoDID.IsMfilePublic(context.Background(), mdid)
+	if err != nil || !public {
+		t.Fatalf("free mfile public: %t %v", public, err)
+	}
+
+	doc, _, err := memoDID.ResolveDID(context.Background(), mdid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Controller) == 0 {
+		t.Fatalf("mfile document without controller: %+v", doc)
+	}
+}
+
+func TestSimulatedReconcile(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+	ctx := context.Background()
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, err := memoDID.RegisterDIDByAddressByAdmin(ctx, crypto.PubkeyToAddress(sk.PublicKey).Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := memoDID.db.GetDIDNumber(registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk, err = crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unregistered, err := memoDID.CreateDIDByAddress(ctx, crypto.PubkeyToAddress(sk.PublicKey).Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the number of the registered DID is lost, the other one gets one
+	err = memoDID.db.UnsetDIDNumber(registered, n.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = memoDID.db.AddNumber(unregistered.String(), n.Num+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := memoDID.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]string)
+	for _, m := range report.Mismatches {
+		kinds[m.DID] = m.Kind
+	}
+	if len(kinds) != 2 || kinds[registered] != MismatchMissingLocal || kinds[unregistered.String()] != MismatchMissingChain {
+		t.Fatalf("mismatches %+v", report.Mismatches)
+	}
+
+	report, err = memoDID.Reconcile(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range report.Mismatches {
+		if !m.Repaired {
+			t.Fatalf("not repaired %+v", m)
+		}
+	}
+
+	report, err = memoDID.Reconcile(ctx, false)
+	if err != nil || len(report.Mismatches) != 0 {
+		t.Fatalf("mismatches after repair %+v: %v", report.Mismatches, err)
+	}
+	ok, err := memoDID.db.HasNumber(registered)
+	if err != nil || !ok {
+		t.Fatalf("registered DID has no number after repair: %t %v", ok, err)
+	}
+}
+
+func TestSimulatedReconcileJobsAndConflicts(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+	ctx := context.Background()
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(sk.PublicKey).Hex()
+	registered, err := memoDID.RegisterDIDByAddressByAdmin(ctx, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := memoDID.db.GetDIDNumber(registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only a job knows of the registered DID
+	err = memoDID.db.UnsetDIDNumber(registered, n.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = memoDID.db.AddJob(&database.Job{Kind: database.JobRegisterDIDAdmin, Address: address, DID: registered, Status: database.JobSkipped})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two DIDs hold the same number locally
+	err = memoDID.db.AddNumber("did:memo:0000000000000000000000000000000000000000000000000000000000000001", n.Num+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = memoDID.db.AddNumber("did:memo:0000000000000000000000000000000000000000000000000000000000000002", n.Num+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := memoDID.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, m := range report.Mismatches {
+		found = found || (m.DID == registered && m.Kind == MismatchMissingLocal && m.Chain == n.Num)
+	}
+	if !found {
+		t.Fatalf("DID of the job not reconciled: %+v", report.Mismatches)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Num != n.Num+1 || report.Conflicts[0].Source != "local" || len(report.Conflicts[0].DIDs) != 2 {
+		t.Fatalf("conflicts %+v", report.Conflicts)
+	}
+}
+
+func TestSimulatedAirdrop(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+	ctx := context.Background()
+
+	addresses := make([]string, 5)
+	dids := make([]string, 5)
+	for i := range addresses {
+		sk, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses[i] = crypto.PubkeyToAddress(sk.PublicKey).Hex()
+		did, err := memoDID.CreateDIDByAddress(ctx, addresses[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		dids[i] = did.String()
+	}
+
+	// a duplicate and an invalid address in the batch
+	results, err := memoDID.EnqueueAirdrop(ctx, "first", []string{addresses[0], addresses[1], addresses[0], "bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Address != "bad" || results[0].Status != database.JobFailed {
+		t.Fatalf("first batch %+v", results)
+	}
+
+	// resubmitted with one more address, only that one is added
+	_, err = memoDID.EnqueueAirdrop(ctx, "first", []string{addresses[0], addresses[1], addresses[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := memoDID.AirdropReport("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("first report %+v", report)
+	}
+	for i, r := range report {
+		if r.Address != addresses[i] || r.DID != dids[i] || r.Status != database.JobPending {
+			t.Fatalf("first report line %d %+v", i, r)
+		}
+	}
+	if AirdropDone(report) {
+		t.Fatal("pending batch done")
+	}
+
+	// in another batch, an address queued by the first is rejected without
+	// a job, one with a number is skipped
+	err = memoDID.db.AddNumber(dids[3], 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = memoDID.EnqueueAirdrop(ctx, "second", []string{addresses[0], addresses[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Address != addresses[0] || results[0].Error != ErrRegistrationQueued.Error() {
+		t.Fatalf("second batch %+v", results)
+	}
+	report, err = memoDID.AirdropReport("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Address != addresses[3] || report[0].Status != database.JobSkipped {
+		t.Fatalf("second report %+v", report)
+	}
+	if !AirdropDone(report) {
+		t.Fatal("skipped batch not done")
+	}
+}
+
+func TestSimulatedResolveDocument(t *testing.T) {
+	memoDID := newSimulatedMemoDID(t)
+	ctx := context.Background()
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(sk.PublicKey)
+	didStr, err := memoDID.RegisterDIDByAddressByAdmin(ctx, addr.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, meta, err := memoDID.ResolveDID(ctx, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Deactivated || doc.ID != didStr || doc.Controller != didStr || len(doc.Context) != 1 {
+		t.Fatalf("document %+v metadata %+v", doc, meta)
+	}
+	want := VerificationMethod{
+		ID:                  didStr + "#keys-0",
+		Type:                "EcdsaSecp256k1RecoveryMethod2020",
+		Controller:          didStr,
+		BlockchainAccountID: "eip155:" + memoDID.Controller.ChainID().String() + ":" + addr.Hex(),
+	}
+	if len(doc.VerificationMethod) != 1 || doc.VerificationMethod[0] != want {
+		t.Fatalf("verification methods %+v, want %+v", doc.VerificationMethod, want)
+	}
+	if len(doc.Authentication) != 1 || doc.Authentication[0] != want.ID {
+		t.Fatalf("authentication %v", doc.Authentication)
+	}
+
+	// the mfile document is controlled by the memo DID of its uploader
+	cid := "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+	_, _, err = memoDID.ResolveDID(ctx, "did:mfile:cid:"+cid)
+	if err != ErrDIDNotFound {
+		t.Fatalf("unregistered mfile: %v", err)
+	}
+	mdid, msg, err := memoDID.CreateMfileInfo(ctx, addr.Hex(), didStr, cid, big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	_, err = memoDID.RegisterMfileDID(ctx, mdid, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, meta, err = memoDID.ResolveDID(ctx, mdid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Deactivated || doc.ID != mdid || doc.Controller != didStr || len(doc.VerificationMethod) != 0 {
+		t.Fatalf("mfile document %+v metadata %+v", doc, meta)
+	}
+
+	// a deactivated DID keeps its document, without keys
+	msg, err = memoDID.GetDeleteSignatureMassage(ctx, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = crypto.Sign(accounts.TextHash(hexutil.MustDecode(msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	err = memoDID.DeactivateDID(ctx, didStr, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, meta, err = memoDID.ResolveDID(ctx, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Deactivated || doc.ID != didStr || doc.Controller != "" || len(doc.VerificationMethod) != 0 || len(doc.Authentication) != 0 {
+		t.Fatalf("deactivated document %+v metadata %+v", doc, meta)
+	}
+}
@@ -0,0 +1,183 @@
+package did
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/go-did/types"
+	"golang.org/x/xerrors"
+)
+
+const (
+	VerifyActionRotate = "rotate"
+	VerifyActionRevoke = "revoke"
+)
+
+var (
+	ErrInvalidVerificationMethod = xerrors.New("invalid verification method")
+	ErrInvalidVerifyAction       = xerrors.New("action is not rotate or revoke")
+	ErrVerificationNotFound      = xerrors.New("verification method not found")
+	ErrMasterVerification        = xerrors.New("master verification method can not be revoked")
+)
+
+// AddVerifyInfo adds a verification method of mtype, which is address, pubkey
+// or ton, to a did. sig is made by the did controller over the message of
+// GetAddVerifySignatureMassage. It returns the index of the new method.
+func (m *MemoDID) AddVerifyInfo(ctx context.Context, didStr, mtype, key string, sig []byte) (uint64, error) {
+	did, err := m.activeDID(ctx, didStr)
+	if err != nil {
+		return 0, err
+	}
+
+	pubKeyData, err := verificationKey(mtype, key)
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := m.Controller.GetVerificationCount(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return 0, err
+	}
+
+	nonce, err := m.Controller.GetNonce(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return 0, err
+	}
+
+	controller := memoDIDString(did.Identifier)
+	message := m.addVerificationMessage(did.Identifier, mtype, controller, pubKeyData, nonce)
+	err = m.verifyController(ctx, did.Identifier, sig, accounts.TextHash(message))
+	if err != nil {
+		m.logger.Error(err)
+		return 0, err
+	}
+
+	err = m.Controller.AddVerificationMethod(ctx, did.Identifier, m.getMethodType(mtype), controller, pubKeyData, sig)
+	if err != nil {
+		m.logger.Error(err)
+		return 0, err
+	}
+
+	return index, nil
+}
+
+// ChangeVerifyInfo rotates the verification method at index to key of mtype,
+// or revokes it. The master method at index 0 can only be rotated to another
+// secp256k1 key, so that the did stays controllable.
+func (m *MemoDID) ChangeVerifyInfo(ctx context.Context, didStr string, index uint64, action, mtype, key string, sig []byte) error {
+	did, err := m.activeDID(ctx, didStr)
+	if err != nil {
+		return err
+	}
+
+	var pubKeyData []byte
+	switch action {
+	case VerifyActionRotate:
+		pubKeyData, err = verificationKey(mtype, key)
+		if err != nil {
+			return err
+		}
+		if index == 0 && mtype == "ton" {
+			return xerrors.Errorf("master verification method must be secp256k1: %w", ErrInvalidVerificationMethod)
+		}
+	case VerifyActionRevoke:
+		if index == 0 {
+			return ErrMasterVerification
+		}
+	default:
+		return ErrInvalidVerifyAction
+	}
+
+	count, err := m.Controller.GetVerificationCount(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+	if index >= count {
+		return ErrVerificationNotFound
+	}
+
+	nonce, err := m.Controller.GetNonce(ctx, did.Identifier)
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	var message []byte
+	if action == VerifyActionRotate {
+		message = m.updateVerificationMessage(did.Identifier, index, mtype, pubKeyData, nonce)
+	} else {
+		message = revokeVerificationMessage(did.Identifier, index, nonce)
+	}
+
+	err = m.verifyController(ctx, did.Identifier, sig, accounts.TextHash(message))
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	if action == VerifyActionRotate {
+		err = m.Controller.ChangeVerificationMethod(ctx, did.Identifier, index, m.getMethodType(mtype), pubKeyData, sig)
+	} else {
+		err = m.Controller.DeactivateVerificationMethod(ctx, did.Identifier, index, true, sig)
+	}
+	if err != nil {
+		m.logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// activeDID parses didStr and checks that it is registered and not deactivated
+func (m *MemoDID) activeDID(ctx context.Context, didStr string) (*types.MemoDID, error) {
+	status, err := m.GetDIDStatus(ctx, didStr)
+	if err != nil {
+		return nil, err
+	}
+	if status == DIDStatusDeactivated {
+		return nil, ErrDIDDeactivated
+	}
+
+	return types.ParseMemoDID(didStr)
+}
+
+// verificationKey decodes key into the public key data stored on chain:
+// 20 address bytes for address, a 33 byte compressed secp256k1 key for
+// pubkey and a 32 byte Ed25519 key for ton
+func verificationKey(mtype, key string) ([]byte, error) {
+	switch mtype {
+	case "address":
+		if !common.IsHexAddress(key) {
+			return nil, xerrors.Errorf("%s is not an address: %w", key, ErrInvalidVerificationMethod)
+		}
+		return common.HexToAddress(key).Bytes(), nil
+	case "pubkey":
+		pubKey, err := hexutil.Decode(key)
+		if err != nil || len(pubKey) != 33 {
+			return nil, xerrors.Errorf("pubkey must be a compressed secp256k1 key: %w", ErrInvalidVerificationMethod)
+		}
+		if _, err := crypto.DecompressPubkey(pubKey); err != nil {
+			return nil, xerrors.Errorf("pubkey is not on secp256k1: %w", ErrInvalidVerificationMethod)
+		}
+		return pubKey, nil
+	case "ton":
+		if !strings.HasPrefix(key, "0x") {
+			key = "0x" + key
+		}
+		pubKey, err := hexutil.Decode(key)
+		if err != nil || len(pubKey) != ed25519.PublicKeySize {
+			return nil, xerrors.Errorf("ton key must be a 32 byte Ed25519 key: %w", ErrInvalidVerificationMethod)
+		}
+		return pubKey, nil
+	default:
+		return nil, xerrors.Errorf("type %q is not address, pubkey or ton: %w", mtype, ErrInvalidVerificationMethod)
+	}
+}
@@ -16,6 +16,7 @@ type UserNode interface {
 	GetObject(ctx context.Context, bucketName, objectName string, opts DownloadObjectOptions) ([]byte, error)
 	HeadObject(ctx context.Context, bucketName, objectName string) (MefsObjectInfo, error)
 	DeleteObject(ctx context.Context, bucketName, objectName string) error
+	ListObjects(ctx context.Context, bucketName string, opts ListObjectsOptions) (ListObjectsInfo, error)
 
 	ShowStorage(ctx context.Context) (uint64, error)
 }
@@ -28,8 +29,9 @@ type UserNodeStruct struct {
 
 		HeadBucket func(ctx context.Context, bucketName string) (BucketInfo, error) `perm:"read"`
 
-		GetObject  func(ctx context.Context, bucketName, objectName string, opts DownloadObjectOptions) ([]byte, error) `perm:"read"`
-		HeadObject func(ctx context.Context, bucketName, objectName string) (MefsObjectInfo, error)                     `perm:"read"`
+		GetObject   func(ctx context.Context, bucketName, objectName string, opts DownloadObjectOptions) ([]byte, error) `perm:"read"`
+		HeadObject  func(ctx context.Context, bucketName, objectName string) (MefsObjectInfo, error)                     `perm:"read"`
+		ListObjects func(ctx context.Context, bucketName string, opts ListObjectsOptions) (ListObjectsInfo, error)       `perm:"read"`
 
 		ShowStorage func(ctx context.Context) (uint64, error) `perm:"read"`
 	}
@@ -59,6 +61,10 @@ func (s *UserNodeStruct) HeadObject(ctx context.Context, bucketName, objectName
 	return s.Internal.HeadObject(ctx, bucketName, objectName)
 }
 
+func (s *UserNodeStruct) ListObjects(ctx context.Context, bucketName string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	return s.Internal.ListObjects(ctx, bucketName, opts)
+}
+
 func (s *UserNodeStruct) ShowStorage(ctx context.Context) (uint64, error) {
 	return s.Internal.ShowStorage(ctx)
 }
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// CidReader computes the CIDv1 (raw codec, sha2-256) of everything read
+// through it, in one block whatever its size. Local and S3 storage name
+// objects by it. MEFS computes its cid etag itself, PutObject of Mefs checks
+// it against this one and warns when a file would get another mfile DID
+// there.
+type CidReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func NewCidReader(r io.Reader) *CidReader {
+	return &CidReader{r: r, h: sha256.New()}
+}
+
+func (cr *CidReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.h.Write(p[:n])
+	cr.size += int64(n)
+	return n, err
+}
+
+// Cid returns the cid of the bytes read so far
+func (cr *CidReader) Cid() string {
+	mh, _ := multihash.Encode(cr.h.Sum(nil), multihash.SHA2_256)
+	return cid.NewCidV1(cid.Raw, mh).String()
+}
+
+// Sha256 returns the hex sha256 of the bytes read so far
+func (cr *CidReader) Sha256() string {
+	return hex.EncodeToString(cr.h.Sum(nil))
+}
+
+func (cr *CidReader) Size() int64 {
+	return cr.size
+}
@@ -0,0 +1,317 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+// Local keeps objects on disk under root:
+//
+//	data/<bucket>/<name>  object content
+//	meta/<bucket>/<name>  object info as json
+//	cids/<cid>            bucket and name of the last object with that cid
+//
+// Names are base64url encoded so that any object name is a single file.
+type Local struct {
+	root   string
+	lock   sync.RWMutex
+	logger *log.Helper
+}
+
+func NewLocal(root string, logger *log.Helper) (*Local, error) {
+	for _, dir := range []string{"data", "meta", "cids", "tmp"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Local{
+		root:   root,
+		logger: logger,
+	}, nil
+}
+
+func (l *Local) path(dir, bucket, object string) string {
+	return filepath.Join(l.root, dir, bucket, base64.RawURLEncoding.EncodeToString([]byte(object)))
+}
+
+// validBucket reports whether bucket names a single directory under the root
+func validBucket(bucket string) bool {
+	return bucket != "" && !strings.ContainsAny(bucket, `/\.`)
+}
+
+func (l *Local) MakeBucketWithLocation(ctx context.Context, bucket string) error {
+	if !validBucket(bucket) {
+		return xerrors.Errorf("invalid bucket name %q", bucket)
+	}
+
+	for _, dir := range []string{"data", "meta"} {
+		err := os.MkdirAll(filepath.Join(l.root, dir, bucket), 0755)
+		if err != nil {
+			l.logger.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) CheckBucket(ctx context.Context, bucket string) bool {
+	if !validBucket(bucket) {
+		return false
+	}
+
+	fi, err := os.Stat(filepath.Join(l.root, "meta", bucket))
+	return err == nil && fi.IsDir()
+}
+
+// PutObject writes r to a temporary file while computing its cid and moves
+// it in place once complete, a failed upload leaves nothing behind
+func (l *Local) PutObject(ctx context.Context, bucket, object string, r io.Reader) (ObjectInfo, error) {
+	if !l.CheckBucket(ctx, bucket) {
+		return ObjectInfo{}, xerrors.Errorf("bucket %s not found", bucket)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(l.root, "tmp"), "put-")
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	cr := NewCidReader(r)
+	_, err = io.Copy(tmp, cr)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{
+		Bucket:     bucket,
+		Name:       object,
+		Size:       cr.Size(),
+		Mid:        cr.Cid(),
+		CreateTime: time.Now().Truncate(time.Second),
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	err = os.Rename(tmp.Name(), l.path("data", bucket, object))
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+	err = writeJSON(l.path("meta", bucket, object), info)
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+	err = writeJSON(filepath.Join(l.root, "cids", info.Mid), objectLocation{Bucket: bucket, Name: object})
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+
+	return info, nil
+}
+
+func (l *Local) GetObject(ctx context.Context, bucket, object string, start, length int64, w io.Writer) (int64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if bucket == "" {
+		loc, err := l.locate(object)
+		if err != nil {
+			return 0, err
+		}
+		bucket, object = loc.Bucket, loc.Name
+	} else if !validBucket(bucket) {
+		return 0, ErrObjectNotFound
+	}
+
+	f, err := os.Open(l.path("data", bucket, object))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrObjectNotFound
+	}
+	if err != nil {
+		l.logger.Error(err)
+		return 0, err
+	}
+	defer f.Close()
+
+	written, err := io.Copy(w, io.NewSectionReader(f, start, length))
+	if err == nil && written != length {
+		err = xerrors.Errorf("read %s at %d: got %d bytes, want %d", object, start, written, length)
+	}
+	return written, err
+}
+
+func (l *Local) GetObjectInfo(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.objectInfo(bucket, object)
+}
+
+func (l *Local) objectInfo(bucket, object string) (ObjectInfo, error) {
+	if !validBucket(bucket) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+
+	var info ObjectInfo
+	err := readJSON(l.path("meta", bucket, object), &info)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return info, err
+}
+
+func (l *Local) GetObjectInfoByMid(ctx context.Context, mid string) (ObjectInfo, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	loc, err := l.locate(mid)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return l.objectInfo(loc.Bucket, loc.Name)
+}
+
+func (l *Local) locate(mid string) (objectLocation, error) {
+	var loc objectLocation
+	if mid == "" || strings.ContainsAny(mid, `/\.`) {
+		return loc, ErrObjectNotFound
+	}
+
+	err := readJSON(filepath.Join(l.root, "cids", mid), &loc)
+	if errors.Is(err, fs.ErrNotExist) {
+		return loc, ErrObjectNotFound
+	}
+	return loc, err
+}
+
+func (l *Local) DeleteObject(ctx context.Context, bucket, object string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	info, err := l.objectInfo(bucket, object)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{"meta", "data"} {
+		err = os.Remove(l.path(dir, bucket, object))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			l.logger.Error(err)
+			return err
+		}
+	}
+
+	// keep the cid pointing to an object if it is still there
+	loc, err := l.locate(info.Mid)
+	if err == nil && loc.Bucket == bucket && loc.Name == object {
+		err = os.Remove(filepath.Join(l.root, "cids", info.Mid))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			l.logger.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// ListObjects returns up to max objects of bucket whose names sort after
+// marker, all of them if max is not positive
+func (l *Local) ListObjects(ctx context.Context, bucket, marker string, max int) (ObjectList, error) {
+	if !validBucket(bucket) {
+		return ObjectList{}, xerrors.Errorf("bucket %s not found", bucket)
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	entries, err := os.ReadDir(filepath.Join(l.root, "meta", bucket))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectList{}, xerrors.Errorf("bucket %s not found", bucket)
+	}
+	if err != nil {
+		l.logger.Error(err)
+		return ObjectList{}, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name, err := base64.RawURLEncoding.DecodeString(entry.Name())
+		if err != nil || string(name) <= marker {
+			continue
+		}
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	list := ObjectList{}
+	if max > 0 && len(names) > max {
+		names = names[:max]
+		list.IsTruncated = true
+		list.NextMarker = names[max-1]
+	}
+
+	list.Objects = make([]ObjectInfo, 0, len(names))
+	for _, name := range names {
+		info, err := l.objectInfo(bucket, name)
+		if err != nil {
+			l.logger.Error(err)
+			return ObjectList{}, err
+		}
+		list.Objects = append(list.Objects, info)
+	}
+
+	return list, nil
+}
+
+// Health of a local disk is always good
+func (l *Local) Health() NodeHealth {
+	return NodeHealth{Healthy: true, Addr: l.root}
+}
+
+func (l *Local) Close() {}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
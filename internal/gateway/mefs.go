@@ -5,131 +5,132 @@ import (
 	"io"
 
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/did-server/config"
 	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
 )
 
 type Mefs struct {
-	addr    string
-	headers http.Header
-	logger  *log.Helper
+	node   *nodeClient
+	cancel context.CancelFunc
+	logger *log.Helper
 }
 
-func NewStorage(logger *log.Helper) (*Mefs, error) {
-	repoDir := os.Getenv("MEFS_PATH")
-	addr, headers, err := getMemoClientInfo(repoDir)
-	if err != nil {
-		logger.Error(err)
-		return nil, err
-	}
-
-	napi, closer, err := newUserNode(context.Background(), addr, headers)
-	if err != nil {
-		logger.Error(err)
-		return nil, err
-	}
+// NewMefs connects to the mefs node of cfg.RepoPath. A node that is down
+// does not fail it, storage calls return ErrUnavailable until it is back.
+func NewMefs(cfg *config.StorageConfig, logger *log.Helper) (*Mefs, error) {
+	return newMefs(func() (string, http.Header, error) {
+		return getMemoClientInfo(cfg.RepoPath)
+	}, logger), nil
+}
 
-	defer closer()
-	_, err = napi.ShowStorage(context.Background())
+func NewStorageWithApiAndToken(sapi, token string, cfg *config.StorageConfig, logger *log.Helper) (*Mefs, error) {
+	addr, headers, err := createMemoClientInfo(sapi, token)
 	if err != nil {
-		logger.Error(err)
 		return nil, err
 	}
 
-	return &Mefs{
-		addr:    addr,
-		headers: headers,
-		logger:  logger,
-	}, nil
+	return newMefs(func() (string, http.Header, error) {
+		return addr, headers, nil
+	}, logger), nil
 }
 
-func NewStorageWithApiAndToken(sapi, token string, logger *log.Helper) (*Mefs, error) {
-	addr, headers, err := createMemoClientInfo(sapi, token)
-	if err != nil {
-		return nil, err
-	}
+func newMefs(info func() (string, http.Header, error), logger *log.Helper) *Mefs {
+	ctx, cancel := context.WithCancel(context.Background())
+	node := newNodeClient(info, logger)
 
-	napi, closer, err := newUserNode(context.Background(), addr, headers)
+	// the first check runs before serving so a healthy node is used at once
+	err := node.check(ctx)
 	if err != nil {
-		return nil, err
+		logger.Warnf("starting without storage: %s", err)
 	}
+	go node.run(ctx)
 
-	defer closer()
-	_, err = napi.ShowStorage(context.Background())
-	if err != nil {
-		logger.Error(err)
-		return nil, err
+	return &Mefs{
+		node:   node,
+		cancel: cancel,
+		logger: logger,
 	}
+}
 
-	return &Mefs{
-		addr:    addr,
-		headers: headers,
-	}, nil
+// Health reports whether the node is connected
+func (m *Mefs) Health() NodeHealth {
+	return m.node.health()
+}
+
+// Close stops checking and disconnects from the node
+func (m *Mefs) Close() {
+	m.cancel()
 }
 
 func (m *Mefs) MakeBucketWithLocation(ctx context.Context, bucket string) error {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return err
 	}
-
-	defer closer()
 	opts := DefaultBucketOptions()
 
 	_, err = napi.CreateBucket(ctx, bucket, opts)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return err
 	}
 	return nil
 }
 
 func (m *Mefs) CheckBucket(ctx context.Context, bucket string) bool {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return false
 	}
-	defer closer()
 
 	bi, err := napi.HeadBucket(ctx, bucket)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return false
 	}
 	return bi.Confirmed
 }
 
-func (m *Mefs) PutObject(ctx context.Context, bucket, object string) (objInfo ObjectInfo, err error) {
-	path := config.CachePath + "/" + bucket + object
-	fi, err := os.Open(path)
+// PutObject streams r into bucket as object. Mid is the cid the other
+// backends give the content, an object whose mefs etag differs is deleted
+// and the put fails.
+func (m *Mefs) PutObject(ctx context.Context, bucket, object string, r io.Reader) (objInfo ObjectInfo, err error) {
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return objInfo, err
 	}
-	defer fi.Close()
 
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	poo := CidUploadOption()
+
+	cr := NewCidReader(r)
+	moi, err := napi.PutObject(ctx, bucket, object, cr, poo)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return objInfo, err
 	}
-	defer closer()
-
-	poo := CidUploadOption()
 
-	moi, err := napi.PutObject(ctx, bucket, object, fi, poo)
+	etag, err := ToString(moi.ETag)
+	if err == nil && etag != cr.Cid() {
+		err = xerrors.Errorf("object %s/%s: mefs etag %s, cid %s", bucket, object, etag, cr.Cid())
+	}
 	if err != nil {
 		m.logger.Error(err)
+		derr := napi.DeleteObject(context.WithoutCancel(ctx), bucket, object)
+		if derr != nil {
+			m.logger.Errorf("delete object %s/%s: %s", bucket, object, derr)
+		}
 		return objInfo, err
 	}
 
-	etag, _ := ToString(moi.ETag)
-
 	return ObjectInfo{
 		Bucket:     bucket,
 		Name:       moi.Name,
@@ -139,26 +140,21 @@ func (m *Mefs) PutObject(ctx context.Context, bucket, object string) (objInfo Ob
 	}, nil
 }
 
-func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Writer) error {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+// GetObject writes length bytes of object from start to w, segment by segment
+// as they are read. Object is a name in bucket, or a mid with an empty bucket.
+// It stops at the first failed segment and returns how much was written.
+func (m *Mefs) GetObject(ctx context.Context, bucket, object string, start, length int64, w io.Writer) (int64, error) {
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
-		return err
+		return 0, err
 	}
-	defer closer()
-
-	objInfo, err := napi.HeadObject(ctx, "", objectName)
-	if err != nil {
-		m.logger.Error(err)
-		return err
-	}
-	length := int64(objInfo.Size)
 
 	stepLen := int64(DefaultSegSize * 16)
 	stepAccMax := 16
 
-	start := int64(0)
-	end := length
+	end := start + length
+	written := int64(0)
 	stepacc := 1
 	for start < end {
 		if stepacc > stepAccMax {
@@ -175,52 +171,63 @@ func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Write
 			Length: readLen,
 		}
 
-		data, err := napi.GetObject(ctx, "", objectName, doo)
+		data, err := napi.GetObject(ctx, bucket, object, doo)
 		if err != nil {
-			//log.Println("received length err is:", start, readLen, stepLen, err)
 			m.logger.Error(err)
-			break
+			m.node.report(err)
+			return written, xerrors.Errorf("read %s at %d: %w", object, start, err)
+		}
+		if int64(len(data)) != readLen {
+			return written, xerrors.Errorf("read %s at %d: got %d bytes, want %d", object, start, len(data), readLen)
+		}
+
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
 		}
-		writer.Write(data)
-		start += int64(readLen)
+		start += readLen
 		stepacc *= 2
 	}
 
-	return nil
-
+	return written, nil
 }
 
 func (m *Mefs) GetObjectInfoByMid(ctx context.Context, mid string) (ObjectInfo, error) {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return ObjectInfo{}, err
 	}
-	defer closer()
 
 	obi, err := napi.HeadObject(ctx, "", mid)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return ObjectInfo{}, err
 	}
 
+	etag, _ := EtagToString(obi.ETag)
+
 	return ObjectInfo{
-		Name: obi.Name,
-		Size: int64(obi.Size),
+		Name:       obi.Name,
+		Size:       int64(obi.Size),
+		Mid:        etag,
+		CreateTime: time.Unix(obi.GetTime(), 0),
 	}, nil
 }
 
 func (m *Mefs) GetObjectInfo(ctx context.Context, bucket, object string) (ObjectInfo, error) {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return ObjectInfo{}, err
 	}
-	defer closer()
 
 	obi, err := napi.HeadObject(ctx, bucket, object)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return ObjectInfo{}, err
 	}
 
@@ -236,18 +243,54 @@ func (m *Mefs) GetObjectInfo(ctx context.Context, bucket, object string) (Object
 }
 
 func (m *Mefs) DeleteObject(ctx context.Context, bucket, object string) error {
-	napi, closer, err := newUserNode(ctx, m.addr, m.headers)
+	napi, err := m.node.get()
 	if err != nil {
 		m.logger.Error(err)
 		return err
 	}
 
-	defer closer()
-
 	err = napi.DeleteObject(ctx, bucket, object)
 	if err != nil {
 		m.logger.Error(err)
+		m.node.report(err)
 		return err
 	}
 	return nil
 }
+
+// ListObjects returns up to max objects of bucket whose names sort after marker
+func (m *Mefs) ListObjects(ctx context.Context, bucket, marker string, max int) (ObjectList, error) {
+	napi, err := m.node.get()
+	if err != nil {
+		m.logger.Error(err)
+		return ObjectList{}, err
+	}
+
+	loi, err := napi.ListObjects(ctx, bucket, ListObjectsOptions{Marker: marker, MaxKeys: max})
+	if err != nil {
+		m.logger.Error(err)
+		m.node.report(err)
+		return ObjectList{}, err
+	}
+
+	list := ObjectList{
+		Objects:     make([]ObjectInfo, 0, len(loi.Objects)),
+		IsTruncated: loi.IsTruncated,
+		NextMarker:  loi.NextMarker,
+	}
+	for _, obi := range loi.Objects {
+		etag, _ := EtagToString(obi.ETag)
+		list.Objects = append(list.Objects, ObjectInfo{
+			Bucket:     bucket,
+			Name:       obi.Name,
+			Size:       int64(obi.Size),
+			Mid:        etag,
+			CreateTime: time.Unix(obi.GetTime(), 0),
+		})
+	}
+	if list.IsTruncated && list.NextMarker == "" && len(list.Objects) > 0 {
+		list.NextMarker = list.Objects[len(list.Objects)-1].Name
+	}
+
+	return list, nil
+}
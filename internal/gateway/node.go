@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+var ErrUnavailable = xerrors.New("storage node unavailable")
+
+var (
+	nodeCheckInterval = 10 * time.Second
+	nodeCheckTimeout  = 10 * time.Second
+	nodeMinBackoff    = time.Second
+	nodeMaxBackoff    = 30 * time.Second
+)
+
+// NodeHealth is the connection state of the storage node
+type NodeHealth struct {
+	Healthy bool      `json:"healthy"`
+	Addr    string    `json:"addr,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// nodeClient keeps one json-rpc connection to the node for all requests. It
+// checks the node periodically and redials with backoff after a failure,
+// requests fail fast with ErrUnavailable meanwhile.
+type nodeClient struct {
+	info   func() (string, http.Header, error)
+	logger *log.Helper
+
+	lock    sync.RWMutex
+	api     UserNode
+	closer  jsonrpc.ClientCloser
+	addr    string
+	healthy bool
+	err     error
+	since   time.Time
+
+	failed chan struct{}
+}
+
+func newNodeClient(info func() (string, http.Header, error), logger *log.Helper) *nodeClient {
+	return &nodeClient{
+		info:   info,
+		logger: logger,
+		since:  time.Now(),
+		failed: make(chan struct{}, 1),
+	}
+}
+
+// run checks the node until ctx is done, the connection lives as long as ctx
+func (n *nodeClient) run(ctx context.Context) {
+	backoff := nodeMinBackoff
+	for {
+		wait := nodeCheckInterval
+		if err := n.check(ctx); err != nil {
+			wait = backoff
+			backoff = min(backoff*2, nodeMaxBackoff)
+		} else {
+			backoff = nodeMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			n.reset()
+			return
+		case <-time.After(wait):
+		case <-n.failed:
+		}
+	}
+}
+
+// check dials the node if needed and asks for its storage
+func (n *nodeClient) check(ctx context.Context) error {
+	n.lock.RLock()
+	api := n.api
+	n.lock.RUnlock()
+
+	if api == nil {
+		addr, headers, err := n.info()
+		if err != nil {
+			n.setHealth(false, err)
+			return err
+		}
+
+		napi, closer, err := newUserNode(ctx, addr, headers)
+		if err != nil {
+			n.setHealth(false, err)
+			return err
+		}
+
+		n.lock.Lock()
+		n.api, n.closer, n.addr = napi, closer, addr
+		n.lock.Unlock()
+		api = napi
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, nodeCheckTimeout)
+	defer cancel()
+	_, err := api.ShowStorage(cctx)
+	if err != nil {
+		// redial next time, the node may be back with a new api or token
+		n.reset()
+		n.setHealth(false, err)
+		return err
+	}
+
+	n.setHealth(true, nil)
+	return nil
+}
+
+func (n *nodeClient) reset() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.closer != nil {
+		n.closer()
+	}
+	n.api, n.closer = nil, nil
+}
+
+func (n *nodeClient) setHealth(healthy bool, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if healthy != n.healthy {
+		n.since = time.Now()
+		if healthy {
+			n.logger.Infof("storage node %s is available", n.addr)
+		} else {
+			n.logger.Warnf("storage node %s is unavailable: %s", n.addr, err)
+		}
+	}
+	n.healthy = healthy
+	n.err = err
+}
+
+// get returns the connection, or ErrUnavailable while the node is down
+func (n *nodeClient) get() (UserNode, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if !n.healthy || n.api == nil {
+		if n.err != nil {
+			return nil, xerrors.Errorf("%w: %s", ErrUnavailable, n.err)
+		}
+		return nil, ErrUnavailable
+	}
+	return n.api, nil
+}
+
+// report marks the node down after a connection error so that it is checked
+// right away
+func (n *nodeClient) report(err error) {
+	var connErr *jsonrpc.RPCConnectionError
+	if err == nil || !errors.As(err, &connErr) {
+		return
+	}
+
+	n.setHealth(false, err)
+	select {
+	case n.failed <- struct{}{}:
+	default:
+	}
+}
+
+func (n *nodeClient) health() NodeHealth {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	h := NodeHealth{Healthy: n.healthy, Addr: n.addr, Since: n.since}
+	if n.err != nil {
+		h.Error = n.err.Error()
+	}
+	return h
+}
@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// HashReader computes the Keccak256 hash and size of everything read through it
+type HashReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func NewHashReader(r io.Reader) *HashReader {
+	return &HashReader{r: r, h: crypto.NewKeccakState()}
+}
+
+func (hr *HashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.size += int64(n)
+	return n, err
+}
+
+// Hash returns the hex Keccak256 of the bytes read so far, as crypto.Keccak256
+func (hr *HashReader) Hash() string {
+	return hex.EncodeToString(hr.h.Sum(nil))
+}
+
+func (hr *HashReader) Size() int64 {
+	return hr.size
+}
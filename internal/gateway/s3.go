@@ -0,0 +1,552 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/did-server/config"
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+const (
+	s3MetaCid         = "X-Amz-Meta-Cid"
+	s3EmptyPayloadSum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3 keeps objects in one bucket of an S3 compatible service, with the same
+// layout as Local:
+//
+//	buckets/<bucket>        empty marker of a bucket
+//	objects/<bucket>/<name> object content, its cid in the cid metadata
+//	cids/<cid>              bucket and name of the last object with that cid
+//
+// Requests are signed with AWS signature version 4.
+type S3 struct {
+	endpoint *url.URL
+	cfg      config.S3Config
+	client   *http.Client
+	logger   *log.Helper
+
+	lock    sync.RWMutex
+	healthy bool
+	err     error
+	since   time.Time
+
+	cancel context.CancelFunc
+}
+
+func NewS3(cfg *config.S3Config, logger *log.Helper) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, xerrors.Errorf("s3 endpoint %s is not a http url", cfg.Endpoint)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &S3{
+		endpoint: endpoint,
+		cfg:      *cfg,
+		client:   &http.Client{},
+		logger:   logger,
+		since:    time.Now(),
+		cancel:   cancel,
+	}
+
+	err = s.check(ctx)
+	if err != nil {
+		logger.Warnf("starting without storage: %s", err)
+	}
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// run checks the service until ctx is done
+func (s *S3) run(ctx context.Context) {
+	for {
+		wait := nodeCheckInterval
+		if s.check(ctx) != nil {
+			wait = nodeMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (s *S3) check(ctx context.Context) error {
+	cctx, cancel := context.WithTimeout(ctx, nodeCheckTimeout)
+	defer cancel()
+
+	res, err := s.do(cctx, http.MethodHead, "", nil, nil, nil, "")
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			err = xerrors.Errorf("s3 bucket %s: %s", s.cfg.Bucket, res.Status)
+		}
+	}
+	s.setHealth(err == nil, err)
+	return err
+}
+
+func (s *S3) setHealth(healthy bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if healthy != s.healthy {
+		s.since = time.Now()
+		if healthy {
+			s.logger.Infof("s3 storage %s is available", s.endpoint.Host)
+		} else {
+			s.logger.Warnf("s3 storage %s is unavailable: %s", s.endpoint.Host, err)
+		}
+	}
+	s.healthy = healthy
+	s.err = err
+}
+
+func (s *S3) Health() NodeHealth {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	h := NodeHealth{Healthy: s.healthy, Addr: s.endpoint.Host, Since: s.since}
+	if s.err != nil {
+		h.Error = s.err.Error()
+	}
+	return h
+}
+
+func (s *S3) Close() {
+	s.cancel()
+}
+
+func (s *S3) MakeBucketWithLocation(ctx context.Context, bucket string) error {
+	err := s.put(ctx, "buckets/"+bucket, nil, 0, s3EmptyPayloadSum, nil)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (s *S3) CheckBucket(ctx context.Context, bucket string) bool {
+	_, err := s.head(ctx, "buckets/"+bucket)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		s.logger.Error(err)
+	}
+	return err == nil
+}
+
+// PutObject spools r to a temporary file to learn its size, sha256 and cid,
+// which S3 needs before the upload starts
+func (s *S3) PutObject(ctx context.Context, bucket, object string, r io.Reader) (ObjectInfo, error) {
+	tmp, err := os.CreateTemp("", "did-s3-")
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	cr := NewCidReader(r)
+	_, err = io.Copy(tmp, cr)
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{
+		Bucket:     bucket,
+		Name:       object,
+		Size:       cr.Size(),
+		Mid:        cr.Cid(),
+		CreateTime: time.Now().Truncate(time.Second),
+	}
+
+	header := http.Header{}
+	header.Set(s3MetaCid, info.Mid)
+	err = s.put(ctx, objectKey(bucket, object), tmp, info.Size, cr.Sha256(), header)
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+
+	loc, _ := json.Marshal(objectLocation{Bucket: bucket, Name: object})
+	sum := sha256.Sum256(loc)
+	err = s.put(ctx, "cids/"+info.Mid, bytes.NewReader(loc), int64(len(loc)), hex.EncodeToString(sum[:]), nil)
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectInfo{}, err
+	}
+
+	return info, nil
+}
+
+func (s *S3) GetObject(ctx context.Context, bucket, object string, start, length int64, w io.Writer) (int64, error) {
+	if bucket == "" {
+		loc, err := s.locate(ctx, object)
+		if err != nil {
+			return 0, err
+		}
+		bucket, object = loc.Bucket, loc.Name
+	}
+	if length == 0 {
+		return 0, nil
+	}
+
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+length-1))
+	res, err := s.do(ctx, http.MethodGet, objectKey(bucket, object), nil, header, nil, s3EmptyPayloadSum)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return 0, s3Error(res, object)
+	}
+
+	written, err := io.Copy(w, io.LimitReader(res.Body, length))
+	if err == nil && written != length {
+		err = xerrors.Errorf("read %s at %d: got %d bytes, want %d", object, start, written, length)
+	}
+	return written, err
+}
+
+func (s *S3) GetObjectInfo(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	header, err := s.head(ctx, objectKey(bucket, object))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	created, _ := http.ParseTime(header.Get("Last-Modified"))
+	return ObjectInfo{
+		Bucket:     bucket,
+		Name:       object,
+		Size:       size,
+		Mid:        header.Get(s3MetaCid),
+		CreateTime: created,
+	}, nil
+}
+
+func (s *S3) GetObjectInfoByMid(ctx context.Context, mid string) (ObjectInfo, error) {
+	loc, err := s.locate(ctx, mid)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.GetObjectInfo(ctx, loc.Bucket, loc.Name)
+}
+
+func (s *S3) locate(ctx context.Context, mid string) (objectLocation, error) {
+	var loc objectLocation
+	if mid == "" || strings.Contains(mid, "/") {
+		return loc, ErrObjectNotFound
+	}
+
+	res, err := s.do(ctx, http.MethodGet, "cids/"+mid, nil, nil, nil, s3EmptyPayloadSum)
+	if err != nil {
+		return loc, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return loc, s3Error(res, mid)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&loc)
+	return loc, err
+}
+
+func (s *S3) DeleteObject(ctx context.Context, bucket, object string) error {
+	info, err := s.GetObjectInfo(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+
+	err = s.delete(ctx, objectKey(bucket, object))
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+
+	// keep the cid pointing to an object if it is still there
+	loc, err := s.locate(ctx, info.Mid)
+	if err == nil && loc.Bucket == bucket && loc.Name == object {
+		err = s.delete(ctx, "cids/"+info.Mid)
+		if err != nil {
+			s.logger.Error(err)
+		}
+	}
+
+	return nil
+}
+
+type s3ListResult struct {
+	IsTruncated bool `xml:"IsTruncated"`
+	Contents    []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// ListObjects lists the keys under the bucket prefix, then heads each of them
+// for its cid which listing does not return
+func (s *S3) ListObjects(ctx context.Context, bucket, marker string, max int) (ObjectList, error) {
+	prefix := objectKey(bucket, "")
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	query.Set("max-keys", strconv.Itoa(max))
+	if marker != "" {
+		query.Set("start-after", prefix+marker)
+	}
+
+	res, err := s.do(ctx, http.MethodGet, "", query, nil, nil, s3EmptyPayloadSum)
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectList{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ObjectList{}, s3Error(res, bucket)
+	}
+
+	var result s3ListResult
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		s.logger.Error(err)
+		return ObjectList{}, err
+	}
+
+	list := ObjectList{
+		Objects:     make([]ObjectInfo, 0, len(result.Contents)),
+		IsTruncated: result.IsTruncated,
+	}
+	for _, content := range result.Contents {
+		info, err := s.GetObjectInfo(ctx, bucket, strings.TrimPrefix(content.Key, prefix))
+		if err != nil {
+			s.logger.Error(err)
+			return ObjectList{}, err
+		}
+		list.Objects = append(list.Objects, info)
+	}
+	if list.IsTruncated && len(list.Objects) > 0 {
+		list.NextMarker = list.Objects[len(list.Objects)-1].Name
+	}
+
+	return list, nil
+}
+
+func objectKey(bucket, object string) string {
+	return "objects/" + bucket + "/" + object
+}
+
+func (s *S3) put(ctx context.Context, key string, body io.Reader, size int64, sum string, header http.Header) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	res, err := s.do(ctx, http.MethodPut, key, nil, header, body, sum)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3Error(res, key)
+	}
+	return nil
+}
+
+func (s *S3) head(ctx context.Context, key string) (http.Header, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, s3EmptyPayloadSum)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, s3Error(res, key)
+	}
+	return res.Header, nil
+}
+
+func (s *S3) delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil, s3EmptyPayloadSum)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return s3Error(res, key)
+	}
+	return nil
+}
+
+// do sends a signed request for key of the configured bucket. A failure to
+// reach the service marks it unhealthy.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, sum string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/" + s.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3EscapeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if n := req.Header.Get("Content-Length"); n != "" {
+		req.ContentLength, _ = strconv.ParseInt(n, 10, 64)
+		req.Header.Del("Content-Length")
+	}
+	if sum == "" {
+		sum = s3EmptyPayloadSum
+	}
+	s.sign(req, sum, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		s.setHealth(false, err)
+		return nil, xerrors.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	return res, nil
+}
+
+// sign adds an AWS signature version 4 Authorization header
+func (s *S3) sign(req *http.Request, sum string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", sum)
+
+	signed := []string{"host"}
+	canonical := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" {
+			signed = append(signed, lk)
+			canonical[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	sort.Strings(signed)
+
+	var headers strings.Builder
+	for _, k := range signed {
+		headers.WriteString(k + ":" + canonical[k] + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		sum,
+	}, "\n")
+	requestSum := sha256.Sum256([]byte(request))
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := []byte("AWS4" + s.cfg.SecretKey)
+	for _, part := range []string{date, s.cfg.Region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, hex.EncodeToString(key)))
+}
+
+// s3EscapePath escapes every byte but unreserved ones and slashes, as the
+// canonical uri of signature version 4
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || s3Unreserved(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EscapeQuery is the canonical query string, sorted and fully escaped
+func s3EscapeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3EscapeComponent(k)+"="+s3EscapeComponent(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EscapeComponent(s string) string {
+	return strings.ReplaceAll(s3EscapePath(s), "/", "%2F")
+}
+
+func s3Unreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+func s3Error(res *http.Response, key string) error {
+	if res.StatusCode == http.StatusNotFound {
+		return ErrObjectNotFound
+	}
+
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return xerrors.Errorf("s3 %s: %s %s: %s", key, res.Status, e.Code, e.Message)
+	}
+	return xerrors.Errorf("s3 %s: %s", key, res.Status)
+}
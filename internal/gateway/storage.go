@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"context"
+	"io"
+
+	"github.com/did-server/config"
+	"github.com/go-kratos/kratos/v2/log"
+	"golang.org/x/xerrors"
+)
+
+var ErrObjectNotFound = xerrors.New("object not found")
+
+// Storage holds the uploaded files in buckets. Every object gets a cid as
+// its mid, objects are read by bucket and name or, with an empty bucket, by
+// mid.
+type Storage interface {
+	MakeBucketWithLocation(ctx context.Context, bucket string) error
+	CheckBucket(ctx context.Context, bucket string) bool
+	PutObject(ctx context.Context, bucket, object string, r io.Reader) (ObjectInfo, error)
+	GetObject(ctx context.Context, bucket, object string, start, length int64, w io.Writer) (int64, error)
+	GetObjectInfo(ctx context.Context, bucket, object string) (ObjectInfo, error)
+	GetObjectInfoByMid(ctx context.Context, mid string) (ObjectInfo, error)
+	DeleteObject(ctx context.Context, bucket, object string) error
+	ListObjects(ctx context.Context, bucket, marker string, max int) (ObjectList, error)
+
+	// Health reports whether the backend is reachable
+	Health() NodeHealth
+	Close()
+}
+
+// objectLocation is where the object of a cid is, in the cid index
+type objectLocation struct {
+	Bucket string
+	Name   string
+}
+
+var (
+	_ Storage = (*Mefs)(nil)
+	_ Storage = (*Local)(nil)
+	_ Storage = (*S3)(nil)
+)
+
+// NewStorage opens the backend selected by cfg.Type
+func NewStorage(cfg *config.StorageConfig, logger *log.Helper) (Storage, error) {
+	switch cfg.Type {
+	case config.StorageMefs, "":
+		return NewMefs(cfg, logger)
+	case config.StorageLocal:
+		return NewLocal(cfg.LocalPath, logger)
+	case config.StorageS3:
+		return NewS3(&cfg.S3, logger)
+	default:
+		return nil, xerrors.Errorf("unknown storage type %s", cfg.Type)
+	}
+}
@@ -0,0 +1,338 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/did-server/config"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func TestCidReader(t *testing.T) {
+	cr := NewCidReader(strings.NewReader("hello world"))
+	_, err := io.Copy(io.Discard, cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cr.Cid() != "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e" {
+		t.Fatalf("got cid %s", cr.Cid())
+	}
+	if cr.Size() != 11 {
+		t.Fatalf("got size %d", cr.Size())
+	}
+}
+
+func TestCidReaderLargeFile(t *testing.T) {
+	// several MEFS segments, read in small pieces
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<18)
+	cr := NewCidReader(bytes.NewReader(data))
+	_, err := io.CopyBuffer(io.Discard, cr, make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(data)
+	if cr.Sha256() != hex.EncodeToString(sum[:]) || cr.Size() != int64(len(data)) {
+		t.Fatalf("got sha256 %s size %d", cr.Sha256(), cr.Size())
+	}
+	whole := NewCidReader(bytes.NewReader(data))
+	io.ReadAll(whole)
+	if cr.Cid() != whole.Cid() {
+		t.Fatalf("cid %s depends on reads, %s in one", cr.Cid(), whole.Cid())
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	storage, err := NewLocal(t.TempDir(), log.NewHelper(log.DefaultLogger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	testStorage(t, storage)
+}
+
+func TestLocalStorageBounds(t *testing.T) {
+	storage, err := NewLocal(t.TempDir(), log.NewHelper(log.DefaultLogger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+	err = storage.MakeBucketWithLocation(ctx, "did")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		_, err = storage.PutObject(ctx, "did", name, strings.NewReader(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := storage.ListObjects(ctx, "did", "", 0)
+	if err != nil || len(list.Objects) != 2 || list.IsTruncated {
+		t.Fatalf("list without a limit: got %+v %v", list, err)
+	}
+
+	for _, bucket := range []string{"..", "did/..", `did\..`, "meta"} {
+		_, err = storage.GetObjectInfo(ctx, bucket, "a.txt")
+		if err != ErrObjectNotFound {
+			t.Fatalf("info in bucket %q: got %v", bucket, err)
+		}
+		_, err = storage.GetObject(ctx, bucket, "a.txt", 0, 1, io.Discard)
+		if err != ErrObjectNotFound {
+			t.Fatalf("read in bucket %q: got %v", bucket, err)
+		}
+		err = storage.DeleteObject(ctx, bucket, "a.txt")
+		if err != ErrObjectNotFound {
+			t.Fatalf("delete in bucket %q: got %v", bucket, err)
+		}
+		_, err = storage.ListObjects(ctx, bucket, "", 0)
+		if err == nil {
+			t.Fatalf("list of bucket %q", bucket)
+		}
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	srv := httptest.NewServer(newS3Stub(t, "did"))
+	defer srv.Close()
+
+	storage, err := NewS3(&config.S3Config{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		Bucket:    "did",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, log.NewHelper(log.DefaultLogger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	if !storage.Health().Healthy {
+		t.Fatalf("stub not healthy: %+v", storage.Health())
+	}
+
+	testStorage(t, storage)
+}
+
+// testStorage runs the same operations on every backend, the cids must match
+func testStorage(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	bucket := "0xabc"
+
+	if storage.CheckBucket(ctx, bucket) {
+		t.Fatal("bucket exists before it is made")
+	}
+	err := storage.MakeBucketWithLocation(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.CheckBucket(ctx, bucket) {
+		t.Fatal("bucket not made")
+	}
+
+	data := []byte("hello world")
+	info, err := storage.PutObject(ctx, bucket, "dir/a b.txt", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mid != "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e" || info.Size != int64(len(data)) {
+		t.Fatalf("put: got %+v", info)
+	}
+	_, err = storage.PutObject(ctx, bucket, "b.txt", strings.NewReader("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := storage.GetObjectInfo(ctx, bucket, "dir/a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mid != info.Mid || got.Size != info.Size || got.CreateTime.IsZero() {
+		t.Fatalf("info: got %+v, want %+v", got, info)
+	}
+	got, err = storage.GetObjectInfoByMid(ctx, info.Mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "dir/a b.txt" {
+		t.Fatalf("info by mid: got %+v", got)
+	}
+
+	var buf bytes.Buffer
+	n, err := storage.GetObject(ctx, bucket, "dir/a b.txt", 6, 5, &buf)
+	if err != nil || n != 5 || buf.String() != "world" {
+		t.Fatalf("range: got %q %d %v", buf.String(), n, err)
+	}
+	buf.Reset()
+	_, err = storage.GetObject(ctx, "", info.Mid, 0, info.Size, &buf)
+	if err != nil || buf.String() != "hello world" {
+		t.Fatalf("by mid: got %q %v", buf.String(), err)
+	}
+
+	list, err := storage.ListObjects(ctx, bucket, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Objects) != 1 || list.Objects[0].Name != "b.txt" || !list.IsTruncated || list.NextMarker != "b.txt" {
+		t.Fatalf("list: got %+v", list)
+	}
+	list, err = storage.ListObjects(ctx, bucket, list.NextMarker, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Objects) != 1 || list.Objects[0].Name != "dir/a b.txt" || list.Objects[0].Mid != info.Mid || list.IsTruncated {
+		t.Fatalf("list next: got %+v", list)
+	}
+
+	err = storage.DeleteObject(ctx, bucket, "dir/a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetObjectInfo(ctx, bucket, "dir/a b.txt")
+	if err != ErrObjectNotFound {
+		t.Fatalf("deleted object: got %v", err)
+	}
+	_, err = storage.GetObjectInfoByMid(ctx, info.Mid)
+	if err != ErrObjectNotFound {
+		t.Fatalf("deleted mid: got %v", err)
+	}
+}
+
+type s3StubObject struct {
+	data     []byte
+	cid      string
+	modified time.Time
+}
+
+// s3Stub is an in memory S3 of one bucket, it serves what the S3 storage uses
+type s3Stub struct {
+	t      *testing.T
+	bucket string
+
+	lock    sync.Mutex
+	objects map[string]s3StubObject
+}
+
+func newS3Stub(t *testing.T, bucket string) *s3Stub {
+	return &s3Stub{t: t, bucket: bucket, objects: map[string]s3StubObject{}}
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key == "" {
+		if r.Method == http.MethodGet {
+			s.list(w, r)
+		}
+		return
+	}
+
+	obj, ok := s.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			s.t.Errorf("put %s: payload sha256 mismatch", key)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = s3StubObject{data: data, cid: r.Header.Get(s3MetaCid), modified: time.Now()}
+	case http.MethodHead, http.MethodGet:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", obj.modified.UTC().Format(http.TimeFormat))
+		if obj.cid != "" {
+			w.Header().Set(s3MetaCid, obj.cid)
+		}
+
+		data := obj.data
+		status := http.StatusOK
+		if rg := r.Header.Get("Range"); rg != "" {
+			first, last, _ := strings.Cut(strings.TrimPrefix(rg, "bytes="), "-")
+			start, _ := strconv.Atoi(first)
+			end, _ := strconv.Atoi(last)
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *s3Stub) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := query.Get("start-after")
+	max, _ := strconv.Atoi(query.Get("max-keys"))
+
+	keys := []string{}
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key string `xml:"Key"`
+	}
+	res := struct {
+		XMLName     xml.Name  `xml:"ListBucketResult"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Contents    []content `xml:"Contents"`
+	}{}
+	if len(keys) > max {
+		keys = keys[:max]
+		res.IsTruncated = true
+	}
+	for _, key := range keys {
+		res.Contents = append(res.Contents, content{Key: key})
+	}
+
+	data, _ := xml.Marshal(res)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
@@ -67,6 +67,18 @@ type DownloadObjectOptions struct {
 	Start, Length int64
 }
 
+type ListObjectsOptions struct {
+	Prefix, Marker, Delimiter string
+	MaxKeys                   int
+}
+
+type ListObjectsInfo struct {
+	Objects        []MefsObjectInfo
+	CommonPrefixes []string
+	IsTruncated    bool
+	NextMarker     string
+}
+
 func DefaultBucketOptions() pb.BucketOption {
 	return pb.BucketOption{
 		Version:     1,
@@ -98,3 +110,10 @@ type ObjectInfo struct {
 	Mid        string
 	CreateTime time.Time
 }
+
+// ObjectList is a page of objects, the next page starts after NextMarker
+type ObjectList struct {
+	Objects     []ObjectInfo
+	IsTruncated bool
+	NextMarker  string
+}
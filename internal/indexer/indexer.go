@@ -0,0 +1,314 @@
+// Package indexer follows the logs of the DID contracts into the database,
+// so that the history of a DID is answered without a call per identifier.
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/contract"
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/memoio/did-solidity/go-contracts/accountdid"
+	"github.com/memoio/did-solidity/go-contracts/filedid"
+	"github.com/memoio/did-solidity/go-contracts/proxy"
+)
+
+var (
+	// reorgDepth is how many indexed blocks are compared with the chain to
+	// find where a reorg forked
+	reorgDepth = 64
+	// keepBlocks is how far below the newest indexed block older ones are
+	// kept for reorg checks
+	keepBlocks = uint64(1024)
+)
+
+// Backend is the chain the logs are read from
+type Backend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*etypes.Header, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]etypes.Log, error)
+}
+
+type Indexer struct {
+	backend   Backend
+	db        *database.DataBase
+	contracts map[common.Address]*abi.ABI
+	addresses []common.Address
+	start     uint64
+	batch     uint64
+	interval  time.Duration
+	logger    *log.Helper
+}
+
+// New indexes the account DID, mfile DID and proxy contracts of controller
+func New(controller *contract.Controller, db *database.DataBase, cfg *config.IndexerConfig, logger *log.Helper) (*Indexer, error) {
+	contracts := make(map[common.Address]*abi.ABI)
+	for addr, meta := range map[common.Address]*bind.MetaData{
+		controller.Account(): accountdid.AccountDidMetaData,
+		controller.File():    filedid.FileDidMetaData,
+		controller.Proxy():   proxy.ProxyMetaData,
+	} {
+		contractABI, err := meta.GetAbi()
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		contracts[addr] = contractABI
+	}
+
+	return NewWithContracts(controller.Backend(), db, contracts, cfg, logger), nil
+}
+
+// NewWithContracts indexes the logs of contracts decoded with their ABI
+func NewWithContracts(backend Backend, db *database.DataBase, contracts map[common.Address]*abi.ABI, cfg *config.IndexerConfig, logger *log.Helper) *Indexer {
+	addresses := make([]common.Address, 0, len(contracts))
+	for addr := range contracts {
+		addresses = append(addresses, addr)
+	}
+
+	return &Indexer{
+		backend:   backend,
+		db:        db,
+		contracts: contracts,
+		addresses: addresses,
+		start:     uint64(cfg.StartBlock),
+		batch:     uint64(cfg.BatchSize),
+		interval:  time.Duration(cfg.Interval) * time.Second,
+		logger:    logger,
+	}
+}
+
+// Run indexes until ctx is done, as fast as the node answers while behind
+// and every interval once at the head
+func (i *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	for {
+		head, err := i.Step(ctx)
+		if err != nil && ctx.Err() == nil {
+			i.logger.Warnf("index events: %s", err)
+		}
+
+		if err == nil && !head {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step indexes the next batch of blocks, after rolling back blocks that
+// were reorged out. It returns true once the head is indexed.
+func (i *Indexer) Step(ctx context.Context) (bool, error) {
+	from, err := i.rewind(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	head, err := i.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if from > head.Number.Uint64() {
+		return true, nil
+	}
+	to := min(from+i.batch-1, head.Number.Uint64())
+
+	logs, err := i.backend.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: i.addresses,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	last, err := i.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(to))
+	if err != nil {
+		return false, err
+	}
+
+	var events []database.Event
+	blocks := map[uint64]string{to: last.Hash().Hex()}
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		event, err := i.decode(l)
+		if err != nil {
+			i.logger.Warnf("decode log %d of tx %s: %s", l.Index, l.TxHash, err)
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		events = append(events, *event)
+		blocks[l.BlockNumber] = l.BlockHash.Hex()
+	}
+
+	indexed := make([]database.IndexedBlock, 0, len(blocks))
+	for number, hash := range blocks {
+		indexed = append(indexed, database.IndexedBlock{Number: number, Hash: hash})
+	}
+	sort.Slice(indexed, func(a, b int) bool { return indexed[a].Number < indexed[b].Number })
+
+	err = i.db.SaveEvents(events, indexed, keepBlocks)
+	if err != nil {
+		return false, err
+	}
+
+	return to == head.Number.Uint64(), nil
+}
+
+// rewind returns the block to index next. Indexed blocks no longer on
+// chain are rolled back to the newest one still on it.
+func (i *Indexer) rewind(ctx context.Context) (uint64, error) {
+	blocks, err := i.db.LastIndexedBlocks(reorgDepth)
+	if err != nil {
+		return 0, err
+	}
+	if len(blocks) == 0 {
+		return i.start, nil
+	}
+
+	for n, block := range blocks {
+		header, err := i.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(block.Number))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if header.Hash().Hex() != block.Hash {
+			continue
+		}
+
+		if n > 0 {
+			i.logger.Warnf("reorg after block %d, rolling back %d blocks", block.Number, blocks[0].Number-block.Number)
+			err = i.db.RollbackEvents(block.Number + 1)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return block.Number + 1, nil
+	}
+
+	oldest := blocks[len(blocks)-1].Number
+	i.logger.Warnf("reorg deeper than %d indexed blocks, indexing again from block %d", len(blocks), oldest)
+	err = i.db.RollbackEvents(oldest)
+	if err != nil {
+		return 0, err
+	}
+	return oldest, nil
+}
+
+// decode returns the event of l, nil if its contract does not declare it
+func (i *Indexer) decode(l etypes.Log) (*database.Event, error) {
+	contractABI, ok := i.contracts[l.Address]
+	if !ok || len(l.Topics) == 0 {
+		return nil, nil
+	}
+	ev, err := contractABI.EventByID(l.Topics[0])
+	if err != nil {
+		return nil, nil
+	}
+
+	args := make(map[string]interface{})
+	err = ev.Inputs.UnpackIntoMap(args, l.Data)
+	if err != nil {
+		return nil, err
+	}
+	var indexed abi.Arguments
+	for _, arg := range ev.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	err = abi.ParseTopicsIntoMap(args, indexed, l.Topics[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &database.Event{
+		Name:        ev.RawName,
+		Contract:    l.Address.Hex(),
+		Args:        string(data),
+		BlockNumber: l.BlockNumber,
+		BlockHash:   l.BlockHash.Hex(),
+		TxHash:      l.TxHash.Hex(),
+		LogIndex:    l.Index,
+	}
+
+	var controller string
+	for name, v := range args {
+		switch strings.ToLower(strings.TrimLeft(name, "_")) {
+		case "did":
+			event.Did = argString(v)
+		case "mfiledid", "mfile":
+			event.Mfile = argString(v)
+		case "controller":
+			controller = argString(v)
+		}
+	}
+	if event.Did == "" {
+		event.Did = controller
+	}
+
+	return event, nil
+}
+
+// argString is a string argument, or the hash of an indexed one
+func argString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case common.Hash:
+		return v.Hex()
+	}
+	return ""
+}
+
+// Events returns the events about the DID identifier did, of one name if
+// not empty, in chain order
+func (i *Indexer) Events(did, name string, offset, limit int) ([]database.Event, error) {
+	// indexed string arguments are only logged as their hash
+	dids := []string{did, crypto.Keccak256Hash([]byte(did)).Hex()}
+	return i.db.ListEvents(dids, name, offset, limit)
+}
+
+// Head returns the newest indexed block, 0 before the first one
+func (i *Indexer) Head() (uint64, error) {
+	block, err := i.db.LastIndexedBlock()
+	if errors.Is(err, database.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return block.Number, nil
+}
@@ -0,0 +1,217 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/database"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+const testABI = `[
+	{"type":"event","name":"CreateDID","inputs":[{"name":"did","type":"string","indexed":false},{"name":"methodType","type":"string","indexed":false}]},
+	{"type":"event","name":"DeactivateDID","inputs":[{"name":"did","type":"string","indexed":true},{"name":"deactivate","type":"bool","indexed":false}]},
+	{"type":"event","name":"RegisterMfileDid","inputs":[{"name":"mfileDid","type":"string","indexed":false},{"name":"controller","type":"string","indexed":false}]}
+]`
+
+var testContract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+// testChain is a chain of headers whose blocks from some number on can be
+// replaced by a fork
+type testChain struct {
+	headers []*etypes.Header
+	logs    map[uint64][]etypes.Log
+}
+
+func newTestChain(n uint64) *testChain {
+	c := &testChain{logs: make(map[uint64][]etypes.Log)}
+	c.fork(0, n, 0)
+	return c
+}
+
+// fork replaces the blocks from number on with n blocks of another fork
+func (c *testChain) fork(number, n uint64, fork byte) {
+	c.headers = c.headers[:number]
+	for num := range c.logs {
+		if num >= number {
+			delete(c.logs, num)
+		}
+	}
+	for i := uint64(0); i < n; i++ {
+		h := &etypes.Header{Number: new(big.Int).SetUint64(number + i), Extra: []byte{fork}, Difficulty: big.NewInt(1)}
+		if len(c.headers) > 0 {
+			h.ParentHash = c.headers[len(c.headers)-1].Hash()
+		}
+		c.headers = append(c.headers, h)
+	}
+}
+
+func (c *testChain) emit(t *testing.T, number uint64, name string, args ...interface{}) {
+	parsed, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := parsed.Events[name]
+
+	topics := []common.Hash{ev.ID}
+	var data []interface{}
+	for i, arg := range ev.Inputs {
+		if arg.Indexed {
+			topics = append(topics, crypto.Keccak256Hash([]byte(args[i].(string))))
+			continue
+		}
+		data = append(data, args[i])
+	}
+	packed, err := ev.Inputs.NonIndexed().Pack(data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.logs[number] = append(c.logs[number], etypes.Log{
+		Address:     testContract,
+		Topics:      topics,
+		Data:        packed,
+		BlockNumber: number,
+		BlockHash:   c.headers[number].Hash(),
+		TxHash:      common.BytesToHash([]byte{byte(number), byte(len(c.logs[number]))}),
+		Index:       uint(len(c.logs[number])),
+	})
+}
+
+func (c *testChain) HeaderByNumber(ctx context.Context, number *big.Int) (*etypes.Header, error) {
+	if number == nil {
+		return c.headers[len(c.headers)-1], nil
+	}
+	if number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *testChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]etypes.Log, error) {
+	var logs []etypes.Log
+	for num := q.FromBlock.Uint64(); num <= q.ToBlock.Uint64(); num++ {
+		logs = append(logs, c.logs[num]...)
+	}
+	return logs, nil
+}
+
+func newTestIndexer(t *testing.T, chain *testChain) *Indexer {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+	db, err := database.CreateDB(&cfg.Database, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Indexer.StartBlock = 1
+	cfg.Indexer.BatchSize = 4
+	return NewWithContracts(chain, db, map[common.Address]*abi.ABI{testContract: &parsed}, &cfg.Indexer, logger)
+}
+
+// indexAll steps until the head is indexed
+func indexAll(t *testing.T, idx *Indexer) {
+	for i := 0; i < 10; i++ {
+		head, err := idx.Step(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head {
+			return
+		}
+	}
+	t.Fatal("head not reached")
+}
+
+func eventNames(t *testing.T, idx *Indexer, did string) []string {
+	events, err := idx.Events(did, "", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestIndexerEvents(t *testing.T) {
+	chain := newTestChain(11)
+	chain.emit(t, 3, "CreateDID", "abc", "EcdsaSecp256k1VerificationKey2019")
+	chain.emit(t, 5, "RegisterMfileDid", "m1", "abc")
+	chain.emit(t, 5, "CreateDID", "other", "EcdsaSecp256k1VerificationKey2019")
+
+	idx := newTestIndexer(t, chain)
+	indexAll(t, idx)
+
+	names := eventNames(t, idx, "abc")
+	if strings.Join(names, ",") != "CreateDID,RegisterMfileDid" {
+		t.Fatalf("events of abc: %v", names)
+	}
+
+	events, err := idx.Events("abc", "RegisterMfileDid", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Mfile != "m1" || events[0].BlockNumber != 5 {
+		t.Fatalf("mfile events of abc: %+v", events)
+	}
+
+	head, err := idx.Head()
+	if err != nil || head != 10 {
+		t.Fatalf("indexed head %d: %v", head, err)
+	}
+
+	// nothing new, nothing indexed twice
+	indexAll(t, idx)
+	if names := eventNames(t, idx, "abc"); len(names) != 2 {
+		t.Fatalf("events of abc indexed again: %v", names)
+	}
+}
+
+func TestIndexerReorg(t *testing.T) {
+	chain := newTestChain(11)
+	chain.emit(t, 3, "CreateDID", "abc", "EcdsaSecp256k1VerificationKey2019")
+	chain.emit(t, 9, "CreateDID", "xyz", "EcdsaSecp256k1VerificationKey2019")
+
+	idx := newTestIndexer(t, chain)
+	indexAll(t, idx)
+	if names := eventNames(t, idx, "xyz"); len(names) != 1 {
+		t.Fatalf("events of xyz: %v", names)
+	}
+
+	// blocks from 6 on are replaced, xyz is not created on the new fork
+	chain.fork(6, 7, 1)
+	chain.emit(t, 7, "DeactivateDID", "abc", true)
+	indexAll(t, idx)
+
+	if names := eventNames(t, idx, "xyz"); len(names) != 0 {
+		t.Fatalf("reorged out events of xyz: %v", names)
+	}
+	names := eventNames(t, idx, "abc")
+	if strings.Join(names, ",") != "CreateDID,DeactivateDID" {
+		t.Fatalf("events of abc: %v", names)
+	}
+
+	head, err := idx.Head()
+	if err != nil || head != 12 {
+		t.Fatalf("indexed head %d: %v", head, err)
+	}
+}
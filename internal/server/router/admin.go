@@ -0,0 +1,47 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func loadAdminMoudles(r *gin.RouterGroup, h *handle) {
+	r.GET("/balance", h.getAdminBalance)
+	r.GET("/reconcile", h.getReconcile)
+}
+
+// @ Summary GetAdminBalance
+//	@Description	Balance of the admin account paying for registrations, how many registrations it pays for
+//	@Description	at the current gas price and whether registrations are paused for low funds
+//	@Tags			admin
+//	@Produce		json
+//	@Param			refresh	query		bool	false	"read the balance now instead of the last periodic read"
+//	@Success		200		{object}	contract.AdminBalance
+//	@Router			/admin/balance [get]
+//	@Failure		582		{object}	Error
+func (h *handle) getAdminBalance(c *gin.Context) {
+	watcher := h.did.Controller.Balance()
+	if c.Query("refresh") != "true" {
+		c.JSON(200, watcher.Get())
+		return
+	}
+
+	balance, err := watcher.Refresh(c.Request.Context())
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrAdminBalance.Code, gin.H{"message": ErrAdminBalance.Message, "error": err.Error()})
+		return
+	}
+
+	c.JSON(200, balance)
+}
+
+//	@Summary		GetReconcile
+//	@Description	Report of the last periodic check of the numbers DB against the DIDs on chain, null before the
+//	@Description	first one
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	did.ReconcileReport
+//	@Router			/admin/reconcile [get]
+func (h *handle) getReconcile(c *gin.Context) {
+	c.JSON(200, h.did.LastReconcile())
+}
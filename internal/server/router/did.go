@@ -1,24 +1,42 @@
 package router
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"strconv"
 
+	"github.com/did-server/internal/database"
+	"github.com/did-server/internal/did"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var maxAirdropBatch = 1000
+
+const (
+	defaultEventListLimit = 100
+	maxEventListLimit     = 1000
 )
 
 func loadDIDmoudles(r *gin.RouterGroup, h *handle) {
 	r.GET("/createsigmsg", h.getCreateSigMsg)
 	r.GET("/deletesigmsg", h.getDeleteSigMsg)
-	r.POST("/create", h.createDID)
-	r.POST("/createadmin", h.createDIDByAdmin)
-	r.POST("/createton", h.createDIDTonByAdmin)
+	r.GET("/addverifysigmsg", h.getAddVerifySigMsg)
+	r.GET("/changeverifysigmsg", h.getChangeVerifySigMsg)
+	r.POST("/create", h.requireFunds, h.createDID)
+	r.POST("/createadmin", h.requireFunds, h.createDIDByAdmin)
+	r.POST("/createadmin/batch", h.requireFunds, h.createDIDBatchByAdmin)
+	r.GET("/createadmin/batch", h.getDIDBatch)
+	r.POST("/createton", h.requireFunds, h.createDIDTonByAdmin)
 	r.GET("/info", h.getDIDInfo)
 	r.POST("/delete", h.deleteDID)
 	r.POST("/addverifyinfo", h.addVerifyInfo)
 	r.POST("/changeverifyinfo", h.changeVerifyInfo)
 	r.GET("/exist", h.getDIDExist)
 	r.GET("/number", h.getDIDNumber)
+	r.GET("/job", h.getJob)
+	r.GET("/events", h.getDIDEvents)
 
 }
 
@@ -33,7 +51,7 @@ func loadDIDmoudles(r *gin.RouterGroup, h *handle) {
 func (h *handle) getCreateSigMsg(c *gin.Context) {
 	address := c.Query("address")
 
-	msg, err := h.did.GetCreateSignatureMassageByAddress(address)
+	msg, err := h.did.GetCreateSignatureMassageByAddress(c.Request.Context(), address)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDGetSignatureMessage.Code, ErrDIDGetSignatureMessage)
@@ -51,7 +69,7 @@ func (h *handle) getCreateSigMsg(c *gin.Context) {
 //	@Produce		json
 //	@Param			sig		body		string	true	"user signature"
 //	@Param			address	body		string	true	"user address"
-//	@Success		200		{object}	CreateDIDResponse
+//	@Success		200		{object}	CreateDIDJobResponse
 //	@Router			/did/create [post]
 //	@Failure		502	{object}	Error
 //	@Failure		503	{object}	Error
@@ -81,14 +99,14 @@ func (h *handle) createDID(c *gin.Context) {
 
 	SigByte[len(SigByte)-1] %= 27
 
-	did, err := h.did.RegisterDIDByAddress(address, SigByte)
+	job, err := h.did.EnqueueRegisterDID(c.Request.Context(), database.JobRegisterDID, address, SigByte)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDCreateFailed.Code, ErrDIDCreateFailed)
 		return
 	}
 
-	c.JSON(200, CreateDIDResponse{DID: did})
+	c.JSON(200, CreateDIDJobResponse{ID: job.JobID, DID: job.DID, Status: job.Status})
 }
 
 //	@Summary		Create a new DID By Admin
@@ -97,8 +115,9 @@ func (h *handle) createDID(c *gin.Context) {
 //	@Accept			json
 //	@Produce		json
 //	@Param			address	body		string	true	"user address"
-//	@Success		200		{object}	CreateDIDResponse
+//	@Success		200		{object}	CreateDIDJobResponse
 //	@Router			/did/createadmin [post]
+//	@Failure		503		{object}	Error
 func (h *handle) createDIDByAdmin(c *gin.Context) {
 	body := make(map[string]interface{})
 	c.BindJSON(&body)
@@ -109,14 +128,91 @@ func (h *handle) createDIDByAdmin(c *gin.Context) {
 		return
 	}
 
-	did, err := h.did.RegisterDIDByAddressByAdmin(address)
+	job, err := h.did.EnqueueRegisterDID(c.Request.Context(), database.JobRegisterDIDAdmin, address, nil)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrDIDCreateFailed.Code, ErrDIDCreateFailed)
+		return
+	}
+
+	c.JSON(200, CreateDIDJobResponse{ID: job.JobID, DID: job.DID, Status: job.Status})
+}
+
+//	@Summary		Create DIDs for a list of addresses By Admin
+//	@Description	Queue free registrations for up to 1000 addresses. Addresses already registered are skipped,
+//	@Description	posting the same batch again only adds addresses that are not in it yet.
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			addresses	body		[]string	true	"user addresses"
+//	@Param			batch		body		string		false	"batch id, generated if empty"
+//	@Success		200			{object}	AirdropBatchResponse
+//	@Router			/did/createadmin/batch [post]
+//	@Failure		561			{object}	Error
+//	@Failure		503			{object}	Error
+func (h *handle) createDIDBatchByAdmin(c *gin.Context) {
+	body := make(map[string]interface{})
+	c.BindJSON(&body)
+	list, ok := body["addresses"].([]interface{})
+	if !ok || len(list) == 0 || len(list) > maxAirdropBatch {
+		h.logger.Error("addresses is not a valid list", body)
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	addresses := make([]string, 0, len(list))
+	for _, v := range list {
+		address, ok := v.(string)
+		if !ok {
+			h.logger.Error("address is not string", v)
+			c.JSON(ErrAddressNull.Code, ErrAddressNull)
+			return
+		}
+		addresses = append(addresses, address)
+	}
+
+	batch, _ := body["batch"].(string)
+	if batch == "" {
+		batch = uuid.New().String()
+	}
+
+	results, err := h.did.EnqueueAirdrop(c.Request.Context(), batch, addresses)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrDIDCreateFailed.Code, ErrDIDCreateFailed)
+		return
+	}
+
+	c.JSON(200, AirdropBatchResponse{Batch: batch, Done: did.AirdropDone(results), Results: results})
+}
+
+// @ Summary GetDIDBatch
+//	@Description	Get the per-address report of an airdrop batch
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			batch	query		string	true	"batch id"
+//	@Success		200		{object}	AirdropBatchResponse
+//	@Router			/did/createadmin/batch [get]
+func (h *handle) getDIDBatch(c *gin.Context) {
+	batch := c.Query("batch")
+	if batch == "" {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	results, err := h.did.AirdropReport(batch)
 	if err != nil {
 		h.logger.Error(err)
-		c.JSON(200, CreateDIDResponse{DID: did})
+		c.JSON(ErrDIDGetInfo.Code, gin.H{"message": ErrDIDGetInfo.Message, "error": err.Error()})
+		return
+	}
+	if len(results) == 0 {
+		c.JSON(ErrJobNotFound.Code, ErrJobNotFound)
 		return
 	}
 
-	c.JSON(200, CreateDIDResponse{DID: did})
+	c.JSON(200, AirdropBatchResponse{Batch: batch, Done: did.AirdropDone(results), Results: results})
 }
 
 //	@Summary		Create a new Ton DID By Admin
@@ -125,8 +221,9 @@ func (h *handle) createDIDByAdmin(c *gin.Context) {
 //	@Accept			json
 //	@Produce		json
 //	@Param			address	body		string	true	"user address"
-//	@Success		200		{object}	CreateDIDResponse
+//	@Success		200		{object}	CreateDIDJobResponse
 //	@Router			/did/createton [post]
+//	@Failure		503		{object}	Error
 func (h *handle) createDIDTonByAdmin(c *gin.Context) {
 	body := make(map[string]interface{})
 	c.BindJSON(&body)
@@ -138,14 +235,119 @@ func (h *handle) createDIDTonByAdmin(c *gin.Context) {
 		return
 	}
 
-	did, err := h.did.RegisterDIDByTomAdmin(address)
+	job, err := h.did.EnqueueRegisterDID(c.Request.Context(), database.JobRegisterDIDTon, address, nil)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDCreateFailed.Code, ErrDIDCreateFailed)
 		return
 	}
 
-	c.JSON(200, CreateDIDResponse{DID: did})
+	c.JSON(200, CreateDIDJobResponse{ID: job.JobID, DID: job.DID, Status: job.Status})
+}
+
+//	@Summary		GetDIDEvents
+//	@Description	Contract events of a DID from the event indexer in chain order: creation, deactivation,
+//	@Description	verification method changes and the mfile DIDs it registered
+//	@Tags			DID
+//	@Produce		json
+//	@Param			did		query		string	true	"did:memo DID"
+//	@Param			name	query		string	false	"only events of this name, e.g. DeactivateDID"
+//	@Param			offset	query		int		false	"events skipped"
+//	@Param			limit	query		int		false	"page size, at most 1000"
+//	@Success		200		{object}	DIDEventsResponse
+//	@Router			/did/events [get]
+//	@Failure		503		{object}	Error
+//	@Failure		580		{object}	Error
+func (h *handle) getDIDEvents(c *gin.Context) {
+	didStr := c.Query("did")
+	if didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	offset, limit := 0, defaultEventListLimit
+	if o := c.Query("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+			return
+		}
+		offset = n
+	}
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+			return
+		}
+		limit = min(n, maxEventListLimit)
+	}
+
+	events, head, err := h.did.DIDEvents(didStr, c.Query("name"), offset, limit)
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrIndexerDisabled):
+			c.JSON(ErrIndexerDisabled.Code, ErrIndexerDisabled)
+		case errors.Is(err, did.ErrInvalidDID):
+			c.JSON(ErrParamsInvalid.Code, gin.H{"message": ErrParamsInvalid.Message, "error": err.Error()})
+		default:
+			c.JSON(ErrEventListFailed.Code, gin.H{"message": ErrEventListFailed.Message, "error": err.Error()})
+		}
+		return
+	}
+
+	res := DIDEventsResponse{DID: didStr, IndexedBlock: head, Events: []EventResponse{}}
+	for _, e := range events {
+		res.Events = append(res.Events, EventResponse{
+			Name:        e.Name,
+			Contract:    e.Contract,
+			DID:         e.Did,
+			Mfile:       e.Mfile,
+			Args:        json.RawMessage(e.Args),
+			BlockNumber: e.BlockNumber,
+			BlockHash:   e.BlockHash,
+			TxHash:      e.TxHash,
+			LogIndex:    e.LogIndex,
+		})
+	}
+
+	c.JSON(200, res)
+}
+
+// @ Summary GetJob
+//	@Description	Get the status of a queued DID registration
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	query		string	true	"job id"
+//	@Success		200	{object}	JobResponse
+//	@Router			/did/job [get]
+//	@Failure		562	{object}	Error
+func (h *handle) getJob(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	job, err := h.did.GetJob(id)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrJobNotFound.Code, ErrJobNotFound)
+		return
+	}
+
+	c.JSON(200, JobResponse{
+		ID:      job.JobID,
+		Kind:    job.Kind,
+		Address: job.Address,
+		DID:     job.DID,
+		Number:  job.Number,
+		Status:  job.Status,
+		TxHash:  job.TxHash,
+		Error:   job.Error,
+	})
 }
 
 // @ Summary GetDIDInfo
@@ -165,7 +367,7 @@ func (h *handle) getDIDInfo(c *gin.Context) {
 		return
 	}
 
-	did, number, err := h.did.GetDIDInfo(address)
+	did, number, err := h.did.GetDIDInfo(c.Request.Context(), address)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDGetInfo.Code, gin.H{"message": ErrDIDGetInfo.Message, "error": err.Error()})
@@ -193,7 +395,7 @@ func (h *handle) getDeleteSigMsg(c *gin.Context) {
 		return
 	}
 
-	msg, err := h.did.GetDeleteSignatureMassage(did)
+	msg, err := h.did.GetDeleteSignatureMassage(c.Request.Context(), did)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDGetSignatureMessage.Code, ErrDIDGetSignatureMessage)
@@ -219,7 +421,7 @@ func (h *handle) getDIDExist(c *gin.Context) {
 		return
 	}
 
-	number, err := h.did.GetDIDExist(address)
+	number, err := h.did.GetDIDExist(c.Request.Context(), address)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDGetInfo.Code, gin.H{"message": ErrDIDGetInfo.Message, "error": err.Error()})
@@ -241,8 +443,10 @@ func (h *handle) getDIDExist(c *gin.Context) {
 //	@Param			did	body		string	true	"did"
 //	@Success		200	{object}	DeleteDIDResponse
 //	@Router			/did/delete [post]
-//	@Failure		502	{object}	Error
-//	@Failure		504	{object}	Error
+//	@Failure		557	{object}	Error
+//	@Failure		563	{object}	Error
+//	@Failure		564	{object}	Error
+//	@Failure		565	{object}	Error
 func (h *handle) deleteDID(c *gin.Context) {
 	body := make(map[string]interface{})
 	c.BindJSON(&body)
@@ -252,42 +456,268 @@ func (h *handle) deleteDID(c *gin.Context) {
 		return
 	}
 
-	did, ok := body["did"].(string)
-	if !ok {
-		c.JSON(ErrDIDNull.Code, ErrChainNull)
+	didStr, ok := body["did"].(string)
+	if !ok || didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	sigByte, err := hexutil.Decode(sig)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrSignature.Code, ErrSignature)
 		return
 	}
 
-	fmt.Println(did, sig)
+	err = h.did.DeactivateDID(c.Request.Context(), didStr, sigByte)
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrDIDNotFound):
+			c.JSON(ErrDIDNotFound.Code, ErrDIDNotFound)
+		case errors.Is(err, did.ErrDIDDeactivated):
+			c.JSON(ErrDIDDeactivated.Code, ErrDIDDeactivated)
+		case errors.Is(err, did.ErrSignatureMismatch):
+			c.JSON(ErrSignature.Code, ErrSignature)
+		default:
+			c.JSON(ErrDIDDeleteFailed.Code, gin.H{"message": ErrDIDDeleteFailed.Message, "error": err.Error()})
+		}
+		return
+	}
 
 	c.JSON(200, DeleteDIDResponse{
-		DID:    did,
-		Status: "deactiaved",
+		DID:    didStr,
+		Status: did.DIDStatusDeactivated,
 	})
 }
 
+// @ Summary GetAddVerifySigMsg
+//	@Description	Get the message the DID controller signs to add a verification method
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			did		query		string	true	"user did"
+//	@Param			type	query		string	true	"address, pubkey or ton"
+//	@Param			key		query		string	true	"address or hex public key"
+//	@Success		200		{object}	GetSigMsgResponse
+//	@Router			/did/addverifysigmsg [get]
+//	@Failure		566		{object}	Error
+func (h *handle) getAddVerifySigMsg(c *gin.Context) {
+	didStr := c.Query("did")
+	if didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	msg, err := h.did.GetAddVerifySignatureMassage(c.Request.Context(), didStr, c.Query("type"), c.Query("key"))
+	if err != nil {
+		h.logger.Error(err)
+		if errors.Is(err, did.ErrInvalidVerificationMethod) {
+			c.JSON(ErrVerifyMethodInvalid.Code, gin.H{"message": ErrVerifyMethodInvalid.Message, "error": err.Error()})
+			return
+		}
+		c.JSON(ErrDIDGetSignatureMessage.Code, ErrDIDGetSignatureMessage)
+		return
+	}
+
+	c.JSON(200, GetSigMsgResponse{Msg: msg})
+}
+
+// @ Summary GetChangeVerifySigMsg
+//	@Description	Get the message the DID controller signs to rotate or revoke a verification method
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			did		query		string	true	"user did"
+//	@Param			index	query		int		true	"verification method index"
+//	@Param			action	query		string	true	"rotate or revoke"
+//	@Param			type	query		string	false	"address, pubkey or ton, for rotate"
+//	@Param			key		query		string	false	"address or hex public key, for rotate"
+//	@Success		200		{object}	GetSigMsgResponse
+//	@Router			/did/changeverifysigmsg [get]
+//	@Failure		566		{object}	Error
+//	@Failure		567		{object}	Error
+func (h *handle) getChangeVerifySigMsg(c *gin.Context) {
+	didStr := c.Query("did")
+	if didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	index, err := strconv.ParseUint(c.Query("index"), 10, 64)
+	if err != nil {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	msg, err := h.did.GetChangeVerifySignatureMassage(c.Request.Context(), didStr, index, c.Query("action"), c.Query("type"), c.Query("key"))
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrInvalidVerificationMethod):
+			c.JSON(ErrVerifyMethodInvalid.Code, gin.H{"message": ErrVerifyMethodInvalid.Message, "error": err.Error()})
+		case errors.Is(err, did.ErrInvalidVerifyAction):
+			c.JSON(ErrVerifyActionInvalid.Code, ErrVerifyActionInvalid)
+		default:
+			c.JSON(ErrDIDGetSignatureMessage.Code, ErrDIDGetSignatureMessage)
+		}
+		return
+	}
+
+	c.JSON(200, GetSigMsgResponse{Msg: msg})
+}
+
+// @ Summary AddVerifyInfo
+//	@Description	Add a verification method to a DID, signed by the DID controller
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			did		body		string	true	"user did"
+//	@Param			type	body		string	true	"address, pubkey or ton"
+//	@Param			key		body		string	true	"address or hex public key"
+//	@Param			sig		body		string	true	"signature over the addverifysigmsg message"
+//	@Success		200		{object}	AddVerifyInfoResponse
+//	@Router			/did/addverifyinfo [post]
+//	@Failure		557		{object}	Error
+//	@Failure		563		{object}	Error
+//	@Failure		564		{object}	Error
+//	@Failure		566		{object}	Error
+//	@Failure		570		{object}	Error
 func (h *handle) addVerifyInfo(c *gin.Context) {
-	c.JSON(200, AddVerifyInfoResponse{})
+	body := make(map[string]interface{})
+	c.BindJSON(&body)
+	sig, ok := body["sig"].(string)
+	if !ok {
+		c.JSON(ErrSignatureNull.Code, ErrSignatureNull)
+		return
+	}
+
+	didStr, ok := body["did"].(string)
+	if !ok || didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	mtype, _ := body["type"].(string)
+	key, _ := body["key"].(string)
+
+	sigByte, err := hexutil.Decode(sig)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrSignature.Code, ErrSignature)
+		return
+	}
+
+	index, err := h.did.AddVerifyInfo(c.Request.Context(), didStr, mtype, key, sigByte)
+	if err != nil {
+		h.logger.Error(err)
+		h.verifyInfoError(c, err)
+		return
+	}
+
+	c.JSON(200, AddVerifyInfoResponse{
+		DID:   didStr,
+		Index: index,
+	})
 }
 
+// @ Summary ChangeVerifyInfo
+//	@Description	Rotate or revoke a verification method of a DID, signed by the DID controller
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			did		body		string	true	"user did"
+//	@Param			index	body		int		true	"verification method index"
+//	@Param			action	body		string	true	"rotate or revoke"
+//	@Param			type	body		string	false	"address, pubkey or ton, for rotate"
+//	@Param			key		body		string	false	"address or hex public key, for rotate"
+//	@Param			sig		body		string	true	"signature over the changeverifysigmsg message"
+//	@Success		200		{object}	ChangeVerifyInfoResponse
+//	@Router			/did/changeverifyinfo [post]
+//	@Failure		557		{object}	Error
+//	@Failure		563		{object}	Error
+//	@Failure		564		{object}	Error
+//	@Failure		566		{object}	Error
+//	@Failure		567		{object}	Error
+//	@Failure		568		{object}	Error
+//	@Failure		569		{object}	Error
+//	@Failure		570		{object}	Error
 func (h *handle) changeVerifyInfo(c *gin.Context) {
-	c.JSON(200, ChangeVerifyInfoResponse{})
-}
+	body := make(map[string]interface{})
+	c.BindJSON(&body)
+	sig, ok := body["sig"].(string)
+	if !ok {
+		c.JSON(ErrSignatureNull.Code, ErrSignatureNull)
+		return
+	}
 
-func (h *handle) getDIDNumber(c *gin.Context) {
-	address := c.Query("address")
-	if address == "" {
-		c.JSON(ErrAddressNull.Code, ErrAddressNull)
+	didStr, ok := body["did"].(string)
+	if !ok || didStr == "" {
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
 		return
 	}
-	num, err := h.did.GetDIDNumber()
+
+	// json numbers are decoded as float64
+	indexF, ok := body["index"].(float64)
+	if !ok || indexF < 0 || indexF != float64(uint64(indexF)) {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+	index := uint64(indexF)
+
+	action, _ := body["action"].(string)
+	mtype, _ := body["type"].(string)
+	key, _ := body["key"].(string)
+
+	sigByte, err := hexutil.Decode(sig)
 	if err != nil {
 		h.logger.Error(err)
-		c.JSON(ErrDIDGetInfo.Code, gin.H{"message": ErrDIDGetInfo.Message, "error": err.Error()})
+		c.JSON(ErrSignature.Code, ErrSignature)
+		return
+	}
+
+	err = h.did.ChangeVerifyInfo(c.Request.Context(), didStr, index, action, mtype, key, sigByte)
+	if err != nil {
+		h.logger.Error(err)
+		h.verifyInfoError(c, err)
 		return
 	}
 
-	err = h.did.AddDIDNumber(address, num)
+	c.JSON(200, ChangeVerifyInfoResponse{
+		DID:    didStr,
+		Index:  index,
+		Action: action,
+	})
+}
+
+func (h *handle) verifyInfoError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, did.ErrDIDNotFound):
+		c.JSON(ErrDIDNotFound.Code, ErrDIDNotFound)
+	case errors.Is(err, did.ErrDIDDeactivated):
+		c.JSON(ErrDIDDeactivated.Code, ErrDIDDeactivated)
+	case errors.Is(err, did.ErrSignatureMismatch):
+		c.JSON(ErrSignature.Code, ErrSignature)
+	case errors.Is(err, did.ErrInvalidVerificationMethod):
+		c.JSON(ErrVerifyMethodInvalid.Code, gin.H{"message": ErrVerifyMethodInvalid.Message, "error": err.Error()})
+	case errors.Is(err, did.ErrInvalidVerifyAction):
+		c.JSON(ErrVerifyActionInvalid.Code, ErrVerifyActionInvalid)
+	case errors.Is(err, did.ErrVerificationNotFound):
+		c.JSON(ErrVerifyMethodNotFound.Code, ErrVerifyMethodNotFound)
+	case errors.Is(err, did.ErrMasterVerification):
+		c.JSON(ErrVerifyMasterRevoke.Code, ErrVerifyMasterRevoke)
+	default:
+		c.JSON(ErrVerifyInfoFailed.Code, gin.H{"message": ErrVerifyInfoFailed.Message, "error": err.Error()})
+	}
+}
+
+func (h *handle) getDIDNumber(c *gin.Context) {
+	address := c.Query("address")
+	if address == "" {
+		c.JSON(ErrAddressNull.Code, ErrAddressNull)
+		return
+	}
+	num, assigned, err := h.did.GetDIDNumber(c.Request.Context(), address)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDIDGetInfo.Code, gin.H{"message": ErrDIDGetInfo.Message, "error": err.Error()})
@@ -295,6 +725,7 @@ func (h *handle) getDIDNumber(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"number": num,
+		"number":   num,
+		"assigned": assigned,
 	})
 }
@@ -0,0 +1,173 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/did-server/internal/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// sniffLen is how much of an object is read to detect its content type
+var sniffLen int64 = 512
+
+var errRangeNotSatisfiable = fmt.Errorf("range not satisfiable")
+
+// serveObject streams object of bucket, or the object with mid info.Mid if
+// bucket is empty, honouring Range and If-Range. Once the first bytes are
+// sent a failure can no longer change the status, so the handler returns
+// early and the server closes the connection short of Content-Length.
+func (h *handle) serveObject(c *gin.Context, bucket, object string, info gateway.ObjectInfo) {
+	etag := ""
+	if info.Mid != "" {
+		etag = `"` + info.Mid + `"`
+	}
+
+	start, length := int64(0), info.Size
+	partial := false
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" && ifRangeMatch(c.GetHeader("If-Range"), etag, info.CreateTime) {
+		var err error
+		start, length, partial, err = parseRange(rangeHeader, info.Size)
+		if err != nil {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"message": ErrDownloadFailed.Message, "error": err.Error()})
+			return
+		}
+	}
+
+	contentType, err := h.contentType(c, bucket, object, info)
+	if err != nil {
+		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
+		c.JSON(ErrDownloadFailed.Code, gin.H{"message": ErrDownloadFailed.Message, "error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(info.Name)}))
+	c.Header("Accept-Ranges", "bytes")
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	if !info.CreateTime.IsZero() {
+		c.Header("Last-Modified", info.CreateTime.UTC().Format(http.TimeFormat))
+	}
+
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size))
+	}
+	c.Status(status)
+
+	written, err := h.gateway.GetObject(c.Request.Context(), bucket, object, start, length, c.Writer)
+	if err != nil {
+		h.logger.Errorf("download %s stopped after %d of %d bytes: %s", object, written, length, err)
+		if !c.Writer.Written() {
+			c.Header("Content-Length", "")
+			c.Header("Content-Disposition", "")
+			if storageUnavailable(c, err) {
+				return
+			}
+			c.JSON(ErrDownloadFailed.Code, gin.H{"message": ErrDownloadFailed.Message, "error": err.Error()})
+			return
+		}
+		c.Abort()
+	}
+}
+
+// contentType detects the type from the name, else from the first bytes
+func (h *handle) contentType(c *gin.Context, bucket, object string, info gateway.ObjectInfo) (string, error) {
+	if ct := mime.TypeByExtension(filepath.Ext(info.Name)); ct != "" {
+		return ct, nil
+	}
+	if info.Size == 0 {
+		return "application/octet-stream", nil
+	}
+
+	n := sniffLen
+	if info.Size < n {
+		n = info.Size
+	}
+
+	var head bytes.Buffer
+	_, err := h.gateway.GetObject(c.Request.Context(), bucket, object, 0, n, &head)
+	if err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(head.Bytes()), nil
+}
+
+// ifRangeMatch reports whether a Range applies given the If-Range validator,
+// an entity tag compared strongly or an exact Last-Modified date
+func ifRangeMatch(ifRange, etag string, modified time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return etag != "" && ifRange == etag
+	}
+
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modified.IsZero() && t.Equal(modified.UTC().Truncate(time.Second))
+}
+
+// parseRange parses a single byte range against size. Malformed headers and
+// multiple ranges are ignored and the whole object is served.
+func parseRange(header string, size int64) (start, length int64, partial bool, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+
+	if first == "" {
+		// suffix range, the last n bytes
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, size, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, size, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if last != "" {
+		end, perr = strconv.ParseInt(last, 10, 64)
+		if perr != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true, nil
+}
@@ -0,0 +1,48 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header        string
+		start, length int64
+		partial       bool
+		unsatisfiable bool
+	}{
+		{"bytes=0-99", 0, 100, true, false},
+		{"bytes=100-", 100, 900, true, false},
+		{"bytes=-100", 900, 100, true, false},
+		{"bytes=900-2000", 900, 100, true, false},
+		{"bytes=-2000", 0, 1000, true, false},
+		{"bytes=1000-", 0, 0, false, true},
+		{"bytes=0-1,5-9", 0, 1000, false, false},
+		{"bytes=9-1", 0, 1000, false, false},
+		{"items=0-1", 0, 1000, false, false},
+	}
+
+	for _, test := range tests {
+		start, length, partial, err := parseRange(test.header, 1000)
+		if (err != nil) != test.unsatisfiable {
+			t.Fatalf("%s: %v", test.header, err)
+		}
+		if err == nil && (start != test.start || length != test.length || partial != test.partial) {
+			t.Fatalf("%s: got %d+%d %t", test.header, start, length, partial)
+		}
+	}
+}
+
+func TestIfRangeMatch(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	etag := `"bafkreiabc"`
+
+	if !ifRangeMatch(etag, etag, modified) || ifRangeMatch(`"other"`, etag, modified) {
+		t.Fatal("entity tag not compared")
+	}
+	if !ifRangeMatch(modified.Format(http.TimeFormat), etag, modified) || ifRangeMatch(modified.Add(time.Hour).Format(http.TimeFormat), etag, modified) {
+		t.Fatal("date not compared")
+	}
+}
@@ -13,6 +13,32 @@ var (
 	ErrUploadFailed           = Error{Code: 559, Message: "Mfile Upload failed"}
 	ErrDownloadFailed         = Error{Code: 560, Message: "Mfile download failed"}
 	ErrParamsInvalid          = Error{Code: 561, Message: "Params invalid"}
+	ErrJobNotFound            = Error{Code: 562, Message: "Job not found"}
+	ErrDIDNotFound            = Error{Code: 563, Message: "DID not found"}
+	ErrDIDDeactivated         = Error{Code: 564, Message: "DID already deactivated"}
+	ErrDIDDeleteFailed        = Error{Code: 565, Message: "DID deactivate failed"}
+	ErrVerifyMethodInvalid    = Error{Code: 566, Message: "Verification method invalid"}
+	ErrVerifyActionInvalid    = Error{Code: 567, Message: "Action must be rotate or revoke"}
+	ErrVerifyMethodNotFound   = Error{Code: 568, Message: "Verification method not found"}
+	ErrVerifyMasterRevoke     = Error{Code: 569, Message: "Master verification method can not be revoked"}
+	ErrVerifyInfoFailed       = Error{Code: 570, Message: "Verification method update failed"}
+	ErrMfileNotFound          = Error{Code: 571, Message: "Mfile DID not found"}
+	ErrMfileRegistering       = Error{Code: 572, Message: "Mfile DID registration in progress"}
+	ErrMfileRegistered        = Error{Code: 573, Message: "Mfile DID already registered"}
+	ErrUploadTooLarge         = Error{Code: 574, Message: "Upload exceeds the maximum size"}
+	ErrUploadHashMismatch     = Error{Code: 575, Message: "Upload does not match its hash"}
+	ErrDownloadDenied         = Error{Code: 576, Message: "Download denied"}
+	ErrFileListFailed         = Error{Code: 577, Message: "File list failed"}
+	ErrFileDeleteFailed       = Error{Code: 578, Message: "File delete failed"}
+	ErrFileNotFound           = Error{Code: 579, Message: "File not found"}
+	ErrEventListFailed        = Error{Code: 580, Message: "Event list failed"}
+	ErrChallengeFailed        = Error{Code: 581, Message: "Challenge create failed"}
+	ErrAdminBalance           = Error{Code: 582, Message: "Admin balance read failed"}
+	ErrNotController          = Error{Code: 583, Message: "Address is not the DID controller"}
+	ErrMfileTaken             = Error{Code: 584, Message: "Mfile DID created by another uploader"}
+	ErrStorageUnavailable     = Error{Code: 503, Message: "Storage node unavailable"}
+	ErrAirdropPaused          = Error{Code: 503, Message: "airdrop paused: insufficient funds"}
+	ErrIndexerDisabled        = Error{Code: 503, Message: "Event indexer disabled"}
 )
 
 type Error struct {
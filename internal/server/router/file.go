@@ -1,72 +1,325 @@
 package router
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/did-server/internal/did"
+	"github.com/did-server/internal/gateway"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	defaultFileListLimit = 100
+	maxFileListLimit     = 1000
+)
+
 func loadFileMoudles(r *gin.RouterGroup, h *handle) {
+	r.Use(h.requireStorage)
 	r.POST("/upload", h.fileUpload)
 	r.GET("/download", h.fileDownload)
 	r.GET("/list", h.fileList)
+	r.GET("/challenge", h.fileChallenge)
+	r.DELETE("", h.fileDelete)
 }
 
 // @Summary file upload
-// @Description upload file
+// @Description upload file to the bucket of address, signed by address over an upload challenge of the object name
 // @Tags file
-// @Accept json
+// @Accept multipart/form-data,application/octet-stream
 // @Produce json
-// @Param data body string true "data"
-// @Param address body string true "address"
-// @Success 200
+// @Param file formData file true "file, or the raw body as application/octet-stream"
+// @Param address formData string true "address"
+// @Param name formData string false "object name, the file name by default"
+// @Param X-Challenge-Nonce header string true "nonce of the upload challenge"
+// @Param X-Challenge-Signature header string true "signature over the challenge"
+// @Success 200 {object} FileInfoResponse
+// @Failure 413 {object} Error
+// @Failure 557 {object} Error
+// @Failure 578 {object} Error
 // @Router /file/upload [post]
 func (h *handle) fileUpload(c *gin.Context) {
-	body := make(map[string]interface{})
-	c.BindJSON(&body)
-	data, ok := body["data"].(string)
+	upload, err := h.openUpload(c)
+	if err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	bucket, ok := userBucket(upload.value("address"))
 	if !ok {
-		err := fmt.Errorf("invalid data")
-		h.logger.Error(err)
-		c.JSON(http.StatusOK, ErrParamsInvalid)
+		c.JSON(ErrAddressNull.Code, ErrAddressNull)
 		return
 	}
 
-	address := body["address"].(string)
-	if address == "" {
-		err := fmt.Errorf("invalid address")
-		h.logger.Error(err)
-		c.JSON(http.StatusOK, ErrParamsInvalid)
+	object := upload.value("name")
+	if object == "" {
+		object = upload.name
+	}
+	if object == "" {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	if !h.checkFileChallenge(c, did.FileUpload, upload.value("address"), object) {
 		return
 	}
 
-	err := h.gateway.MakeBucketWithLocation(c.Request.Context(), address)
+	if !h.gateway.CheckBucket(c.Request.Context(), bucket) {
+		err := h.gateway.MakeBucketWithLocation(c.Request.Context(), bucket)
+		if err != nil {
+			h.uploadError(c, err)
+			return
+		}
+	}
+
+	info, err := h.gateway.PutObject(c.Request.Context(), bucket, object, upload.body)
 	if err != nil {
-		h.logger.Error(err)
-		c.JSON(http.StatusOK, ErrParamsInvalid)
+		h.uploadError(c, err)
 		return
 	}
 
-	h.gateway.PutObject(c.Request.Context(), address, data)
+	c.JSON(http.StatusOK, newFileInfoResponse(info))
 }
 
 // @Summary file download
-// @Description download file
+// @Description download a file of address by name or cid, signed by address over a download challenge of the name or cid
 // @Tags file
-// @Accept json
-// @Produce json
-// @Param address body string true "address"
-// @Success 200
+// @Produce octet-stream
+// @Param address query string true "address"
+// @Param name query string false "file name"
+// @Param cid query string false "file cid, if name is empty. Only files of address are found, mfiles are downloaded from /mfile/download"
+// @Param Range header string false "single byte range, e.g. bytes=0-1023"
+// @Param X-Challenge-Nonce header string true "nonce of the download challenge"
+// @Param X-Challenge-Signature header string true "signature over the challenge"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 557 {object} Error
+// @Failure 578 {object} Error
+// @Failure 579 {object} Error
 // @Router /file/download [get]
-func (h *handle) fileDownload(c *gin.Context) {}
+func (h *handle) fileDownload(c *gin.Context) {
+	bucket, ok := userBucket(c.Query("address"))
+	if !ok {
+		c.JSON(ErrAddressNull.Code, ErrAddressNull)
+		return
+	}
+
+	name := c.Query("name")
+	cid := c.Query("cid")
+
+	// the challenge is signed over the name, or the cid without one
+	signed := name
+	if signed == "" {
+		signed = cid
+	}
+	if signed == "" {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+	if !h.checkFileChallenge(c, did.FileDownload, c.Query("address"), signed) {
+		return
+	}
+
+	var info gateway.ObjectInfo
+	var err error
+	if name != "" {
+		info, err = h.gateway.GetObjectInfo(c.Request.Context(), bucket, name)
+	} else {
+		// a cid resolves to an object of any bucket, mfiles included, so it
+		// is read again in the bucket of address
+		info, err = h.gateway.GetObjectInfoByMid(c.Request.Context(), cid)
+		if err == nil {
+			name = info.Name
+			info, err = h.gateway.GetObjectInfo(c.Request.Context(), bucket, name)
+		}
+		if err == nil && info.Mid != cid {
+			err = gateway.ErrObjectNotFound
+		}
+	}
+	if err != nil {
+		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
+		c.JSON(ErrFileNotFound.Code, ErrFileNotFound)
+		return
+	}
+
+	h.serveObject(c, bucket, name, info)
+}
 
 // @Summary file list
-// @Description list file
+// @Description list the files of address, a page at a time, signed by address over a list challenge
 // @Tags file
-// @Accept json
 // @Produce json
-// @Param address body string true "address"
-// @Success 200
+// @Param address query string true "address"
+// @Param marker query string false "list files after this name, the next marker of the previous page"
+// @Param limit query int false "page size, at most 1000"
+// @Param X-Challenge-Nonce header string true "nonce of the list challenge"
+// @Param X-Challenge-Signature header string true "signature over the challenge"
+// @Success 200 {object} FileListResponse
+// @Failure 557 {object} Error
+// @Failure 577 {object} Error
+// @Failure 578 {object} Error
 // @Router /file/list [get]
-func (h *handle) fileList(c *gin.Context) {}
+func (h *handle) fileList(c *gin.Context) {
+	bucket, ok := userBucket(c.Query("address"))
+	if !ok {
+		c.JSON(ErrAddressNull.Code, ErrAddressNull)
+		return
+	}
+
+	limit := defaultFileListLimit
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+			return
+		}
+		limit = min(n, maxFileListLimit)
+	}
+
+	if !h.checkFileChallenge(c, did.FileList, c.Query("address"), "") {
+		return
+	}
+
+	res := FileListResponse{Files: []FileInfoResponse{}}
+
+	// a user without uploads has no bucket yet
+	if !h.gateway.CheckBucket(c.Request.Context(), bucket) {
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	list, err := h.gateway.ListObjects(c.Request.Context(), bucket, c.Query("marker"), limit)
+	if err != nil {
+		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
+		c.JSON(ErrFileListFailed.Code, gin.H{"message": ErrFileListFailed.Message, "error": err.Error()})
+		return
+	}
+
+	for _, info := range list.Objects {
+		res.Files = append(res.Files, newFileInfoResponse(info))
+	}
+	if list.IsTruncated {
+		res.NextMarker = list.NextMarker
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary file challenge
+// @Description get a single-use challenge address signs to upload, download, list or delete its files
+// @Tags file
+// @Produce json
+// @Param action query string true "upload, download, list or delete"
+// @Param address query string true "address"
+// @Param name query string false "file name, the cid for a download by cid. Not needed to list"
+// @Success 200 {object} ChallengeResponse
+// @Failure 581 {object} Error
+// @Router /file/challenge [get]
+func (h *handle) fileChallenge(c *gin.Context) {
+	action := c.Query("action")
+	address := c.Query("address")
+	name := c.Query("name")
+	if !common.IsHexAddress(address) || (name == "" && action != did.FileList) {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	challenge, err := h.did.NewFileChallenge(action, address, name)
+	if errors.Is(err, did.ErrFileAction) {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrChallengeFailed.Code, gin.H{"message": ErrChallengeFailed.Message, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newChallengeResponse(challenge))
+}
+
+// @Summary file delete
+// @Description delete a file of address, signed by address over a delete challenge
+// @Tags file
+// @Produce json
+// @Param address query string true "address"
+// @Param name query string true "file name"
+// @Param X-Challenge-Nonce header string true "nonce of the delete challenge"
+// @Param X-Challenge-Signature header string true "signature over the challenge"
+// @Success 200 {object} FileInfoResponse
+// @Failure 557 {object} Error
+// @Failure 578 {object} Error
+// @Failure 579 {object} Error
+// @Router /file [delete]
+func (h *handle) fileDelete(c *gin.Context) {
+	bucket, ok := userBucket(c.Query("address"))
+	if !ok {
+		c.JSON(ErrAddressNull.Code, ErrAddressNull)
+		return
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	if !h.checkFileChallenge(c, did.FileDelete, c.Query("address"), name) {
+		return
+	}
+
+	info, err := h.gateway.GetObjectInfo(c.Request.Context(), bucket, name)
+	if err != nil {
+		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
+		c.JSON(ErrFileNotFound.Code, ErrFileNotFound)
+		return
+	}
+
+	err = h.gateway.DeleteObject(c.Request.Context(), bucket, name)
+	if err != nil {
+		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
+		c.JSON(ErrFileDeleteFailed.Code, gin.H{"message": ErrFileDeleteFailed.Message, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newFileInfoResponse(info))
+}
+
+// checkFileChallenge checks the challenge headers of c are signed by address
+// for action on its file name, and answers c if they are not
+func (h *handle) checkFileChallenge(c *gin.Context, action, address, name string) bool {
+	nonce, sig, ok := challengeHeaders(c)
+	if !ok {
+		c.JSON(ErrSignatureNull.Code, ErrSignatureNull)
+		return false
+	}
+	err := h.did.CheckFile(action, address, name, nonce, sig)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrSignature.Code, gin.H{"message": ErrSignature.Message, "error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// userBucket is the bucket holding the files of address
+func userBucket(address string) (string, bool) {
+	if !common.IsHexAddress(address) {
+		return "", false
+	}
+	return strings.ToLower(common.HexToAddress(address).Hex()), true
+}
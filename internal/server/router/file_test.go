@@ -0,0 +1,308 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/did"
+	"github.com/did-server/internal/gateway"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+// newFileTestRouter serves the file routes on local storage, the DID part
+// only keeps challenges so it needs no chain
+func newFileTestRouter(t *testing.T) (*gin.Engine, gateway.Storage) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+	memoDID, err := did.NewMemoDIDWithController(cfg, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := gateway.NewLocal(t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handle{cfg: cfg, logger: logger, did: memoDID, gateway: storage}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	loadFileMoudles(r.Group("/file"), h)
+	return r, storage
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// signFileRequest sets the challenge headers of req, signed by sk for action
+// on the file name of address
+func signFileRequest(t *testing.T, r *gin.Engine, req *http.Request, sk *ecdsa.PrivateKey, action, address, name string) {
+	query := url.Values{"action": {action}, "address": {address}, "name": {name}}.Encode()
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/file/challenge?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s challenge: %d %s", action, w.Code, w.Body)
+	}
+	var challenge ChallengeResponse
+	err := json.Unmarshal(w.Body.Bytes(), &challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(challenge.Msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(HeaderChallengeNonce, challenge.Nonce)
+	req.Header.Set(HeaderChallengeSignature, hexutil.Encode(sig))
+}
+
+func newFileKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, crypto.PubkeyToAddress(sk.PublicKey).Hex()
+}
+
+func uploadRequest(address, name, content string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("address", address)
+	fw, _ := mw.CreateFormFile("file", name)
+	fw.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func uploadFile(t *testing.T, r *gin.Engine, sk *ecdsa.PrivateKey, name, content string) FileInfoResponse {
+	address := crypto.PubkeyToAddress(sk.PublicKey).Hex()
+	req := uploadRequest(address, name, content)
+	signFileRequest(t, r, req, sk, did.FileUpload, address, name)
+	w := serve(r, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload %s: %d %s", name, w.Code, w.Body)
+	}
+
+	var res FileInfoResponse
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func listFiles(t *testing.T, r *gin.Engine, sk *ecdsa.PrivateKey, query url.Values) FileListResponse {
+	address := crypto.PubkeyToAddress(sk.PublicKey).Hex()
+	query.Set("address", address)
+	req := httptest.NewRequest(http.MethodGet, "/file/list?"+query.Encode(), nil)
+	signFileRequest(t, r, req, sk, did.FileList, address, "")
+	w := serve(r, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list %s: %d %s", query, w.Code, w.Body)
+	}
+
+	var res FileListResponse
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// download signs the download of the name or cid of query by sk for the
+// address of query
+func download(t *testing.T, r *gin.Engine, sk *ecdsa.PrivateKey, query url.Values) *httptest.ResponseRecorder {
+	name := query.Get("name")
+	if name == "" {
+		name = query.Get("cid")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/file/download?"+query.Encode(), nil)
+	signFileRequest(t, r, req, sk, did.FileDownload, query.Get("address"), name)
+	return serve(r, req)
+}
+
+func deleteFile(t *testing.T, r *gin.Engine, sk *ecdsa.PrivateKey, address, name string) *httptest.ResponseRecorder {
+	query := url.Values{"address": {address}, "name": {name}}.Encode()
+	req := httptest.NewRequest(http.MethodDelete, "/file?"+query, nil)
+	signFileRequest(t, r, req, sk, did.FileDelete, address, name)
+	return serve(r, req)
+}
+
+func TestFileUploadListDownload(t *testing.T) {
+	r, _ := newFileTestRouter(t)
+	sk, address := newFileKey(t)
+
+	info := uploadFile(t, r, sk, "a.txt", "hello world")
+	if info.Name != "a.txt" || info.Size != 11 || info.CID == "" || info.Time.IsZero() {
+		t.Fatalf("upload response %+v", info)
+	}
+	uploadFile(t, r, sk, "b.txt", "b")
+	uploadFile(t, r, sk, "c.txt", "c")
+
+	page := listFiles(t, r, sk, url.Values{"limit": {"2"}})
+	if len(page.Files) != 2 || page.Files[0].Name != "a.txt" || page.NextMarker == "" {
+		t.Fatalf("first page %+v", page)
+	}
+	page = listFiles(t, r, sk, url.Values{"limit": {"2"}, "marker": {page.NextMarker}})
+	if len(page.Files) != 1 || page.Files[0].Name != "c.txt" || page.NextMarker != "" {
+		t.Fatalf("last page %+v", page)
+	}
+	otherSK, _ := newFileKey(t)
+	if page := listFiles(t, r, otherSK, url.Values{}); len(page.Files) != 0 {
+		t.Fatalf("files of a user without uploads %+v", page)
+	}
+
+	w := download(t, r, sk, url.Values{"address": {address}, "name": {"a.txt"}})
+	if w.Code != http.StatusOK || w.Body.String() != "hello world" {
+		t.Fatalf("download by name: %d %s", w.Code, w.Body)
+	}
+
+	w = download(t, r, sk, url.Values{"address": {address}, "cid": {info.CID}})
+	if w.Code != http.StatusOK || w.Body.String() != "hello world" || w.Header().Get("ETag") != `"`+info.CID+`"` {
+		t.Fatalf("download by cid: %d %s", w.Code, w.Body)
+	}
+
+	w = download(t, r, sk, url.Values{"address": {address}, "name": {"missing.txt"}})
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("download of a missing file: %d", w.Code)
+	}
+}
+
+func TestFileSigned(t *testing.T) {
+	r, _ := newFileTestRouter(t)
+	sk, address := newFileKey(t)
+	otherSK, _ := newFileKey(t)
+	uploadFile(t, r, sk, "a.txt", "hello world")
+
+	w := serve(r, uploadRequest(address, "a.txt", "overwritten"))
+	if w.Code != ErrSignatureNull.Code {
+		t.Fatalf("upload without a challenge: %d %s", w.Code, w.Body)
+	}
+	req := uploadRequest(address, "a.txt", "overwritten")
+	signFileRequest(t, r, req, otherSK, did.FileUpload, address, "a.txt")
+	if w := serve(r, req); w.Code != ErrSignature.Code {
+		t.Fatalf("upload signed by another key: %d %s", w.Code, w.Body)
+	}
+	req = uploadRequest(address, "a.txt", "overwritten")
+	signFileRequest(t, r, req, sk, did.FileUpload, address, "b.txt")
+	if w := serve(r, req); w.Code != ErrSignature.Code {
+		t.Fatalf("upload signed for another name: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/file/list?address="+address, nil))
+	if w.Code != ErrSignatureNull.Code {
+		t.Fatalf("list without a challenge: %d %s", w.Code, w.Body)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/file/list?address="+address, nil)
+	signFileRequest(t, r, req, otherSK, did.FileList, address, "")
+	if w := serve(r, req); w.Code != ErrSignature.Code {
+		t.Fatalf("list signed by another key: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/file/download?address="+address+"&name=a.txt", nil))
+	if w.Code != ErrSignatureNull.Code {
+		t.Fatalf("download without a challenge: %d %s", w.Code, w.Body)
+	}
+	w = download(t, r, otherSK, url.Values{"address": {address}, "name": {"a.txt"}})
+	if w.Code != ErrSignature.Code {
+		t.Fatalf("download signed by another key: %d %s", w.Code, w.Body)
+	}
+
+	w = download(t, r, sk, url.Values{"address": {address}, "name": {"a.txt"}})
+	if w.Code != http.StatusOK || w.Body.String() != "hello world" {
+		t.Fatalf("file changed by unsigned uploads: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/file/challenge?action=rename&name=a.txt&address="+address, nil))
+	if w.Code != ErrParamsInvalid.Code {
+		t.Fatalf("challenge of an unknown action: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestFileCrossBucket(t *testing.T) {
+	r, storage := newFileTestRouter(t)
+	sk, owner := newFileKey(t)
+	otherSK, other := newFileKey(t)
+
+	info := uploadFile(t, r, sk, "a.txt", "hello world")
+	uploadFile(t, r, otherSK, "b.txt", "b")
+
+	w := download(t, r, otherSK, url.Values{"address": {other}, "cid": {info.CID}})
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("file of another address downloaded by cid: %d %s", w.Code, w.Body)
+	}
+	w = download(t, r, otherSK, url.Values{"address": {other}, "name": {"a.txt"}})
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("file of another address downloaded by name: %d %s", w.Code, w.Body)
+	}
+
+	// an uploaded mfile is only downloaded through its access check
+	err := storage.MakeBucketWithLocation(context.Background(), "mdid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfile, err := storage.PutObject(context.Background(), "mdid", strings.ToLower(owner)+"priced", strings.NewReader("priced content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = download(t, r, sk, url.Values{"address": {owner}, "cid": {mfile.Mid}})
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("mfile downloaded by cid: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestFileDelete(t *testing.T) {
+	r, _ := newFileTestRouter(t)
+	sk, address := newFileKey(t)
+	uploadFile(t, r, sk, "a.txt", "hello world")
+
+	w := serve(r, httptest.NewRequest(http.MethodDelete, "/file?address="+address+"&name=a.txt", nil))
+	if w.Code != ErrSignatureNull.Code {
+		t.Fatalf("delete without a challenge: %d %s", w.Code, w.Body)
+	}
+
+	otherSK, _ := newFileKey(t)
+	w = deleteFile(t, r, otherSK, address, "a.txt")
+	if w.Code != ErrSignature.Code {
+		t.Fatalf("delete signed by another key: %d %s", w.Code, w.Body)
+	}
+
+	w = deleteFile(t, r, sk, address, "a.txt")
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+
+	w = download(t, r, sk, url.Values{"address": {address}, "name": {"a.txt"}})
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("deleted file downloaded: %d", w.Code)
+	}
+	w = deleteFile(t, r, sk, address, "a.txt")
+	if w.Code != ErrFileNotFound.Code {
+		t.Fatalf("delete of a deleted file: %d", w.Code)
+	}
+}
@@ -1,48 +1,56 @@
 package router
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"math/big"
-	"mime"
-	"net/http"
+	"io"
+	"strings"
 
-	"github.com/did-server/config"
 	"github.com/did-server/internal/did"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/did-server/internal/gateway"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
 )
 
 func loadMfileDIDMoudles(r *gin.RouterGroup, h *handle) {
-	r.POST("/upload/create", h.uploadCreate)
+	r.POST("/upload/create", h.requireStorage, h.uploadCreate)
 	r.POST("/upload/confirm", h.uploadConfirm)
-	r.GET("/download", h.download)
+	r.GET("/download", h.requireStorage, h.download)
+	r.GET("/download/challenge", h.downloadChallenge)
 }
 
 // @Summary		UploadCreate
 // @Description	create upload request get msg to sign
 // @Tags			mfile
-// @Accept			json
+// @Accept			multipart/form-data,application/octet-stream
 // @Produce		json
-// @Param			data	body		string	true	"data"
-// @Param			address	body		string	true	"address"
-// @Success		200		{string}	string	"ok"
+// @Param			file		formData	file		true	"file, or the raw body as application/octet-stream"
+// @Param			address		formData	string		true	"address"
+// @Param			did			formData	string		true	"controller did"
+// @Param			price		formData	string		true	"price in wei, or a decimal amount with unit wei, gwei or ether, e.g. 1.5gwei"
+// @Param			keywords	formData	string		false	"comma separated keywords"
+// @Param			hash		formData	string		true	"Keccak256 of the file, checked while uploading"
+// @Success		200			{string}	string		"mdid and message to sign"
 // @Router			/mfile/upload/create [post]
+// @Failure		413			{object}	Error
+// @Failure		561			{object}	Error
+// @Failure		572			{object}	Error
+// @Failure		573			{object}	Error
+// @Failure		575			{object}	Error
+// @Failure		583			{object}	Error
+// @Failure		584			{object}	Error
 func (h *handle) uploadCreate(c *gin.Context) {
-	bucket := config.Bucket
-	body := make(map[string]interface{})
-	c.BindJSON(&body)
-	data, ok := body["data"].(string)
-	if !ok {
-		err := fmt.Errorf("invalid data")
-		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+	bucket := h.cfg.Storage.Bucket
+	upload, err := h.openUpload(c)
+	if err != nil {
+		h.uploadError(c, err)
 		return
 	}
 
-	address := body["address"].(string)
+	address := upload.value("address")
 	if address == "" {
 		err := fmt.Errorf("invalid address")
 		h.logger.Error(err)
@@ -50,64 +58,92 @@ func (h *handle) uploadCreate(c *gin.Context) {
 		return
 	}
 
-	did := body["did"].(string)
-	if did == "" {
+	didStr := upload.value("did")
+	if didStr == "" {
 		err := fmt.Errorf("invalid did")
 		h.logger.Error(err)
 		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
 		return
 	}
 
-	pricef, ok := body["price"].(float64)
-	if !ok {
-		err := fmt.Errorf("invalid price")
+	priceb, err := did.ParsePrice(upload.value("price"))
+	if err != nil {
 		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+		c.JSON(ErrParamsInvalid.Code, gin.H{"message": ErrParamsInvalid.Message, "error": err.Error()})
 		return
 	}
 
-	priceb := big.NewInt(0).SetInt64(int64(pricef))
+	var keywords []string
+	for _, list := range upload.fields["keywords"] {
+		for _, keyword := range strings.Split(list, ",") {
+			if k := strings.TrimSpace(keyword); k != "" {
+				keywords = append(keywords, k)
+			}
+		}
+	}
 
-	databyte, err := base64.StdEncoding.DecodeString(data)
-	if err != nil {
-		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+	// the object is named after the Keccak256 of its content, which the
+	// client sends upfront so the object is written once under its name and
+	// deleted if the content does not match
+	hash := strings.TrimPrefix(strings.ToLower(upload.value("hash")), "0x")
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
 		return
 	}
+	object := address + hash
 
-	object := address + hex.EncodeToString(crypto.Keccak256(databyte))
-
-	var buf *bytes.Buffer = bytes.NewBuffer(databyte)
-
-	err = h.createCacheFile(object, buf)
+	// an object already named after the hash was checked when it was written,
+	// so it is kept rather than overwritten by a body that may not match. Not
+	// every backend tells a missing object apart, a storage that is down fails
+	// the put as well.
+	info, err := h.gateway.GetObjectInfo(c.Request.Context(), bucket, object)
 	if err != nil {
-		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
-		return
+		info, err = h.putHashed(c.Request.Context(), bucket, object, hash, upload.body)
 	}
-
-	info, err := h.gateway.PutObject(c.Request.Context(), bucket, object)
 	if err != nil {
-		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+		h.uploadError(c, err)
 		return
 	}
 
-	mdid, err := h.did.CreateMfileDID(info.Mid)
+	mdid, message, err := h.did.CreateMfileInfo(c.Request.Context(), address, didStr, info.Mid, priceb, keywords)
 	if err != nil {
 		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+		switch {
+		case errors.Is(err, did.ErrMfileRegistered):
+			c.JSON(ErrMfileRegistered.Code, ErrMfileRegistered)
+		case errors.Is(err, did.ErrMfileRegistering):
+			c.JSON(ErrMfileRegistering.Code, ErrMfileRegistering)
+		case errors.Is(err, did.ErrNotController):
+			c.JSON(ErrNotController.Code, ErrNotController)
+		case errors.Is(err, did.ErrMfileTaken):
+			c.JSON(ErrMfileTaken.Code, ErrMfileTaken)
+		default:
+			c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
+		}
 		return
 	}
 
-	message, err := h.did.CreateMDIDMessage(info.Mid, did, priceb)
+	c.JSON(200, gin.H{"mdid": mdid, "message": message, "hash": "0x" + hash, "size": info.Size})
+}
+
+// putHashed writes r to object and deletes it again if the Keccak256 of r is
+// not hash
+func (h *handle) putHashed(ctx context.Context, bucket, object, hash string, r io.Reader) (gateway.ObjectInfo, error) {
+	hr := gateway.NewHashReader(r)
+	info, err := h.gateway.PutObject(ctx, bucket, object, hr)
 	if err != nil {
-		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, ErrUploadFailed.Message)
-		return
+		return gateway.ObjectInfo{}, err
+	}
+	if hr.Hash() == hash {
+		return info, nil
 	}
 
-	c.JSON(200, gin.H{"mdid": mdid.String(), "message": message})
+	h.logger.Errorf("upload %s has hash %s, want %s", object, hr.Hash(), hash)
+	err = h.gateway.DeleteObject(context.WithoutCancel(ctx), bucket, object)
+	if err != nil {
+		h.logger.Errorf("delete mismatched upload %s: %s", object, err)
+	}
+	return gateway.ObjectInfo{}, errUploadHashMismatch
 }
 
 // @Summary		UploadConfirm
@@ -115,10 +151,14 @@ func (h *handle) uploadCreate(c *gin.Context) {
 // @Tags			mfile
 // @Accept			json
 // @Produce		json
-// @Param			sig		body		string	true	"sig"
-// @Param			address	body		string	true	"address"
-// @Success		200		{string}	string	"ok"
+// @Param			sig		body		string	true	"signature over the upload/create message"
+// @Param			mdid	body		string	true	"mdid"
+// @Success		200		{object}	UploadConfirmResponse
 // @Router			/mfile/upload/confirm [post]
+// @Failure		557		{object}	Error
+// @Failure		559		{object}	UploadConfirmResponse
+// @Failure		571		{object}	Error
+// @Failure		572		{object}	UploadConfirmResponse
 func (h *handle) uploadConfirm(c *gin.Context) {
 	body := make(map[string]interface{})
 	c.BindJSON(&body)
@@ -126,40 +166,91 @@ func (h *handle) uploadConfirm(c *gin.Context) {
 	if !ok {
 		err := fmt.Errorf("invalid sig")
 		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, err.Error())
+		c.JSON(ErrSignatureNull.Code, ErrSignatureNull)
 		return
 	}
 
-	mdid, ok := body["mdid"].(string)
-	if !ok {
-		err := fmt.Errorf("invaild address")
+	mdidStr, ok := body["mdid"].(string)
+	if !ok || mdidStr == "" {
+		err := fmt.Errorf("invaild mdid")
+		h.logger.Error(err)
+		c.JSON(ErrDIDNull.Code, ErrDIDNull)
+		return
+	}
+
+	sigByte, err := hexutil.Decode(sig)
+	if err != nil {
 		h.logger.Error(err)
-		c.JSON(ErrUploadFailed.Code, err)
+		c.JSON(ErrSignature.Code, ErrSignature)
 		return
 	}
 
-	h.logger.Infof("sig %s message %s address %s", sig, mdid)
+	info, err := h.did.RegisterMfileDID(c.Request.Context(), mdidStr, sigByte)
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrMfileNotFound):
+			c.JSON(ErrMfileNotFound.Code, ErrMfileNotFound)
+		case errors.Is(err, did.ErrMfileRegistering):
+			c.JSON(ErrMfileRegistering.Code, UploadConfirmResponse{MDID: info.MDID, TxHash: info.TxHash, Status: info.Status})
+		case errors.Is(err, did.ErrSignatureMismatch):
+			c.JSON(ErrSignature.Code, ErrSignature)
+		case info != nil:
+			c.JSON(ErrUploadFailed.Code, UploadConfirmResponse{MDID: info.MDID, TxHash: info.TxHash, Status: info.Status, Error: err.Error()})
+		default:
+			c.JSON(ErrUploadFailed.Code, gin.H{"message": ErrUploadFailed.Message, "error": err.Error()})
+		}
+		return
+	}
 
-	// TODO: upload
-	c.JSON(200, gin.H{"message": "success"})
+	c.JSON(200, UploadConfirmResponse{MDID: info.MDID, TxHash: info.TxHash, Status: info.Status})
 }
 
-// @Summary		Download
-// @Description	download file by mdid
+// @Summary		DownloadChallenge
+// @Description	get a single-use challenge address signs to download a priced mfile
 // @Tags			mfile
-// @Accept			json
 // @Produce		json
 // @Param			mdid	query		string	true	"mdid"
 // @Param			address	query		string	true	"address"
-// @Success		200		{string}	string	"ok"
-// @Router			/mfile/download [get]
-func (h *handle) download(c *gin.Context) {
+// @Success		200		{object}	ChallengeResponse
+// @Router			/mfile/download/challenge [get]
+func (h *handle) downloadChallenge(c *gin.Context) {
 	mdid := c.Query("mdid")
-
 	address := c.Query("address")
+	if mdid == "" || !common.IsHexAddress(address) {
+		c.JSON(ErrParamsInvalid.Code, ErrParamsInvalid)
+		return
+	}
+
+	challenge, err := h.did.NewDownloadChallenge(mdid, address)
+	if err != nil {
+		h.logger.Error(err)
+		c.JSON(ErrChallengeFailed.Code, gin.H{"message": ErrChallengeFailed.Message, "error": err.Error()})
+		return
+	}
+	c.JSON(200, newChallengeResponse(challenge))
+}
 
-	if mdid == "" || address == "" {
-		err := fmt.Errorf("invalid cid or address")
+// @Summary		Download
+// @Description	download file by mdid. Files that are not registered with price 0 need a signed challenge from an address of a did that controls, bought or was granted the file.
+// @Tags			mfile
+// @Produce		octet-stream
+// @Param			mdid	query		string	true	"mdid"
+// @Param			address	query		string	false	"address, for priced files"
+// @Param			did		query		string	false	"did of address, for priced files"
+// @Param			X-Challenge-Nonce		header	string	false	"nonce of the download challenge, for priced files"
+// @Param			X-Challenge-Signature	header	string	false	"signature over the challenge, for priced files"
+// @Param			Range	header		string	false	"single byte range, e.g. bytes=0-1023"
+// @Param			If-Range	header	string	false	"ETag or Last-Modified the range applies to"
+// @Success		200		{file}		file
+// @Success		206		{file}		file
+// @Failure		416		{object}	Error
+// @Failure		576		{object}	DownloadDeniedResponse
+// @Router			/mfile/download [get]
+func (h *handle) download(c *gin.Context) {
+	mdid := c.Query("mdid")
+	if mdid == "" {
+		err := fmt.Errorf("invalid mdid")
 		h.logger.Error(err)
 		c.JSON(ErrDownloadFailed.Code, err.Error())
 		return
@@ -172,28 +263,63 @@ func (h *handle) download(c *gin.Context) {
 		return
 	}
 
-	info, err := h.gateway.GetObjectInfoByMid(c.Request.Context(), mfile.Identifier)
+	public, err := h.did.IsMfilePublic(c.Request.Context(), mdid)
 	if err != nil {
 		h.logger.Error(err)
 		c.JSON(ErrDownloadFailed.Code, err.Error())
 		return
 	}
+	if !public && !h.checkDownload(c, mdid) {
+		return
+	}
 
-	var w bytes.Buffer
-	err = h.gateway.GetObject(c.Request.Context(), mfile.Identifier, &w)
+	info, err := h.gateway.GetObjectInfoByMid(c.Request.Context(), mfile.Identifier)
 	if err != nil {
 		h.logger.Error(err)
+		if storageUnavailable(c, err) {
+			return
+		}
 		c.JSON(ErrDownloadFailed.Code, err.Error())
 		return
 	}
 
-	head := fmt.Sprintf("attachment; filename=\"%s\"", info.Name)
-	extraHeaders := map[string]string{
-		"Content-Disposition": head,
+	h.serveObject(c, "", mfile.Identifier, info)
+}
+
+// checkDownload verifies the signed challenge and read permission of a
+// priced mfile, answering the denial itself
+func (h *handle) checkDownload(c *gin.Context, mdid string) bool {
+	deny := func(reason string) bool {
+		c.JSON(ErrDownloadDenied.Code, DownloadDeniedResponse{Error: ErrDownloadDenied, Reason: reason})
+		return false
 	}
 
-	ft := mime.TypeByExtension(info.Name)
-	c.DataFromReader(http.StatusOK, info.Size, ft, &w, extraHeaders)
+	address := c.Query("address")
+	didStr := c.Query("did")
+	nonce, sig, ok := challengeHeaders(c)
+	if !common.IsHexAddress(address) || didStr == "" || !ok {
+		return deny(DenyChallengeRequired)
+	}
+
+	err := h.did.CheckMfileRead(c.Request.Context(), mdid, didStr, address, nonce, sig)
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrChallengeExpired):
+			return deny(DenyChallengeExpired)
+		case errors.Is(err, did.ErrSignatureMismatch):
+			return deny(DenySignature)
+		case errors.Is(err, did.ErrNotDIDKey):
+			return deny(DenyNotDIDKey)
+		case errors.Is(err, did.ErrDIDNotFound), errors.Is(err, did.ErrDIDDeactivated):
+			return deny(DenyDIDInactive)
+		case errors.Is(err, did.ErrReadDenied):
+			return deny(DenyNoPermission)
+		default:
+			c.JSON(ErrDownloadFailed.Code, gin.H{"message": ErrDownloadFailed.Message, "error": err.Error()})
+			return false
+		}
+	}
 
-	c.JSON(200, "ok")
+	return true
 }
@@ -1,11 +1,22 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/did-server/internal/gateway"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
 )
 
+// headers carrying a signed challenge, kept out of the query string so that
+// access logs do not record them
+const (
+	HeaderChallengeNonce     = "X-Challenge-Nonce"
+	HeaderChallengeSignature = "X-Challenge-Signature"
+)
+
 func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		method := c.Request.Method
@@ -13,7 +24,7 @@ func Cors() gin.HandlerFunc {
 		if origin != "" {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
-			c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token")
+			c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token, "+HeaderChallengeNonce+", "+HeaderChallengeSignature)
 			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -23,3 +34,45 @@ func Cors() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// requireStorage answers 503 while the storage node is down, so that storage
+// routes fail fast and the rest of the server keeps working
+func (h *handle) requireStorage(c *gin.Context) {
+	health := h.storageHealth()
+	if !health.Healthy {
+		c.AbortWithStatusJSON(ErrStorageUnavailable.Code, gin.H{"message": ErrStorageUnavailable.Message, "error": health.Error})
+		return
+	}
+	c.Next()
+}
+
+// storageUnavailable answers 503 if err is from a storage node that went down
+func storageUnavailable(c *gin.Context, err error) bool {
+	if !errors.Is(err, gateway.ErrUnavailable) {
+		return false
+	}
+	c.JSON(ErrStorageUnavailable.Code, gin.H{"message": ErrStorageUnavailable.Message, "error": err.Error()})
+	return true
+}
+
+// requireFunds answers 503 while the admin balance is too low to pay for
+// registrations
+func (h *handle) requireFunds(c *gin.Context) {
+	balance := h.did.Controller.Balance().Get()
+	if balance.Low {
+		err := fmt.Sprintf("admin balance %s pays for %d registrations", balance.Balance, balance.RegistrationsLeft)
+		c.AbortWithStatusJSON(ErrAirdropPaused.Code, gin.H{"message": ErrAirdropPaused.Message, "error": err})
+		return
+	}
+	c.Next()
+}
+
+// challengeHeaders returns the nonce and signature of a signed challenge
+func challengeHeaders(c *gin.Context) (string, []byte, bool) {
+	nonce := c.GetHeader(HeaderChallengeNonce)
+	sig, err := hexutil.Decode(c.GetHeader(HeaderChallengeSignature))
+	if nonce == "" || err != nil {
+		return "", nil, false
+	}
+	return nonce, sig, true
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/gateway"
+	"github.com/gin-gonic/gin"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+func TestRequireStorage(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	// nothing listens on port 1, so the server starts degraded
+	storage, err := gateway.NewStorageWithApiAndToken("/ip4/127.0.0.1/tcp/1", "", &config.StorageConfig{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	testRequireStorage(t, &handle{logger: logger, gateway: storage})
+}
+
+func TestRequireStorageNotOpened(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+	h := &handle{cfg: config.Default(), logger: logger, storageErr: errors.New("storage node unreachable")}
+	testRequireStorage(t, h)
+}
+
+// testRequireStorage checks a storage route answers 503 and the health is
+// degraded while the storage of h is down
+func testRequireStorage(t *testing.T, h *handle) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/health", h.health)
+	r.GET("/file/list", h.requireStorage, h.fileList)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/file/list?address=0x0000000000000000000000000000000000000001", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("list: got status %d, want 503", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var res HealthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || res.Status != "degraded" || res.Storage.Healthy || res.Storage.Error == "" {
+		t.Fatalf("health: got %d %+v", w.Code, res)
+	}
+}
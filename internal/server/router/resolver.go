@@ -0,0 +1,100 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/did-server/internal/did"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mimeDIDLdJSON       = "application/did+ld+json"
+	mimeDIDJSON         = "application/did+json"
+	mimeResolution      = "application/ld+json"
+	mimeJSON            = "application/json"
+	resolutionProfile   = `application/ld+json;profile="https://w3id.org/did-resolution"`
+	resolutionContext   = "https://w3id.org/did-resolution/v1"
+	errInvalidDID       = "invalidDid"
+	errNotFound         = "notFound"
+	errRepresentation   = "representationNotSupported"
+	errInternalResolver = "internalError"
+)
+
+// loadResolverMoudles serves the DIF Universal Resolver HTTP binding,
+// https://w3c-ccg.github.io/did-resolution/#bindings-https
+func loadResolverMoudles(r *gin.RouterGroup, h *handle) {
+	r.GET("/identifiers/:did", h.resolveDID)
+}
+
+// @Summary		ResolveDID
+// @Description	Resolve a did:memo or did:mfile DID to its W3C DID Document. Accept application/did+ld+json returns the document alone, otherwise the resolution result is returned.
+// @Tags			DID
+// @Produce		application/did+ld+json,application/ld+json
+// @Param			did	path		string	true	"did"
+// @Success		200	{object}	ResolutionResponse
+// @Failure		400	{object}	ResolutionResponse
+// @Failure		404	{object}	ResolutionResponse
+// @Failure		406	{object}	ResolutionResponse
+// @Failure		410	{object}	ResolutionResponse
+// @Router			/1.0/identifiers/{did} [get]
+func (h *handle) resolveDID(c *gin.Context) {
+	accept := c.NegotiateFormat(mimeResolution, mimeJSON, mimeDIDLdJSON, mimeDIDJSON)
+	if accept == "" {
+		h.resolveError(c, http.StatusNotAcceptable, errRepresentation)
+		return
+	}
+
+	doc, meta, err := h.did.ResolveDID(c.Request.Context(), c.Param("did"))
+	if err != nil {
+		h.logger.Error(err)
+		switch {
+		case errors.Is(err, did.ErrInvalidDID):
+			h.resolveError(c, http.StatusBadRequest, errInvalidDID)
+		case errors.Is(err, did.ErrDIDNotFound):
+			h.resolveError(c, http.StatusNotFound, errNotFound)
+		default:
+			h.resolveError(c, http.StatusInternalServerError, errInternalResolver)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if meta.Deactivated {
+		status = http.StatusGone
+	}
+
+	switch accept {
+	case mimeDIDLdJSON, mimeDIDJSON:
+		data, err := json.Marshal(doc)
+		if err != nil {
+			h.resolveError(c, http.StatusInternalServerError, errInternalResolver)
+			return
+		}
+		c.Data(status, accept, data)
+	default:
+		h.resolveResult(c, status, ResolutionResponse{
+			Context:               resolutionContext,
+			DIDDocument:           doc,
+			DIDResolutionMetadata: ResolutionMetadata{ContentType: mimeDIDLdJSON},
+			DIDDocumentMetadata:   meta,
+		})
+	}
+}
+
+func (h *handle) resolveError(c *gin.Context, status int, code string) {
+	h.resolveResult(c, status, ResolutionResponse{
+		Context:               resolutionContext,
+		DIDResolutionMetadata: ResolutionMetadata{Error: code},
+	})
+}
+
+func (h *handle) resolveResult(c *gin.Context, status int, res ResolutionResponse) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, resolutionProfile, data)
+}
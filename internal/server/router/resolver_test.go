@@ -0,0 +1,167 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/contract/simchain"
+	"github.com/did-server/internal/did"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+// newResolverTestRouter serves the resolver on a simulated chain, or
+// without one if chain is false
+func newResolverTestRouter(t *testing.T, chain bool) (*gin.Engine, *did.MemoDID) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "did.db")
+
+	var memoDID *did.MemoDID
+	var err error
+	if chain {
+		sim, err := simchain.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sim.Close() })
+
+		controller, err := sim.Controller(logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		memoDID, err = did.NewMemoDIDWithController(cfg, controller, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		memoDID, err = did.NewMemoDIDWithController(cfg, nil, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &handle{cfg: cfg, logger: logger, did: memoDID}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	loadResolverMoudles(r.Group("/1.0"), h)
+	return r, memoDID
+}
+
+func resolve(t *testing.T, r *gin.Engine, didStr, accept string) (*httptest.ResponseRecorder, ResolutionResponse) {
+	req := httptest.NewRequest(http.MethodGet, "/1.0/identifiers/"+didStr, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := serve(r, req)
+
+	var res ResolutionResponse
+	if w.Header().Get("Content-Type") == resolutionProfile {
+		err := json.Unmarshal(w.Body.Bytes(), &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, res
+}
+
+func TestResolveDIDErrors(t *testing.T) {
+	r, _ := newResolverTestRouter(t, false)
+	didStr := "did:memo:947e38821cec0d483922bf082958caa38c9c8900cdd9184a159ea07a5e18b9ac"
+
+	w, res := resolve(t, r, didStr, "text/html")
+	if w.Code != http.StatusNotAcceptable || w.Header().Get("Content-Type") != resolutionProfile {
+		t.Fatalf("text/html: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if res.DIDResolutionMetadata.Error != errRepresentation || res.DIDDocument != nil {
+		t.Fatalf("text/html: %+v", res)
+	}
+
+	w, res = resolve(t, r, "did:example:123", mimeDIDLdJSON)
+	if w.Code != http.StatusBadRequest || res.DIDResolutionMetadata.Error != errInvalidDID {
+		t.Fatalf("invalid did: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestSimulatedResolveDID(t *testing.T) {
+	r, memoDID := newResolverTestRouter(t, true)
+	ctx := context.Background()
+
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	didStr, err := memoDID.RegisterDIDByAddressByAdmin(ctx, crypto.PubkeyToAddress(sk.PublicKey).Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the document alone
+	for _, accept := range []string{mimeDIDLdJSON, mimeDIDJSON} {
+		w, _ := resolve(t, r, didStr, accept)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != accept {
+			t.Fatalf("%s: %d %s", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		var doc did.DIDDocument
+		err = json.Unmarshal(w.Body.Bytes(), &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.ID != didStr || len(doc.VerificationMethod) != 1 {
+			t.Fatalf("%s: document %+v", accept, doc)
+		}
+	}
+
+	// the resolution result, also when nothing is asked for
+	for _, accept := range []string{resolutionProfile, mimeResolution, mimeJSON, ""} {
+		w, res := resolve(t, r, didStr, accept)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != resolutionProfile {
+			t.Fatalf("%q: %d %s", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if res.Context != resolutionContext || res.DIDDocument == nil || res.DIDDocument.ID != didStr ||
+			res.DIDResolutionMetadata.ContentType != mimeDIDLdJSON || res.DIDDocumentMetadata == nil || res.DIDDocumentMetadata.Deactivated {
+			t.Fatalf("%q: %+v", accept, res)
+		}
+	}
+
+	w, res := resolve(t, r, "did:mfile:cid:bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e", "")
+	if w.Code != http.StatusNotFound || res.DIDResolutionMetadata.Error != errNotFound {
+		t.Fatalf("unregistered mfile: %d %s", w.Code, w.Body)
+	}
+
+	// a deactivated DID is gone, with its metadata
+	msg, err := memoDID.GetDeleteSignatureMassage(ctx, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(accounts.TextHash(hexutil.MustDecode(msg)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	err = memoDID.DeactivateDID(ctx, didStr, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, res = resolve(t, r, didStr, "")
+	if w.Code != http.StatusGone || res.DIDDocumentMetadata == nil || !res.DIDDocumentMetadata.Deactivated ||
+		res.DIDDocument == nil || len(res.DIDDocument.VerificationMethod) != 0 {
+		t.Fatalf("deactivated: %d %s", w.Code, w.Body)
+	}
+	w, _ = resolve(t, r, didStr, mimeDIDLdJSON)
+	if w.Code != http.StatusGone || w.Header().Get("Content-Type") != mimeDIDLdJSON {
+		t.Fatalf("deactivated document: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
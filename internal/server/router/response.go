@@ -1,9 +1,59 @@
 package router
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/did-server/internal/contract"
+	"github.com/did-server/internal/did"
+	"github.com/did-server/internal/gateway"
+)
+
 type CreateDIDResponse struct {
 	DID string `json:"did"`
 }
 
+type CreateDIDJobResponse struct {
+	ID     string `json:"id"`
+	DID    string `json:"did"`
+	Status string `json:"status"`
+}
+
+type JobResponse struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Address string `json:"address"`
+	DID     string `json:"did"`
+	Number  int    `json:"number"`
+	Status  string `json:"status"`
+	TxHash  string `json:"txHash"`
+	Error   string `json:"error,omitempty"`
+}
+
+type EventResponse struct {
+	Name        string          `json:"name"`
+	Contract    string          `json:"contract"`
+	DID         string          `json:"did"`
+	Mfile       string          `json:"mfile,omitempty"`
+	Args        json.RawMessage `json:"args" swaggertype:"object"`
+	BlockNumber uint64          `json:"blockNumber"`
+	BlockHash   string          `json:"blockHash"`
+	TxHash      string          `json:"txHash"`
+	LogIndex    uint            `json:"logIndex"`
+}
+
+type DIDEventsResponse struct {
+	DID          string          `json:"did"`
+	IndexedBlock uint64          `json:"indexedBlock"`
+	Events       []EventResponse `json:"events"`
+}
+
+type AirdropBatchResponse struct {
+	Batch   string              `json:"batch"`
+	Done    bool                `json:"done"`
+	Results []did.AirdropResult `json:"results"`
+}
+
 type GetDIDInfoResponse struct {
 	DID  string    `json:"did"`
 	Info []DIDInfo `json:"info"`
@@ -21,11 +71,87 @@ type DIDInfo struct {
 }
 
 type AddVerifyInfoResponse struct {
+	DID   string `json:"did"`
+	Index uint64 `json:"index"`
 }
 
 type ChangeVerifyInfoResponse struct {
+	DID    string `json:"did"`
+	Index  uint64 `json:"index"`
+	Action string `json:"action"`
 }
 
 type GetSigMsgResponse struct {
 	Msg string `json:"msg"`
 }
+
+type ResolutionResponse struct {
+	Context               string                   `json:"@context"`
+	DIDDocument           *did.DIDDocument         `json:"didDocument,omitempty"`
+	DIDResolutionMetadata ResolutionMetadata       `json:"didResolutionMetadata"`
+	DIDDocumentMetadata   *did.DIDDocumentMetadata `json:"didDocumentMetadata,omitempty"`
+}
+
+type ResolutionMetadata struct {
+	ContentType string `json:"contentType,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type UploadConfirmResponse struct {
+	MDID   string `json:"mdid"`
+	TxHash string `json:"txHash"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ChallengeResponse struct {
+	Nonce   string `json:"nonce"`
+	Msg     string `json:"msg"`
+	Expires int64  `json:"expires"`
+}
+
+func newChallengeResponse(c *did.Challenge) ChallengeResponse {
+	return ChallengeResponse{Nonce: c.Nonce, Msg: c.Msg, Expires: c.Expires}
+}
+
+// reasons of a DownloadDeniedResponse
+const (
+	DenyChallengeRequired = "challenge_required"
+	DenyChallengeExpired  = "challenge_expired"
+	DenySignature         = "signature_mismatch"
+	DenyNotDIDKey         = "address_not_did_key"
+	DenyDIDInactive       = "did_inactive"
+	DenyNoPermission      = "no_read_permission"
+)
+
+type DownloadDeniedResponse struct {
+	Error
+	Reason string
+}
+
+type FileInfoResponse struct {
+	Name string    `json:"name"`
+	Size int64     `json:"size"`
+	CID  string    `json:"cid"`
+	Time time.Time `json:"time"`
+}
+
+func newFileInfoResponse(info gateway.ObjectInfo) FileInfoResponse {
+	return FileInfoResponse{
+		Name: info.Name,
+		Size: info.Size,
+		CID:  info.Mid,
+		Time: info.CreateTime,
+	}
+}
+
+type FileListResponse struct {
+	Files      []FileInfoResponse `json:"files"`
+	NextMarker string             `json:"nextMarker,omitempty"`
+}
+
+type HealthResponse struct {
+	Status  string                `json:"status"`
+	Storage gateway.NodeHealth    `json:"storage"`
+	Chain   contract.ClientHealth `json:"chain"`
+}
@@ -1,46 +1,98 @@
 package router
 
 import (
+	"context"
+	"net/http"
 	"os"
+	"time"
 
+	"github.com/did-server/config"
+	"github.com/did-server/internal/contract"
 	"github.com/did-server/internal/did"
 	"github.com/did-server/internal/gateway"
 	"github.com/gin-gonic/gin"
 	"github.com/go-kratos/kratos/v2/log"
 	klog "github.com/go-kratos/kratos/v2/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type handle struct {
+	cfg     *config.Config
 	logger  *klog.Helper
 	did     *did.MemoDID
-	gateway *gateway.Mefs
+	gateway gateway.Storage
+	// storageErr is why the storage could not be opened, gateway is nil then
+	storageErr error
 }
 
-func NewRouter(chain string, r *gin.Engine) {
+// NewRouter loads the routes on r and runs the background loops until ctx is
+// done. A storage that cannot be opened leaves the server degraded, its
+// routes answer 503.
+func NewRouter(ctx context.Context, cfg *config.Config, r *gin.Engine) error {
 	logger := klog.With(klog.NewStdLogger(os.Stdout),
 		"ts", klog.DefaultTimestamp,
 		"caller", klog.DefaultCaller,
 	)
 
 	loggers := klog.NewHelper(logger)
-	did, err := did.NewMemoDID(chain, loggers)
+	did, err := did.NewMemoDID(cfg, loggers)
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	gateway, err := gateway.NewStorage(log.NewHelper(logger))
-	if err != nil {
-		log.NewHelper(logger).Error(err)
-		return
+	go did.RunJobs(ctx)
+	go did.Controller.RunFeeBumper(ctx)
+	go did.Controller.Balance().Run(ctx)
+	if did.Indexer != nil {
+		go did.Indexer.Run(ctx)
 	}
+	go did.RunReconcile(ctx, time.Duration(cfg.Job.ReconcileInterval)*time.Second, cfg.Job.ReconcileRepair)
 
 	h := &handle{
-		did:     did,
-		logger:  loggers,
-		gateway: gateway,
+		cfg:    cfg,
+		did:    did,
+		logger: loggers,
+	}
+
+	storage, err := gateway.NewStorage(&cfg.Storage, log.NewHelper(logger))
+	if err != nil {
+		loggers.Errorf("open storage, storage routes are unavailable: %s", err)
+		h.storageErr = err
+	} else {
+		h.gateway = storage
 	}
 
 	loadDIDmoudles(r.Group("/did"), h)
 	loadMfileDIDMoudles(r.Group("/mfile"), h)
 	loadFileMoudles(r.Group("/file"), h)
+	loadResolverMoudles(r.Group("/1.0"), h)
+	loadAdminMoudles(r.Group("/admin"), h)
+	r.GET("/health", h.health)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return nil
+}
+
+// @Summary		Health
+// @Description	server health, degraded while the storage node or the chain rpc is down
+// @Tags			health
+// @Produce		json
+// @Success		200	{object}	HealthResponse
+// @Router			/health [get]
+func (h *handle) health(c *gin.Context) {
+	res := HealthResponse{Status: "ok", Storage: h.storageHealth(), Chain: contract.ClientHealth{Healthy: true}}
+	if h.did != nil {
+		res.Chain = h.did.Controller.Health()
+	}
+	if !res.Storage.Healthy || !res.Chain.Healthy {
+		res.Status = "degraded"
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// storageHealth is the health of the storage node, never healthy if it could
+// not be opened
+func (h *handle) storageHealth() gateway.NodeHealth {
+	if h.gateway == nil {
+		return gateway.NodeHealth{Addr: h.cfg.Storage.Type, Error: h.storageErr.Error()}
+	}
+	return h.gateway.Health()
 }
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFormValue bounds the form fields sent before the file part
+var maxFormValue int64 = 64 << 10
+
+var (
+	errUploadNoFile       = errors.New("multipart body has no file part")
+	errUploadContentType  = errors.New("content type must be multipart/form-data or application/octet-stream")
+	errUploadHashMismatch = errors.New("upload does not match its hash")
+)
+
+// upload is a streamed request body with its form fields
+type upload struct {
+	fields url.Values
+	name   string
+	body   io.Reader
+}
+
+func (u *upload) value(key string) string {
+	return strings.TrimSpace(u.fields.Get(key))
+}
+
+// openUpload streams the file of a multipart/form-data request, whose fields
+// must come before the part named file, or a raw application/octet-stream
+// body. Query parameters are used for fields not in the form. Reading more
+// than storage.maxUploadSize bytes fails with *http.MaxBytesError.
+func (h *handle) openUpload(c *gin.Context) (*upload, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.cfg.Storage.MaxUploadSize)
+
+	u := &upload{fields: c.Request.URL.Query()}
+
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil {
+		return nil, errUploadContentType
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		mr, err := c.Request.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, errUploadNoFile
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if part.FormName() == "file" {
+				u.name = part.FileName()
+				u.body = part
+				return u, nil
+			}
+
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValue))
+			if err != nil {
+				return nil, err
+			}
+			u.fields.Set(part.FormName(), string(value))
+		}
+	case "application/octet-stream":
+		u.name = c.Query("name")
+		u.body = c.Request.Body
+		return u, nil
+	default:
+		return nil, errUploadContentType
+	}
+}
+
+// uploadError answers a failed upload, 413 if the body is too large, 575 if
+// it does not match its hash and 503 if the storage node went down
+func (h *handle) uploadError(c *gin.Context, err error) {
+	h.logger.Error(err)
+
+	if storageUnavailable(c, err) {
+		return
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": ErrUploadTooLarge.Message, "error": err.Error()})
+		return
+	}
+	if errors.Is(err, errUploadHashMismatch) {
+		c.JSON(ErrUploadHashMismatch.Code, ErrUploadHashMismatch)
+		return
+	}
+
+	c.JSON(ErrUploadFailed.Code, gin.H{"message": ErrUploadFailed.Message, "error": err.Error()})
+}
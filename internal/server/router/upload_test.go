@@ -0,0 +1,100 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/did-server/config"
+	"github.com/did-server/internal/gateway"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	klog "github.com/go-kratos/kratos/v2/log"
+)
+
+const uploadAddress = "0x47D4f617A654337AFB121F455629fF7d92b670eA"
+
+func testUpload(max int64, req *http.Request) (*upload, []byte, error) {
+	cfg := config.Default()
+	cfg.Storage.MaxUploadSize = max
+	h := &handle{cfg: cfg, logger: klog.NewHelper(klog.NewStdLogger(os.Stdout))}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+
+	u, err := h.openUpload(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := io.ReadAll(u.body)
+	return u, data, err
+}
+
+func TestOpenUploadMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("address", uploadAddress)
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/mfile/upload/create?price=10", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	u, data, err := testUpload(1<<20, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" || u.name != "a.txt" || u.value("address") != uploadAddress || u.value("price") != "10" {
+		t.Fatalf("unexpected upload %q %+v", data, u)
+	}
+}
+
+func TestOpenUploadTooLarge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/file/upload?name=a", bytes.NewReader(make([]byte, 100)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	_, _, err := testUpload(10, req)
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		t.Fatalf("read past max upload size: %v", err)
+	}
+}
+
+func TestPutHashed(t *testing.T) {
+	logger := klog.NewHelper(klog.NewStdLogger(os.Stdout))
+	storage, err := gateway.NewLocal(t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handle{cfg: config.Default(), logger: logger, gateway: storage}
+
+	ctx := context.Background()
+	err = storage.MakeBucketWithLocation(ctx, "mdid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := hex.EncodeToString(crypto.Keccak256([]byte("hello")))
+	info, err := h.putHashed(ctx, "mdid", uploadAddress+hash, hash, strings.NewReader("hello"))
+	if err != nil || info.Size != 5 {
+		t.Fatalf("put of a matching upload: %+v %v", info, err)
+	}
+
+	_, err = h.putHashed(ctx, "mdid", uploadAddress+"mismatched", hash, strings.NewReader("hello world"))
+	if !errors.Is(err, errUploadHashMismatch) {
+		t.Fatalf("put of a mismatched upload: %v", err)
+	}
+	_, err = storage.GetObjectInfo(ctx, "mdid", uploadAddress+"mismatched")
+	if !errors.Is(err, gateway.ErrObjectNotFound) {
+		t.Fatalf("mismatched upload kept: %v", err)
+	}
+}
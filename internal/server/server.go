@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/did-server/config"
 	"github.com/did-server/docs"
 	"github.com/did-server/internal/server/router"
 	"github.com/gin-gonic/gin"
@@ -10,7 +12,9 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-func NewServer(chain, port string) *http.Server {
+// NewServer builds the http server, its background loops run until ctx is
+// done
+func NewServer(ctx context.Context, cfg *config.Config) (*http.Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.Default()
@@ -21,13 +25,16 @@ func NewServer(chain, port string) *http.Server {
 		})
 	})
 
-	router.NewRouter(chain, r)
+	err := router.NewRouter(ctx, cfg, r)
+	if err != nil {
+		return nil, err
+	}
 
 	docs.SwaggerInfo.Schemes = []string{"http", "https"}
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	return &http.Server{
-		Addr:    ":" + port,
+		Addr:    ":" + cfg.Server.Port,
 		Handler: r,
-	}
+	}, nil
 }